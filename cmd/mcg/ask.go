@@ -6,13 +6,20 @@ import (
 	"os"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/hawk/mcgraph/internal/db"
 	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/secrets"
 	"github.com/hawk/mcgraph/internal/tui"
 	"github.com/spf13/cobra"
 )
 
-var noSave bool
+var (
+	noSave     bool
+	askProfile string
+	askCompare []string
+	askAttach  []string
+)
 
 func init() {
 	rootCmd.AddCommand(askCmd)
@@ -20,6 +27,10 @@ func init() {
 	// Add a flag to run in TUI mode
 	askCmd.Flags().BoolP("interactive", "i", false, "Run in interactive chat mode with TUI")
 	askCmd.Flags().BoolVarP(&noSave, "no-save", "n", false, "Don't save the conversation")
+	askCmd.Flags().StringVarP(&askProfile, "profile", "p", llm.DefaultProfileName, "System prompt profile to use")
+	askCmd.Flags().StringSliceVar(&askCompare, "compare", nil, "Ask several LLMs at once and compare their answers, e.g. openai,claude,gemini")
+	askCmd.Flags().StringArrayVarP(&askAttach, "attach", "a", nil, "Include a file, image or glob with the question (repeatable)")
+	addProjectFlags(askCmd)
 }
 
 var askCmd = &cobra.Command{
@@ -31,13 +42,26 @@ If used with the -i/--interactive flag, it will start an interactive chat sessio
 		// Check if interactive mode is requested
 		interactive, _ := cmd.Flags().GetBool("interactive")
 		
+		profile, err := llm.LoadProfile(askProfile)
+		if err != nil {
+			return err
+		}
+		
+		// Add the project context when run inside a git repository
+		proj := currentProject()
+		
+		attachments, err := readAttachments(askAttach)
+		if err != nil {
+			return err
+		}
+		
 		if interactive {
 			// Start the interactive TUI
 			ctx := context.Background()
 			
 			// Create a new conversation
 			model := string(llm.GetCurrentLLM())
-			conversation, err := dbConn.CreateConversation(ctx, "New Conversation", model)
+			conversation, err := dbConn.CreateConversation(ctx, "New Conversation", model, profile.Name, projectRoot(proj))
 			if err != nil {
 				return fmt.Errorf("error creating conversation: %w", err)
 			}
@@ -47,7 +71,13 @@ If used with the -i/--interactive flag, it will start an interactive chat sessio
 			
 			// Create a DB adapter and start the interactive TUI chat
 			dbAdapter := db.NewAdapter(dbConn)
-			return tui.StartChat(dbAdapter, conversation.ID, nil)
+			return tui.StartChat(dbAdapter, conversation.ID, nil, tui.ChatOptions{
+				Profile:       profile,
+				Project:       proj,
+				SystemContext: projectContext(proj),
+				Attachments:   attachments,
+				Plain:         usePlainChat(false),
+			})
 		}
 		
 		// If no arguments provided in non-interactive mode, show help
@@ -60,22 +90,34 @@ If used with the -i/--interactive flag, it will start an interactive chat sessio
 		// Standard CLI mode
 		question := strings.Join(args, " ")
 		
+		// Secrets are redacted, or the question refused, before anything is sent or saved
+		question, attachments, err = checkSecrets(question, attachments)
+		if err != nil {
+			return err
+		}
+		
+		if len(askCompare) > 0 {
+			return compareAnswers(question, attachments, askCompare, profile, proj)
+		}
+		
 		currentLLM := llm.GetCurrentLLM()
 		fmt.Printf("Using %s to answer your question...\n", currentLLM)
 		
-		answer, err := llm.GetResponse(question)
+		if len(attachments) > 0 && !llm.CurrentBackend().AcceptsImages() {
+			for _, attachment := range attachments {
+				if attachment.IsImage() {
+					fmt.Fprintf(os.Stderr, "Warning: %s doesn't accept images, %s is left out\n", currentLLM, attachment.Name)
+				}
+			}
+		}
+		
+		messages := []llm.Message{{Role: llm.RoleUser, Content: question, Attachments: attachments}}
+		response, err := llm.Chat(messages, profile.WithSystemContext(projectContext(proj)))
 		if err != nil {
 			fmt.Printf("Sorry, I encountered an error: %v\n", err)
-			
-			// Display the relevant API key that needs to be set
-			envVar := llm.GetAPIKeyEnvVar(currentLLM)
-			if envVar != "" {
-				fmt.Printf("Make sure you have set the %s environment variable.\n", envVar)
-			} else {
-				fmt.Println("Make sure you have set the required API key environment variable.")
-			}
 			return nil
 		}
+		answer := response.Content
 		
 		// Save the conversation if not disabled
 		if !noSave {
@@ -83,33 +125,95 @@ If used with the -i/--interactive flag, it will start an interactive chat sessio
 			
 			// Create a new conversation
 			model := string(currentLLM)
-			conversation, err := dbConn.CreateConversation(ctx, question, model)
+			conversation, err := dbConn.CreateConversation(ctx, question, model, profile.Name, projectRoot(proj))
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: Failed to save conversation: %v\n", err)
 			} else {
 				// Add the messages
-				_, err = dbConn.AddMessage(ctx, conversation.ID, "user", question)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to save user message: %v\n", err)
-				}
+				saveQuestion(ctx, conversation.ID, question, attachments)
 				
-				_, err = dbConn.AddMessage(ctx, conversation.ID, "assistant", answer)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to save assistant message: %v\n", err)
-				}
+				answeredBy := llm.Backend{LLM: currentLLM, Model: response.Model}
+				saveAnswer(ctx, conversation.ID, answeredBy, response)
 				
-				// Generate a title
-				_, err = dbConn.GenerateTitle(ctx, conversation.ID)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to generate title: %v\n", err)
-				}
+				// Generate a title while the answer is printed
+				titled := make(chan struct{})
+				go func() {
+					defer close(titled)
+					if _, err := titleConversation(ctx, conversation.ID, answeredBy, question, answer); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: Failed to generate title: %v\n", err)
+					}
+				}()
+				defer func() { <-titled }()
 				
 				fmt.Printf("\nConversation saved with ID: %s\n", conversation.ID.String()[:8])
 				fmt.Println("Use 'mcg history show " + conversation.ID.String()[:8] + "' to view it later")
 			}
 		}
 		
+		if response.Cached {
+			fmt.Println("(Answered from the response cache, pass --no-cache to ask again)")
+		}
 		fmt.Println(answer)
 		return nil
 	},
-}
\ No newline at end of file
+}
+
+// readAttachments reads the files matching the --attach paths and globs
+func readAttachments(patterns []string) ([]llm.Attachment, error) {
+	var attachments []llm.Attachment
+	for _, pattern := range patterns {
+		matched, err := llm.ReadAttachments(pattern)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, matched...)
+	}
+	return attachments, nil
+}
+
+// checkSecrets applies the secrets policy in $MCGRAPH_SECRETS to a question and its attachments
+func checkSecrets(question string, attachments []llm.Attachment) (string, []llm.Attachment, error) {
+	policy, err := secrets.PolicyFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	
+	checked, findings, err := llm.CheckSecrets(policy, llm.Message{Role: llm.RoleUser, Content: question, Attachments: attachments})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w; remove them, or set %s=redact to send them redacted", err, secrets.PolicyEnvVar)
+	}
+	if len(findings) > 0 {
+		if policy == secrets.Warn {
+			fmt.Fprintf(os.Stderr, "Warning: your question contains %s, sending it as is\n", secrets.Describe(findings))
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: redacted %s from your question\n", secrets.Describe(findings))
+		}
+	}
+	return checked.Content, checked.Attachments, nil
+}
+
+// saveQuestion saves the question of a new conversation with its attachments
+func saveQuestion(ctx context.Context, conversationID uuid.UUID, question string, attachments []llm.Attachment) {
+	message, err := dbConn.AddMessage(ctx, conversationID, llm.RoleUser, "", question)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save user message: %v\n", err)
+		return
+	}
+	if err := dbConn.AddAttachments(ctx, message.ID, tui.DBAttachments(attachments)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save attachments: %v\n", err)
+	}
+}
+
+// saveAnswer saves the answer of answeredBy, marking it when it came from the response cache
+func saveAnswer(ctx context.Context, conversationID uuid.UUID, answeredBy llm.Backend, response llm.Response) {
+	message, err := dbConn.AddMessage(ctx, conversationID, llm.RoleAssistant, answeredBy.String(), response.Content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save assistant message: %v\n", err)
+		return
+	}
+	if response.Cached {
+		if err := dbConn.MarkMessageCached(ctx, message.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to mark the answer as cached: %v\n", err)
+		}
+	}
+}
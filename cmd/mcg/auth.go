@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/auth"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	// apiKeyFlags are the provider=key pairs given with --api-key
+	apiKeyFlags []string
+
+	logoutAll bool
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the API keys of the providers",
+	Long: `Store the API keys of the providers so they don't have to be in the
+environment. Keys are kept in the OS keyring, or in an encrypted file in
+~/.mcgraph when there is none; set $MCGRAPH_AUTH_STORE to "keyring" or "file"
+to choose. A key given with --api-key comes first, then the provider's
+environment variable, then the stored key.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login <provider>",
+	Short: "Store the API key of a provider",
+	Long: `Store the API key of a provider. The key is asked for without echoing
+it, or read from standard input when it isn't a terminal:
+
+  mcg auth login openai
+  pass show openai | mcg auth login openai`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		llmType, err := llm.ParseLLMType(args[0])
+		if err != nil {
+			return err
+		}
+		if llmType == llm.Fake {
+			return fmt.Errorf("the fake provider needs no API key")
+		}
+		store, err := auth.Open()
+		if err != nil {
+			return err
+		}
+
+		key, err := readAPIKey(fmt.Sprintf("%s API key: ", llmType))
+		if err != nil {
+			return err
+		}
+		if err := store.Set(string(llmType), key); err != nil {
+			return fmt.Errorf("failed to store the key: %w", err)
+		}
+		fmt.Printf("Stored the %s API key in the %s.\n", llmType, store.Name())
+
+		if envVar := llm.GetAPIKeyEnvVar(llmType); os.Getenv(envVar) != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s is set and is used instead of the stored key\n", envVar)
+		}
+		return nil
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which providers have an API key and where it comes from",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := auth.Open()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%-10s %-16s %s\n", "PROVIDER", "KEY", "SOURCE")
+		for _, llmType := range llm.GetAvailableLLMs() {
+			key, source := llm.LookupAPIKey(llmType)
+			if key == "" {
+				fmt.Printf("%-10s %-16s %s\n", llmType, "-", "not configured")
+				continue
+			}
+			if source == llm.KeyFromEnv {
+				source = "$" + llm.GetAPIKeyEnvVar(llmType)
+			}
+			fmt.Printf("%-10s %-16s %s\n", llmType, maskAPIKey(key), source)
+		}
+		fmt.Printf("\nKeys are looked up in --api-key, then the environment, then the %s.\n", store.Name())
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout <provider>... | --all",
+	Short: "Remove stored API keys",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if logoutAll == (len(args) > 0) {
+			return fmt.Errorf("name the providers to log out of, or pass --all")
+		}
+		store, err := auth.Open()
+		if err != nil {
+			return err
+		}
+
+		var llmTypes []llm.LLMType
+		if logoutAll {
+			llmTypes = llm.GetAvailableLLMs()
+		} else {
+			for _, arg := range args {
+				llmType, err := llm.ParseLLMType(arg)
+				if err != nil {
+					return err
+				}
+				llmTypes = append(llmTypes, llmType)
+			}
+		}
+
+		for _, llmType := range llmTypes {
+			err := store.Delete(string(llmType))
+			switch {
+			case errors.Is(err, auth.ErrNotFound):
+				if !logoutAll {
+					fmt.Printf("No %s API key was stored.\n", llmType)
+				}
+			case err != nil:
+				return fmt.Errorf("failed to remove the %s key: %w", llmType, err)
+			default:
+				fmt.Printf("Removed the %s API key from the %s.\n", llmType, store.Name())
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringArrayVar(&apiKeyFlags, "api-key", nil, "API key of a provider as provider=key, used before the environment and the key store")
+	authLogoutCmd.Flags().BoolVar(&logoutAll, "all", false, "Remove the keys of all providers")
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	rootCmd.AddCommand(authCmd)
+}
+
+// setupAPIKeys passes the keys given with --api-key to the providers
+func setupAPIKeys() error {
+	for _, flag := range apiKeyFlags {
+		name, key, ok := strings.Cut(flag, "=")
+		if !ok || key == "" {
+			// Don't echo the value, it may be a bare key
+			return fmt.Errorf("invalid --api-key: use provider=key")
+		}
+		llmType, err := llm.ParseLLMType(name)
+		if err != nil {
+			return fmt.Errorf("invalid --api-key: %w", err)
+		}
+		llm.SetAPIKey(llmType, key)
+	}
+	return nil
+}
+
+// readAPIKey asks for a key on the terminal without echoing it, or reads it
+// from standard input
+func readAPIKey(prompt string) (string, error) {
+	var data []byte
+	var err error
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		data, err = term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the key: %w", err)
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("no key given")
+	}
+	return key, nil
+}
+
+// maskAPIKey shows just enough of a key to tell which one it is
+func maskAPIKey(key string) string {
+	if len(key) < 12 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
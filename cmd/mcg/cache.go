@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+// Response cache settings. The cache is off unless $MCGRAPH_CACHE is set.
+const (
+	CacheEnvVar     = "MCGRAPH_CACHE"
+	CacheSizeEnvVar = "MCGRAPH_CACHE_SIZE"
+)
+
+// Limits of the response cache unless configured otherwise
+const (
+	defaultCacheTTL  = 7 * 24 * time.Hour
+	defaultCacheSize = 50 << 20
+)
+
+var (
+	noCache        bool
+	cacheOlderThan string
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clear the response cache",
+	Long: `Identical requests, with the same provider, model, system prompt,
+messages and generation parameters, are answered from the database instead of
+the provider when $MCGRAPH_CACHE is set: "on" keeps answers for 7 days, an age
+like 24h, 30d or 6mo for that long. $MCGRAPH_CACHE_SIZE bounds the cache, e.g.
+20MB (default 50MB); the least recently used answers go first. --no-cache
+skips the cache for one command.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the size of the response cache and how often it was used",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := dbConn.ResponseCacheStats(context.Background())
+		if err != nil {
+			return err
+		}
+
+		limits, enabled, err := cacheLimits()
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		case !enabled:
+			fmt.Printf("The cache is off, set %s to turn it on.\n", CacheEnvVar)
+		default:
+			fmt.Printf("Answers are kept for %s, up to %s.\n", formatTTL(limits.TTL), formatBytes(limits.MaxBytes))
+		}
+
+		fmt.Printf("Entries: %d\n", stats.Entries)
+		fmt.Printf("Size:    %s\n", formatBytes(stats.Bytes))
+		fmt.Printf("Hits:    %d\n", stats.Hits)
+		if stats.Entries > 0 {
+			fmt.Printf("Oldest:  %s\n", formatTimeAgo(time.Since(stats.Oldest)))
+			fmt.Printf("Newest:  %s\n", formatTimeAgo(time.Since(stats.Newest)))
+		}
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete the cached answers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var olderThan time.Duration
+		if cacheOlderThan != "" {
+			ttl, err := parseTTL(cacheOlderThan)
+			if err != nil {
+				return fmt.Errorf("invalid --older-than: %w", err)
+			}
+			olderThan = ttl
+		}
+
+		cleared, err := dbConn.ClearResponseCache(context.Background(), olderThan)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s.\n", plural(cleared, "cached answer"))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Send every request to the provider, bypassing the response cache")
+	cacheClearCmd.Flags().StringVar(&cacheOlderThan, "older-than", "", "Only delete answers older than this, e.g. 24h or 30d")
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// setupCache answers identical requests from the database when $MCGRAPH_CACHE is set
+func setupCache() {
+	if noCache {
+		return
+	}
+	limits, enabled, err := cacheLimits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, the response cache is off\n", err)
+		return
+	}
+	if enabled {
+		llm.SetResponseCache(&responseCache{db: dbConn, limits: limits})
+	}
+}
+
+// cacheLimits reads the cache settings from the environment
+func cacheLimits() (db.CacheLimits, bool, error) {
+	limits := db.CacheLimits{TTL: defaultCacheTTL, MaxBytes: defaultCacheSize}
+	setting := os.Getenv(CacheEnvVar)
+	switch strings.ToLower(setting) {
+	case "", "off", "0", "false":
+		return limits, false, nil
+	case "on", "1", "true":
+	default:
+		ttl, err := parseTTL(setting)
+		if err != nil {
+			return limits, false, fmt.Errorf("invalid %s: %w", CacheEnvVar, err)
+		}
+		limits.TTL = ttl
+	}
+
+	if size := os.Getenv(CacheSizeEnvVar); size != "" {
+		maxBytes, err := parseSize(size)
+		if err != nil {
+			return limits, false, fmt.Errorf("invalid %s: %w", CacheSizeEnvVar, err)
+		}
+		limits.MaxBytes = maxBytes
+	}
+	return limits, true, nil
+}
+
+// parseTTL parses an age like 36h, 30d or 6mo as a duration
+func parseTTL(value string) (time.Duration, error) {
+	now := time.Now()
+	since, err := parseAge(value, now)
+	if err != nil {
+		return 0, err
+	}
+	return now.Sub(since), nil
+}
+
+// formatTTL formats a cache lifetime in days when it is a whole number of them
+func formatTTL(ttl time.Duration) string {
+	if ttl%(24*time.Hour) == 0 {
+		return plural(int(ttl/(24*time.Hour)), "day")
+	}
+	return ttl.String()
+}
+
+// parseSize parses a size like 500KB, 20MB or 1GB
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	for _, unit := range units {
+		if count, ok := strings.CutSuffix(upper, unit.suffix); ok {
+			n, err := strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+			if err != nil || n < 0 {
+				break
+			}
+			return n * unit.scale, nil
+		}
+	}
+	return 0, fmt.Errorf("%q isn't a size like 500KB, 20MB or 1GB", value)
+}
+
+// responseCache keeps the answers of the providers in the database. The cache
+// is best effort: when it can't be read or written, requests go to the provider.
+type responseCache struct {
+	db     *db.DB
+	limits db.CacheLimits
+}
+
+// Get returns the answer stored under key, if it is still fresh
+func (c *responseCache) Get(key string) (llm.Response, bool) {
+	cached, ok, err := c.db.GetCachedResponse(context.Background(), key, c.limits.TTL)
+	if err != nil || !ok {
+		return llm.Response{}, false
+	}
+	return llm.Response{
+		Content: cached.Content,
+		Model:   cached.Model,
+		Usage:   llm.Usage{PromptTokens: cached.PromptTokens, CompletionTokens: cached.CompletionTokens},
+	}, true
+}
+
+// Put stores the answer of backend under key
+func (c *responseCache) Put(key string, backend llm.Backend, response llm.Response) {
+	c.db.PutCachedResponse(context.Background(), key, db.CachedResponse{
+		Provider:         string(backend.LLM),
+		Model:            response.Model,
+		Content:          response.Content,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+	}, c.limits)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,54 +11,49 @@ import (
 	"github.com/hawk/mcgraph/internal/llm"
 	"github.com/hawk/mcgraph/internal/tui"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-var continueID string
+var (
+	continueID  string
+	chatProfile string
+	chatPlain   bool
+)
 
 func init() {
 	chatCmd.Flags().StringVarP(&continueID, "continue", "c", "", "Continue a previous conversation by ID")
+	chatCmd.Flags().StringVarP(&chatProfile, "profile", "p", "", "System prompt profile to use (defaults to the conversation's profile)")
+	chatCmd.Flags().BoolVar(&chatPlain, "plain", false, "Chat line by line instead of taking over the screen (the default when stdout isn't a terminal)")
+	addProjectFlags(chatCmd)
 	rootCmd.AddCommand(chatCmd)
 }
 
 var chatCmd = &cobra.Command{
 	Use:   "chat",
 	Short: "Start an interactive chat session with McGraph",
-	Long:  `Start an interactive TUI chat session with McGraph.`,
+	Long:  `Start an interactive TUI chat session with McGraph.
+
+With --plain, or when stdout isn't a terminal, the chat is line based instead:
+questions are read a line at a time and answers are printed as they stream in.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 		
 		// If continueID is provided, load the conversation
 		var loadedMessages []tui.Message
+		var storedMessages []tui.StoredMessage
+		var activeMessageID uuid.NullUUID
+		var summary string
+		var summarizedCount int
 		var conversationID uuid.UUID
+		var profileName string
+		backend := llm.CurrentBackend()
 		var err error
 		
 		if continueID != "" {
-			// Check if this is a full UUID or a shortened one
-			if len(continueID) == 36 {
-				// This is a full UUID
-				conversationID, err = uuid.Parse(continueID)
-				if err != nil {
-					return fmt.Errorf("invalid conversation ID: %w", err)
-				}
-			} else {
-				// Try to find conversation with the partial ID
-				conversations, err := dbConn.ListConversations(ctx)
-				if err != nil {
-					return fmt.Errorf("error listing conversations: %w", err)
-				}
-				
-				found := false
-				for _, conv := range conversations {
-					if strings.HasPrefix(conv.ID.String(), continueID) {
-						conversationID = conv.ID
-						found = true
-						break
-					}
-				}
-				
-				if !found {
-					return fmt.Errorf("no conversation found with ID starting with: %s", continueID)
-				}
+			// Find the conversation by its full or shortened ID
+			conversationID, err = resolveConversationID(continueID)
+			if err != nil {
+				return err
 			}
 			
 			// Load the conversation
@@ -68,18 +62,21 @@ var chatCmd = &cobra.Command{
 				return fmt.Errorf("error loading conversation: %w", err)
 			}
 			
-			// Set the current LLM to the one used in the conversation
-			err = llm.SetCurrentLLM(string(conversation.Model))
-			if err != nil {
+			// Keep using the conversation's profile unless another one was requested
+			profileName = conversation.Profile
+			
+			// Continue with the backend used in the conversation, for this session only
+			if conversationBackend, err := llm.ParseBackend(conversation.Model); err == nil {
+				backend = conversationBackend
+			} else {
 				// If the LLM is not available, continue with the current one but warn the user
 				fmt.Fprintf(os.Stderr, "Warning: This conversation used %s but it's not available. Using %s instead.\n",
-					conversation.Model, llm.GetCurrentLLM())
+					conversation.Model, backend)
 			}
 			
 			// Add welcome message first
-			currentLLM := llm.GetCurrentLLM()
 			welcomeMsg := fmt.Sprintf("Welcome back to McGraph Chat! Current LLM: %s\nContinuing conversation: %s\nType your questions and press Enter to submit. Type Ctrl+C to quit.", 
-				currentLLM, conversation.Title)
+				backend.Resolved(), conversation.Title)
 			
 			loadedMessages = append(loadedMessages, tui.Message{
 				Content:       welcomeMsg,
@@ -89,26 +86,52 @@ var chatCmd = &cobra.Command{
 				Time:          time.Now(),
 			})
 			
-			// Then add all the conversation messages
-			for _, msg := range conversation.Messages {
-				loadedMessages = append(loadedMessages, tui.Message{
-					Content:       msg.Content,
-					VisibleContent: msg.Content,
-					IsUser:        msg.Role == "user",
-					IsComplete:    true,
-					Time:          msg.CreatedAt, // Use the original timestamp
-				})
+			// Then load all the conversation messages; the chat shows the active branch
+			messages, err := dbConn.GetMessages(ctx, conversationID)
+			if err != nil {
+				return fmt.Errorf("error loading messages: %w", err)
+			}
+			for _, msg := range messages {
+				storedMessages = append(storedMessages, tui.StoredMessageFromDB(msg))
 			}
+			activeMessageID = conversation.ActiveMessageID
+			
+			// Reuse the running summary of the turns that no longer fit the context window
+			summary = conversation.Summary
+			summarizedCount = conversation.SummaryMessageCount
 			
 			fmt.Printf("Continuing conversation: %s\n", conversation.Title)
-		} else {
+		}
+		
+		if chatProfile != "" {
+			profileName = chatProfile
+		}
+		profile, err := llm.LoadProfile(profileName)
+		if err != nil {
+			if chatProfile != "" {
+				return err
+			}
+			// The conversation's profile may have been removed since
+			fmt.Fprintf(os.Stderr, "Warning: %v. Using the default profile instead.\n", err)
+			profile = llm.DefaultProfile()
+		}
+		
+		// Add the project context when run inside a git repository
+		proj := currentProject()
+		
+		if continueID == "" {
 			// Create a new conversation
 			model := string(llm.GetCurrentLLM())
-			conversation, err := dbConn.CreateConversation(ctx, "New Conversation", model)
+			conversation, err := dbConn.CreateConversation(ctx, "New Conversation", model, profile.Name, projectRoot(proj))
 			if err != nil {
 				return fmt.Errorf("error creating conversation: %w", err)
 			}
 			conversationID = conversation.ID
+		} else if chatProfile != "" {
+			// Record the newly selected profile on the continued conversation
+			if err := dbConn.UpdateConversationProfile(ctx, conversationID, profile.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to save profile: %v\n", err)
+			}
 		}
 		
 		// Set extension manager for the TUI to use (needed for extension commands)
@@ -116,6 +139,22 @@ var chatCmd = &cobra.Command{
 		
 		// Create a DB adapter and start the interactive TUI chat
 		dbAdapter := db.NewAdapter(dbConn)
-		return tui.StartChat(dbAdapter, conversationID, loadedMessages)
+		return tui.StartChat(dbAdapter, conversationID, loadedMessages, tui.ChatOptions{
+			Backend:       backend,
+			Profile:       profile,
+			Project:       proj,
+			SystemContext: projectContext(proj),
+			Messages:      storedMessages,
+			ActiveMessageID: activeMessageID,
+			Summary:       summary,
+			SummarizedCount: summarizedCount,
+			Plain:         usePlainChat(chatPlain),
+		})
 	},
-}
\ No newline at end of file
+}
+
+// usePlainChat reports whether to chat line by line: when asked to, or when
+// stdout isn't a terminal the full-screen chat could take over
+func usePlainChat(requested bool) bool {
+	return requested || !term.IsTerminal(int(os.Stdout.Fd()))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/project"
+)
+
+// compareAnswers asks several LLMs the same question, prints their answers as
+// labeled sections and lets the user keep one of them in the history
+func compareAnswers(question string, attachments []llm.Attachment, names []string, profile llm.Profile, proj *project.Project) error {
+	llmTypes, err := llm.ParseLLMList(names)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Asking %s...\n\n", joinLLMs(llmTypes))
+	messages := []llm.Message{{Role: llm.RoleUser, Content: question, Attachments: attachments}}
+	results := llm.Compare(llmTypes, messages, profile.WithSystemContext(projectContext(proj)))
+
+	var answered []int
+	for i, result := range results {
+		fmt.Printf("=== [%d] %s ===\n", i+1, result.Header())
+		if result.Err != nil {
+			fmt.Printf("Error: %v\n", result.Err)
+		} else {
+			fmt.Println(result.Response.Content)
+			answered = append(answered, i)
+		}
+		fmt.Println()
+	}
+
+	if noSave || len(answered) == 0 {
+		return nil
+	}
+
+	// Only the answer the user picks becomes part of the conversation
+	fmt.Printf("Keep which answer in the history [1-%d, Enter for none]? ", len(results))
+	var choice string
+	fmt.Scanln(&choice)
+	if choice == "" {
+		fmt.Println("Nothing saved.")
+		return nil
+	}
+	index, err := strconv.Atoi(choice)
+	if err != nil || index < 1 || index > len(results) || results[index-1].Err != nil {
+		return fmt.Errorf("invalid choice: %s", choice)
+	}
+	kept := results[index-1]
+
+	ctx := context.Background()
+	conversation, err := dbConn.CreateConversation(ctx, question, string(kept.LLM), profile.Name, projectRoot(proj))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save conversation: %v\n", err)
+		return nil
+	}
+
+	saveQuestion(ctx, conversation.ID, question, attachments)
+	answeredBy := llm.Backend{LLM: kept.LLM, Model: kept.Response.Model}
+	saveAnswer(ctx, conversation.ID, answeredBy, kept.Response)
+	if _, err := titleConversation(ctx, conversation.ID, answeredBy, question, kept.Response.Content); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to generate title: %v\n", err)
+	}
+
+	fmt.Printf("Kept the answer from %s. Conversation saved with ID: %s\n", kept.LLM, conversation.ID.String()[:8])
+	return nil
+}
+
+// joinLLMs formats LLM names as a comma-separated list
+func joinLLMs(llmTypes []llm.LLMType) string {
+	names := make([]string, len(llmTypes))
+	for i, llmType := range llmTypes {
+		names[i] = string(llmType)
+	}
+	return strings.Join(names, ", ")
+}
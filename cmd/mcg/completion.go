@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/auth"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+// maxIDCompletions is the number of conversations offered when completing an ID
+const maxIDCompletions = 50
+
+func init() {
+	// Dynamic completions for arguments and flags
+	historyShowCmd.ValidArgsFunction = completeConversationIDs
+	historyDeleteCmd.ValidArgsFunction = completeConversationIDList
+	historyRenameCmd.ValidArgsFunction = completeConversationIDs
+	historyRetitleCmd.ValidArgsFunction = completeConversationIDs
+	historyTagCmd.ValidArgsFunction = completeConversationIDs
+	historyCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	historyDeleteCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	historyPruneCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	listCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	chatCmd.RegisterFlagCompletionFunc("continue", completeConversationIDs)
+	pickCmd.ValidArgsFunction = completeLLMNames
+	authLoginCmd.ValidArgsFunction = completeLLMNames
+	authLogoutCmd.ValidArgsFunction = completeStoredProviders
+	askCmd.RegisterFlagCompletionFunc("profile", completeProfileNames)
+	askCmd.RegisterFlagCompletionFunc("compare", completeLLMList)
+	chatCmd.RegisterFlagCompletionFunc("profile", completeProfileNames)
+	extRunCmd.ValidArgsFunction = completeExtensionArgs
+}
+
+// isCompletionRequest reports whether the binary was invoked by a shell completion script
+func isCompletionRequest() bool {
+	return len(os.Args) > 1 &&
+		(os.Args[1] == cobra.ShellCompRequestCmd || os.Args[1] == cobra.ShellCompNoDescRequestCmd)
+}
+
+// connectForCompletion connects to the database quietly, since completion
+// runs without the usual database setup
+func connectForCompletion() error {
+	if dbConn != nil {
+		return nil
+	}
+	config := db.ConfigFromEnv()
+	if msg := db.ValidateConfig(config); msg != "" {
+		return fmt.Errorf("database is not configured")
+	}
+	if err := connectDB(context.Background(), config); err != nil {
+		cobra.CompErrorln(err.Error())
+		return err
+	}
+	return nil
+}
+
+// completeTags completes the tags in use, most used first
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	tags, err := dbConn.ListTags(context.Background())
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for name := range tags {
+		if strings.HasPrefix(name, db.NormalizeTag(toComplete)) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tags[names[i]] != tags[names[j]] {
+			return tags[names[i]] > tags[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConversationIDs completes short conversation IDs from the store
+func completeConversationIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeConversationIDList(cmd, args, toComplete)
+}
+
+// completeConversationIDList completes short conversation IDs for commands taking several
+func completeConversationIDList(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := connectForCompletion(); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// Offer the most recent conversations until a prefix narrows them down
+	ctx := context.Background()
+	var conversations []db.Conversation
+	var err error
+	if toComplete == "" {
+		conversations, err = dbConn.FindConversations(ctx, db.ConversationFilter{Limit: maxIDCompletions})
+	} else {
+		conversations, err = dbConn.FindConversationsByIDPrefix(ctx, toComplete, maxIDCompletions)
+	}
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, conv := range conversations {
+		shortID := conv.ID.String()[:8]
+		if strings.HasPrefix(shortID, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s (%s)", shortID, conv.Title, conv.Model))
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeLLMNames completes the names of the available LLM providers
+func completeLLMNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, llmType := range llm.GetAvailableLLMs() {
+		if strings.HasPrefix(string(llmType), toComplete) {
+			completions = append(completions, string(llmType))
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeStoredProviders completes the providers with a stored key not named yet
+func completeStoredProviders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	store, err := auth.Open()
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, llmType := range llm.GetAvailableLLMs() {
+		name := string(llmType)
+		if !strings.HasPrefix(name, toComplete) || slices.Contains(args, name) {
+			continue
+		}
+		if _, err := store.Get(name); err == nil {
+			completions = append(completions, name)
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeLLMList completes the last name of a comma-separated list of LLMs
+func completeLLMList(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	done := ""
+	last := toComplete
+	if idx := strings.LastIndex(toComplete, ","); idx >= 0 {
+		done, last = toComplete[:idx+1], toComplete[idx+1:]
+	}
+
+	var completions []string
+	for _, llmType := range llm.GetAvailableLLMs() {
+		if strings.HasPrefix(string(llmType), last) && !strings.Contains(","+done, ","+string(llmType)+",") {
+			completions = append(completions, done+string(llmType))
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeExtensionArgs completes extension names, their commands and
+// the command arguments declared by the extension
+func completeExtensionArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !extManager.IsEnabled() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	switch len(args) {
+	case 0:
+		for _, ext := range extManager.ListExtensions() {
+			completions = append(completions, fmt.Sprintf("%s\t%s", ext.Name(), ext.Description()))
+		}
+	case 1:
+		for name, command := range extManager.GetCommands(args[0]) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", name, command.Description()))
+		}
+	default:
+		schema := extManager.GetArgs(args[0], args[1])
+		index := len(args) - 2
+		if index >= len(schema) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		switch schema[index].Kind {
+		case extensions.ArgPath:
+			return nil, cobra.ShellCompDirectiveDefault
+		case extensions.ArgDir:
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		case extensions.ArgEnum:
+			completions = append(completions, schema[index].Choices...)
+		}
+	}
+
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
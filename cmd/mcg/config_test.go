@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+func TestCacheLimits(t *testing.T) {
+	tests := []struct {
+		setting, size string
+		enabled       bool
+		ttl           time.Duration
+		maxBytes      int64
+		wantErr       bool
+	}{
+		{setting: "", enabled: false, ttl: defaultCacheTTL, maxBytes: defaultCacheSize},
+		{setting: "on", enabled: true, ttl: defaultCacheTTL, maxBytes: defaultCacheSize},
+		{setting: "36h", size: "20MB", enabled: true, ttl: 36 * time.Hour, maxBytes: 20 << 20},
+		{setting: "on", size: "500kb", enabled: true, ttl: defaultCacheTTL, maxBytes: 500 << 10},
+		{setting: "soon", wantErr: true},
+		{setting: "on", size: "12", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Setenv(CacheEnvVar, tc.setting)
+		t.Setenv(CacheSizeEnvVar, tc.size)
+		limits, enabled, err := cacheLimits()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("cacheLimits(%q, %q) succeeded, want an error", tc.setting, tc.size)
+			}
+			continue
+		}
+		if err != nil || enabled != tc.enabled || limits.TTL != tc.ttl || limits.MaxBytes != tc.maxBytes {
+			t.Errorf("cacheLimits(%q, %q) = %+v, %v, %v", tc.setting, tc.size, limits, enabled, err)
+		}
+	}
+}
+
+func TestSetupAPIKeys(t *testing.T) {
+	defer func() { apiKeyFlags = nil }()
+
+	apiKeyFlags = []string{"Claude=flag-key"}
+	t.Setenv(llm.GetAPIKeyEnvVar(llm.Claude), "env-key")
+	if err := setupAPIKeys(); err != nil {
+		t.Fatalf("setupAPIKeys: %v", err)
+	}
+	if key, source := llm.LookupAPIKey(llm.Claude); key != "flag-key" || source != llm.KeyFromFlag {
+		t.Errorf("LookupAPIKey(claude) = %q from %q, want the flag to win over the environment", key, source)
+	}
+
+	for _, flag := range []string{"sk-bare-key", "claude=", "nobody=key"} {
+		apiKeyFlags = []string{flag}
+		if err := setupAPIKeys(); err == nil {
+			t.Errorf("setupAPIKeys(%q) succeeded, want an error", flag)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	keygenKeyring bool
+	keygenFile    string
+	rekeyFrom     string
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the conversation database",
+	Long: `Manage how conversations are stored. Messages, attachments, summaries and
+titles are encrypted when $MCGRAPH_ENCRYPTION_KEY tells where the key is:
+"keyring" for the OS keyring, "passphrase" for a key derived from
+$MCGRAPH_PASSPHRASE (asked for when unset) or "file:<path>" for a key file.`,
+}
+
+var dbKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create a random encryption key in the OS keyring or a file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var source db.KeySource
+		switch {
+		case keygenKeyring && keygenFile == "":
+			source = db.KeySource{Kind: "keyring"}
+		case keygenFile != "" && !keygenKeyring:
+			parsed, err := db.ParseKeySource("file:" + keygenFile)
+			if err != nil {
+				return err
+			}
+			source = parsed
+		default:
+			return fmt.Errorf("pick where to store the key with either --keyring or --file <path>")
+		}
+
+		if err := db.GenerateKey(source); err != nil {
+			return fmt.Errorf("failed to create the key: %w", err)
+		}
+		fmt.Printf("Created an encryption key in %s.\n", source)
+		fmt.Printf("Set %s=%s and run 'mcg db encrypt' to encrypt the saved messages.\n", db.KeyEnvVar, source)
+		fmt.Println("Back the key up: messages encrypted with it can't be read without it.")
+		return nil
+	},
+}
+
+var dbEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the conversations stored in plain text",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, err := configuredCipher()
+		if err != nil {
+			return err
+		}
+		result, err := dbConn.Reencrypt(context.Background(), nil, to)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt the stored content: %w", err)
+		}
+		fmt.Printf("Encrypted %s with key %s.\n", describeCounts(result.Migrated), to.KeyID)
+		printSkipped(result)
+		return nil
+	},
+}
+
+var dbDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Store the content encrypted with the configured key in plain text again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := configuredCipher()
+		if err != nil {
+			return err
+		}
+		result, err := dbConn.Reencrypt(context.Background(), from, nil)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt the stored content: %w", err)
+		}
+		fmt.Printf("Decrypted %s.\n", describeCounts(result.Migrated))
+		fmt.Printf("Unset %s, or new messages will be encrypted again.\n", db.KeyEnvVar)
+		printSkipped(result)
+		return nil
+	},
+}
+
+var dbRekeyCmd = &cobra.Command{
+	Use:   "rekey --from <source>",
+	Short: "Encrypt the stored content again with the configured key",
+	Long: `Decrypt the messages, attachments, summaries and titles encrypted with
+the old key in --from ("keyring", "passphrase" or "file:<path>") and encrypt
+them with the key in $MCGRAPH_ENCRYPTION_KEY. To change a passphrase, run it
+with the new one in $MCGRAPH_PASSPHRASE and --from passphrase; the old one is
+asked for.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, err := configuredCipher()
+		if err != nil {
+			return err
+		}
+		source, err := db.ParseKeySource(rekeyFrom)
+		if err != nil {
+			return err
+		}
+		from, err := loadCipher(source, "Old passphrase: ", false)
+		if err != nil {
+			return err
+		}
+
+		result, err := dbConn.Reencrypt(context.Background(), from, to)
+		if err != nil {
+			return fmt.Errorf("failed to rekey the stored content: %w", err)
+		}
+		fmt.Printf("Moved %s from key %s to key %s.\n", describeCounts(result.Migrated), from.KeyID, to.KeyID)
+		printSkipped(result)
+		return nil
+	},
+}
+
+func init() {
+	dbKeygenCmd.Flags().BoolVar(&keygenKeyring, "keyring", false, "Store the key in the OS keyring")
+	dbKeygenCmd.Flags().StringVar(&keygenFile, "file", "", "Write the key to a new file, readable only by you")
+	dbRekeyCmd.Flags().StringVar(&rekeyFrom, "from", "", "Where the old key is: keyring, passphrase or file:<path>")
+	dbRekeyCmd.MarkFlagRequired("from")
+	dbCmd.AddCommand(dbKeygenCmd)
+	dbCmd.AddCommand(dbEncryptCmd)
+	dbCmd.AddCommand(dbDecryptCmd)
+	dbCmd.AddCommand(dbRekeyCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+// setupEncryption makes the database encrypt messages with the key in
+// $MCGRAPH_ENCRYPTION_KEY, if set
+func setupEncryption() error {
+	spec := os.Getenv(db.KeyEnvVar)
+	if spec == "" {
+		return nil
+	}
+	source, err := db.ParseKeySource(spec)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", db.KeyEnvVar, err)
+	}
+	c, err := loadCipher(source, "Passphrase: ", true)
+	if err != nil {
+		return err
+	}
+	dbConn.SetCipher(c)
+	return nil
+}
+
+// configuredCipher returns the cipher set up from $MCGRAPH_ENCRYPTION_KEY
+func configuredCipher() (*db.Cipher, error) {
+	if dbConn.Cipher() == nil {
+		return nil, fmt.Errorf("no encryption key configured, set %s (see mcg db --help)", db.KeyEnvVar)
+	}
+	return dbConn.Cipher(), nil
+}
+
+// loadCipher loads the key in source. A passphrase is read from
+// $MCGRAPH_PASSPHRASE when fromEnv is set, otherwise asked for with prompt.
+func loadCipher(source db.KeySource, prompt string, fromEnv bool) (*db.Cipher, error) {
+	passphrase := func() (string, error) {
+		if phrase := os.Getenv(db.PassphraseEnvVar); fromEnv && phrase != "" {
+			return phrase, nil
+		}
+		return readPassphrase(prompt)
+	}
+	key, err := dbConn.LoadKey(context.Background(), source, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the encryption key from %s: %w", source, err)
+	}
+	return db.NewCipher(key)
+}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it
+func readPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%w: set %s or run in a terminal to type the passphrase", db.ErrKeyMissing, db.PassphraseEnvVar)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	phrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the passphrase: %w", err)
+	}
+	return string(phrase), nil
+}
+
+// printSkipped tells about the content a migration left alone
+func printSkipped(result db.ReencryptResult) {
+	if result.Skipped.Total() > 0 {
+		fmt.Printf("Left %s encrypted with other keys as they are.\n", describeCounts(result.Skipped))
+	}
+}
+
+// describeCounts lists what a migration went through, e.g. "3 messages and 1 summary"
+func describeCounts(counts db.ReencryptCounts) string {
+	parts := []string{plural(counts.Messages, "message")}
+	if counts.Attachments > 0 {
+		parts = append(parts, plural(counts.Attachments, "attachment"))
+	}
+	if counts.Summaries == 1 {
+		parts = append(parts, "1 summary")
+	} else if counts.Summaries > 1 {
+		parts = append(parts, fmt.Sprintf("%d summaries", counts.Summaries))
+	}
+	if counts.Titles > 0 {
+		parts = append(parts, plural(counts.Titles, "title"))
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
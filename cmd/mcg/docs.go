@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func init() {
+	docsCmd.AddCommand(docsManCmd)
+	rootCmd.AddCommand(docsCmd)
+}
+
+var docsCmd = &cobra.Command{
+	Use:    "docs",
+	Short:  "Generate documentation for mcg",
+	Long:   `Generate documentation for mcg from its command definitions.`,
+	Hidden: true,
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man [dir]",
+	Short: "Generate manpages",
+	Long:  `Generate a manpage for every mcg command into the given directory.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		
+		header := &doc.GenManHeader{
+			Title:   "MCG",
+			Section: "1",
+			Source:  "mcgraph " + version,
+			Manual:  "mcgraph Manual",
+		}
+		
+		// Keep the generated pages reproducible for packaging
+		rootCmd.DisableAutoGenTag = true
+		
+		if err := doc.GenManTree(rootCmd, header, dir); err != nil {
+			return fmt.Errorf("failed to generate manpages: %w", err)
+		}
+		
+		fmt.Printf("Manpages written to %s\n", dir)
+		return nil
+	},
+}
@@ -12,6 +12,7 @@ func init() {
 	extCmd.AddCommand(enableCmd)
 	extCmd.AddCommand(disableCmd)
 	extCmd.AddCommand(listExtCmd)
+	extCmd.AddCommand(extRunCmd)
 	
 	rootCmd.AddCommand(extCmd)
 }
@@ -96,6 +97,22 @@ var listExtCmd = &cobra.Command{
 	},
 }
 
+var extRunCmd = &cobra.Command{
+	Use:   "run [extension] [command] [args...]",
+	Short: "Run an extension command",
+	Long:  `Run an extension command outside of a chat session, e.g. mcg ext run system ls ./src`,
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, err := extManager.ExecuteCommand(args[0], args[1], args[2:])
+		if err != nil {
+			return err
+		}
+		
+		fmt.Println(output)
+		return nil
+	},
+}
+
 // listExtensions lists all installed extensions
 func listExtensions() {
 	if !extManager.IsEnabled() {
@@ -5,13 +5,23 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"text/tabwriter"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/project"
 	"github.com/spf13/cobra"
 )
 
+var historyHere bool
+var historyTree bool
+var historyRetitleAll bool
+var historyOpts listOptions
+
+// treePreviewLength is the length messages are cut to in the tree view
+const treePreviewLength = 72
+
 var historyCmd = &cobra.Command{
 	Use:     "history",
 	Aliases: []string{"hist"},
@@ -28,103 +38,180 @@ var historyShowCmd = &cobra.Command{
 	Short: "Show a specific conversation",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		partialID := args[0]
-		
-		// Check if this is a full UUID or a shortened one
-		if len(partialID) == 36 {
-			id, err := uuid.Parse(partialID)
-			if err != nil {
-				return fmt.Errorf("invalid conversation ID: %w", err)
-			}
-			return showConversation(id)
-		} else {
-			// Try to find conversation with the partial ID
-			ctx := context.Background()
-			conversations, err := dbConn.ListConversations(ctx)
-			if err != nil {
-				return fmt.Errorf("error listing conversations: %w", err)
-			}
-			
-			for _, conv := range conversations {
-				if strings.HasPrefix(conv.ID.String(), partialID) {
-					return showConversation(conv.ID)
-				}
-			}
-			
-			return fmt.Errorf("no conversation found with ID starting with: %s", partialID)
+		id, err := resolveConversationID(args[0])
+		if err != nil {
+			return err
 		}
+		return showConversation(id)
 	},
 }
 
 var historyDeleteCmd = &cobra.Command{
-	Use:   "delete [id]",
-	Short: "Delete a conversation",
-	Args:  cobra.ExactArgs(1),
+	Use:   "delete [id]...",
+	Short: "Delete conversations",
+	Long: `Delete the conversations with the given IDs, or the ones matching the
+flags, e.g. mcg history delete --model deepseek --older-than 30d. Pinned
+conversations are only deleted by ID. Pass --yes to skip the confirmation.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		partialID := args[0]
+		if len(args) > 0 {
+			return deleteConversationsByID(args, deleteOpts)
+		}
+		if !deleteOpts.hasFilters() {
+			return fmt.Errorf("tell which conversations to delete by ID or with --older-than, --model, --tag or --archived")
+		}
+		filter, err := deleteOpts.filter()
+		if err != nil {
+			return err
+		}
+		return deleteConversations(filter, deleteOpts)
+	},
+}
+
+var historyRenameCmd = &cobra.Command{
+	Use:   "rename [id] [title]",
+	Short: "Rename a conversation",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := resolveConversationID(args[0])
+		if err != nil {
+			return err
+		}
 		
-		// Check if this is a full UUID or a shortened one
-		if len(partialID) == 36 {
-			id, err := uuid.Parse(partialID)
-			if err != nil {
-				return fmt.Errorf("invalid conversation ID: %w", err)
-			}
-			return deleteConversation(id)
-		} else {
-			// Try to find conversation with the partial ID
-			ctx := context.Background()
+		title := strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+		if title == "" {
+			return fmt.Errorf("the title can't be empty")
+		}
+		if err := dbConn.UpdateConversationTitle(context.Background(), id, title); err != nil {
+			return fmt.Errorf("error renaming conversation: %w", err)
+		}
+		fmt.Printf("Renamed %s to \"%s\"\n", id.String()[:8], title)
+		return nil
+	},
+}
+
+var historyRetitleCmd = &cobra.Command{
+	Use:   "retitle [id]",
+	Short: "Let the LLM title a conversation again",
+	Long: `Ask the LLM for a new title based on the first question and answer of a
+conversation. Use --all to retitle every saved conversation. The title is
+written by the model in $MCGRAPH_TITLE_MODEL if set, otherwise the current LLM.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		
+		var ids []uuid.UUID
+		switch {
+		case historyRetitleAll && len(args) > 0:
+			return fmt.Errorf("give either a conversation ID or --all, not both")
+		case historyRetitleAll:
 			conversations, err := dbConn.ListConversations(ctx)
 			if err != nil {
 				return fmt.Errorf("error listing conversations: %w", err)
 			}
-			
 			for _, conv := range conversations {
-				if strings.HasPrefix(conv.ID.String(), partialID) {
-					return deleteConversation(conv.ID)
-				}
+				ids = append(ids, conv.ID)
 			}
-			
-			return fmt.Errorf("no conversation found with ID starting with: %s", partialID)
+		case len(args) == 1:
+			id, err := resolveConversationID(args[0])
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		default:
+			return fmt.Errorf("give a conversation ID or --all")
+		}
+		
+		backend := llm.TitleBackend(llm.CurrentBackend())
+		failed := 0
+		for _, id := range ids {
+			if err := retitleConversation(ctx, id, backend); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", id.String()[:8], err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to retitle %d of %d conversations", failed, len(ids))
 		}
+		return nil
 	},
 }
 
 func init() {
+	historyCmd.Flags().BoolVar(&historyHere, "here", false, "Only list conversations from the current git repository")
+	addListFlags(historyCmd, &historyOpts)
+	historyShowCmd.Flags().BoolVar(&historyTree, "tree", false, "Show every branch of the conversation")
 	rootCmd.AddCommand(historyCmd)
 	historyCmd.AddCommand(historyShowCmd)
 	historyCmd.AddCommand(historyDeleteCmd)
+	historyRetitleCmd.Flags().BoolVar(&historyRetitleAll, "all", false, "Retitle every saved conversation")
+	historyCmd.AddCommand(historyRenameCmd)
+	historyCmd.AddCommand(historyRetitleCmd)
+	historyTagCmd.Flags().SetInterspersed(false) // -tag removes a tag, it isn't a flag
+	historyCmd.AddCommand(historyTagCmd)
+	historyCmd.AddCommand(newFlagCommand("pin", "Pin a conversation to the top of the listings", "pinned", setPinned(true)))
+	historyCmd.AddCommand(newFlagCommand("unpin", "Unpin a conversation", "unpinned", setPinned(false)))
+	historyCmd.AddCommand(newFlagCommand("archive", "Hide a conversation from the default listings", "archived", setArchived(true)))
+	historyCmd.AddCommand(newFlagCommand("unarchive", "Bring an archived conversation back to the listings", "unarchived", setArchived(false)))
 }
 
-// listConversations displays all saved conversations
-func listConversations() {
-	ctx := context.Background()
-	conversations, err := dbConn.ListConversations(ctx)
+// resolveConversationID finds the conversation with a full ID or an ID prefix,
+// failing with the candidates when the prefix is ambiguous
+func resolveConversationID(partialID string) (uuid.UUID, error) {
+	return dbConn.ResolveConversationID(context.Background(), partialID)
+}
+
+// titleConversation lets the LLM title a conversation after its first
+// exchange, falling back to a title made from the first question
+func titleConversation(ctx context.Context, id uuid.UUID, backend llm.Backend, question, answer string) (string, error) {
+	title, err := llm.GenerateTitle(llm.TitleBackend(backend), question, answer)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing conversations: %v\n", err)
-		return
+		return dbConn.GenerateTitle(ctx, id)
 	}
-
-	if len(conversations) == 0 {
-		fmt.Println("No saved conversations found.")
-		return
+	if err := dbConn.UpdateConversationTitle(ctx, id, title); err != nil {
+		return "", err
 	}
+	return title, nil
+}
 
-	// Create a tabwriter for nicely formatted output
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tTitle\tModel\tLast Updated")
-	fmt.Fprintln(w, "--\t-----\t-----\t------------")
-
-	for _, conv := range conversations {
-		// Format the ID to be shorter
-		shortID := conv.ID.String()[:8]
-		// Format the time
-		timeAgo := timeAgo(time.Since(conv.UpdatedAt))
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", shortID, conv.Title, conv.Model, timeAgo)
+// retitleConversation replaces the title of a saved conversation with one
+// written by backend. The old title is kept if the model fails.
+func retitleConversation(ctx context.Context, id uuid.UUID, backend llm.Backend) error {
+	conversation, err := dbConn.GetConversation(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving conversation: %w", err)
+	}
+	question, answer := db.FirstExchange(conversation.Messages)
+	if question == "" {
+		return nil // Nothing to title yet
+	}
+	
+	title, err := llm.GenerateTitle(backend, question, answer)
+	if err != nil {
+		return fmt.Errorf("failed to generate title: %w", err)
+	}
+	if err := dbConn.UpdateConversationTitle(ctx, id, title); err != nil {
+		return fmt.Errorf("error renaming conversation: %w", err)
 	}
+	fmt.Printf("%s  %s -> %s\n", id.String()[:8], conversation.Title, title)
+	return nil
+}
 
-	w.Flush()
-	fmt.Println("\nUse 'mcg history show <id>' to view a conversation")
-	fmt.Println("Use 'mcg chat --continue <id>' to continue a conversation")
+// listConversations displays the saved conversations matching the flags
+func listConversations() {
+	filter, err := historyOpts.filter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	if historyHere {
+		proj, detectErr := project.DetectCurrent()
+		if detectErr != nil || proj == nil {
+			fmt.Fprintln(os.Stderr, "Not inside a git repository.")
+			return
+		}
+		filter.RepoPath = proj.Root
+	}
+	findAndPrintConversations(filter)
 }
 
 // showConversation displays a specific conversation
@@ -137,14 +224,29 @@ func showConversation(id uuid.UUID) error {
 
 	fmt.Printf("Title: %s\n", conversation.Title)
 	fmt.Printf("Model: %s\n", conversation.Model)
+	fmt.Printf("Profile: %s\n", conversation.Profile)
+	if conversation.RepoPath != "" {
+		fmt.Printf("Project: %s\n", conversation.RepoPath)
+	}
 	fmt.Printf("Created: %s\n", conversation.CreatedAt.Format(time.RFC1123))
 	fmt.Printf("Updated: %s\n\n", conversation.UpdatedAt.Format(time.RFC1123))
 
+	if historyTree {
+		return showConversationTree(conversation)
+	}
+
 	for _, msg := range conversation.Messages {
 		// Format role in uppercase for clarity
 		role := msg.Role
 		if role == "user" {
 			fmt.Printf("USER: %s\n\n", msg.Content)
+			for _, attachment := range msg.Attachments {
+				fmt.Printf("  Attached: %s (%s, %d bytes)\n\n", attachment.Name, attachment.MediaType, attachment.Size)
+			}
+		} else if role == "assistant" && msg.Cached {
+			fmt.Printf("ASSISTANT (%s, cached): %s\n\n", msg.Model, msg.Content)
+		} else if role == "assistant" && msg.Model != "" {
+			fmt.Printf("ASSISTANT (%s): %s\n\n", msg.Model, msg.Content)
 		} else if role == "assistant" {
 			fmt.Printf("ASSISTANT: %s\n\n", msg.Content)
 		} else {
@@ -155,50 +257,52 @@ func showConversation(id uuid.UUID) error {
 	return nil
 }
 
-// deleteConversation deletes a specific conversation
-func deleteConversation(id uuid.UUID) error {
-	ctx := context.Background()
-	
-	// First get the conversation to show what we're deleting
-	conversation, err := dbConn.GetConversation(ctx, id)
+// showConversationTree prints every branch of a conversation with one line per
+// message. Messages on the active branch are marked with a '*'.
+func showConversationTree(conversation db.Conversation) error {
+	messages, err := dbConn.GetMessages(context.Background(), conversation.ID)
 	if err != nil {
-		return fmt.Errorf("error retrieving conversation: %w", err)
+		return fmt.Errorf("error retrieving messages: %w", err)
 	}
 
-	// Confirm deletion
-	fmt.Printf("Are you sure you want to delete conversation: \"%s\" [y/N]? ", conversation.Title)
-	var confirm string
-	fmt.Scanln(&confirm)
-	
-	if confirm != "y" && confirm != "Y" {
-		fmt.Println("Deletion cancelled.")
-		return nil
+	active := make(map[uuid.UUID]bool)
+	for _, msg := range conversation.Messages {
+		active[msg.ID] = true
 	}
 
-	// Delete the conversation
-	err = dbConn.DeleteConversation(ctx, id)
-	if err != nil {
-		return fmt.Errorf("error deleting conversation: %w", err)
+	printMessageTree(db.Children(messages), uuid.Nil, "", active)
+	return nil
+}
+
+// printMessageTree prints the replies to parent. A run of single replies stays
+// at the same indentation, only branch points indent their alternatives.
+func printMessageTree(children map[uuid.UUID][]db.Message, parent uuid.UUID, prefix string, active map[uuid.UUID]bool) {
+	replies := children[parent]
+	for len(replies) == 1 {
+		fmt.Println(prefix + treeLine(replies[0], active))
+		replies = children[replies[0].ID]
 	}
 
-	fmt.Println("Conversation deleted successfully.")
-	return nil
+	for i, reply := range replies {
+		connector, indent := "├─ ", "│  "
+		if i == len(replies)-1 {
+			connector, indent = "└─ ", "   "
+		}
+		fmt.Printf("%s%s[%d/%d] %s\n", prefix, connector, i+1, len(replies), treeLine(reply, active))
+		printMessageTree(children, reply.ID, prefix+indent, active)
+	}
 }
 
-// timeAgo returns a human-readable string representing how long ago a time was
-func timeAgo(duration time.Duration) string {
-	seconds := int(duration.Seconds())
-	minutes := seconds / 60
-	hours := minutes / 60
-	days := hours / 24
-
-	if days > 0 {
-		return fmt.Sprintf("%dd ago", days)
-	} else if hours > 0 {
-		return fmt.Sprintf("%dh ago", hours)
-	} else if minutes > 0 {
-		return fmt.Sprintf("%dm ago", minutes)
-	} else {
-		return fmt.Sprintf("%ds ago", seconds)
-	}
-}
\ No newline at end of file
+// treeLine formats a message as a single line for the tree view
+func treeLine(msg db.Message, active map[uuid.UUID]bool) string {
+	marker := " "
+	if active[msg.ID] {
+		marker = "*"
+	}
+
+	content := strings.Join(strings.Fields(msg.Content), " ")
+	if len([]rune(content)) > treePreviewLength {
+		content = string([]rune(content)[:treePreviewLength-3]) + "..."
+	}
+	return fmt.Sprintf("%s %s: %s", marker, strings.ToUpper(msg.Role), content)
+}
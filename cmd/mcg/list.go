@@ -4,13 +4,32 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/hawk/mcgraph/internal/db"
 	"github.com/spf13/cobra"
 )
 
+// defaultListLimit is how many conversations are listed per page
+const defaultListLimit = 50
+
+// listOptions holds the flags that narrow down a conversation listing
+type listOptions struct {
+	tag      string
+	archived bool
+	since    string
+	model    string
+	query    string
+	limit    int
+	offset   int
+}
+
+var listOpts listOptions
+
 func init() {
+	addListFlags(listCmd, &listOpts)
 	rootCmd.AddCommand(listCmd)
 }
 
@@ -18,44 +37,149 @@ var listCmd = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"conversations"},
 	Short:   "List all conversations",
-	Long:    `List all saved conversations.`,
+	Long:    `List the saved conversations, pinned ones first. Archived conversations
+are only listed with --archived. Listings are paged with --limit and --offset.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		displayConversationList()
 	},
 }
 
-// displayConversationList displays all saved conversations (separate from history.go's version)
+// addListFlags adds the listing flags to cmd
+func addListFlags(cmd *cobra.Command, opts *listOptions) {
+	cmd.Flags().StringVar(&opts.tag, "tag", "", "Only list conversations with this tag")
+	cmd.Flags().BoolVar(&opts.archived, "archived", false, "List the archived conversations instead")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only list conversations updated since a date (2006-01-02) or age (24h, 7d, 6mo)")
+	cmd.Flags().StringVar(&opts.model, "model", "", "Only list conversations with this provider or model, e.g. claude or openai:gpt-4o")
+	cmd.Flags().StringVarP(&opts.query, "query", "q", "", "Only list conversations whose title contains this text")
+	cmd.Flags().IntVar(&opts.limit, "limit", defaultListLimit, "Maximum number of conversations to list, 0 for all")
+	cmd.Flags().IntVar(&opts.offset, "offset", 0, "Number of conversations to skip")
+}
+
+// filter returns the database filter for the options
+func (opts listOptions) filter() (db.ConversationFilter, error) {
+	if opts.limit < 0 || opts.offset < 0 {
+		return db.ConversationFilter{}, fmt.Errorf("--limit and --offset can't be negative")
+	}
+	filter := db.ConversationFilter{
+		Tag:      opts.tag,
+		Archived: opts.archived,
+		Model:    opts.model,
+		Query:    opts.query,
+		Limit:    opts.limit,
+		Offset:   opts.offset,
+	}
+	if opts.since != "" {
+		since, err := parseSince(opts.since, time.Now())
+		if err != nil {
+			return db.ConversationFilter{}, err
+		}
+		filter.Since = since
+	}
+	return filter, nil
+}
+
+// parseSince parses --since as a date, a date and time, or an age like 7d before now
+func parseSince(value string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if since, err := parseAge(value, now); err == nil {
+		return since, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a date like 2006-01-02 or an age like 24h, 7d or 6mo", value)
+}
+
+// displayConversationList displays the saved conversations matching the flags
 func displayConversationList() {
+	filter, err := listOpts.filter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	findAndPrintConversations(filter)
+}
+
+// findAndPrintConversations prints a page of the conversations matching filter
+func findAndPrintConversations(filter db.ConversationFilter) {
 	ctx := context.Background()
-	conversations, err := dbConn.ListConversations(ctx)
+	conversations, err := dbConn.FindConversations(ctx, filter)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error listing conversations: %v\n", err)
 		return
 	}
 
+	// Only count when the page doesn't tell how many there are
+	total := len(conversations) + filter.Offset
+	if (filter.Limit > 0 && len(conversations) == filter.Limit) || (len(conversations) == 0 && filter.Offset > 0) {
+		total, err = dbConn.CountConversations(ctx, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error counting conversations: %v\n", err)
+			return
+		}
+	}
+	printConversations(conversations, filter, total)
+}
+
+// printConversations prints a table of conversations listed with filter, out
+// of total matching ones
+func printConversations(conversations []db.Conversation, filter db.ConversationFilter, total int) {
 	if len(conversations) == 0 {
-		fmt.Println("No saved conversations found.")
+		switch {
+		case filter.Offset > 0 && total > 0:
+			fmt.Printf("Only %d conversations found, nothing to show past --offset %d.\n", total, filter.Offset)
+		case filter.Tag != "":
+			fmt.Printf("No saved conversations tagged %s found.\n", formatTags([]string{db.NormalizeTag(filter.Tag)}))
+		case filter.Archived:
+			fmt.Println("No archived conversations found.")
+		default:
+			fmt.Println("No saved conversations found.")
+		}
 		return
 	}
 
 	// Create a tabwriter for nicely formatted output
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tTitle\tModel\tLast Updated")
-	fmt.Fprintln(w, "--\t-----\t-----\t------------")
+	fmt.Fprintln(w, "ID\tTitle\tTags\tModel\tLast Updated")
+	fmt.Fprintln(w, "--\t-----\t----\t-----\t------------")
 
 	for _, conv := range conversations {
 		// Format the ID to be shorter
 		shortID := conv.ID.String()[:8]
+		title := conv.Title
+		if conv.Pinned {
+			title = pinnedMarker + title
+		}
 		// Format the time
 		timeAgo := formatTimeAgo(time.Since(conv.UpdatedAt))
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", shortID, conv.Title, conv.Model, timeAgo)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", shortID, title, formatTags(conv.Tags), conv.Model, timeAgo)
 	}
 
 	w.Flush()
+	if shown := filter.Offset + len(conversations); filter.Offset > 0 || shown < total {
+		fmt.Printf("\nShowing %d-%d of %d conversations.", filter.Offset+1, shown, total)
+		if shown < total {
+			fmt.Printf(" Use --offset %d for more.", shown)
+		}
+		fmt.Println()
+	}
 	fmt.Println("\nUse 'mcg history show <id>' to view a conversation")
 	fmt.Println("Use 'mcg chat --continue <id>' to continue a conversation")
 }
 
+// pinnedMarker is shown before the titles of pinned conversations
+const pinnedMarker = "★ "
+
+// formatTags formats tags as "#go #scratch"
+func formatTags(tags []string) string {
+	formatted := make([]string, len(tags))
+	for i, tag := range tags {
+		formatted[i] = "#" + tag
+	}
+	return strings.Join(formatted, " ")
+}
+
 // formatTimeAgo returns a human-readable string representing how long ago a time was
 func formatTimeAgo(duration time.Duration) string {
 	seconds := int(duration.Seconds())
@@ -35,11 +35,9 @@ Available options:
 		
 		fmt.Printf("Now using %s as the active LLM.\n", llmName)
 		
-		// Get the appropriate API key environment variable name
 		llmType := llm.LLMType(llmName)
-		envVar := llm.GetAPIKeyEnvVar(llmType)
-		if envVar != "" {
-			fmt.Printf("Make sure you have set the %s environment variable.\n", envVar)
+		if !llm.HasAPIKey(llmType) {
+			fmt.Printf("No API key is configured for %s: %s.\n", llmType, llm.APIKeyHint(llmType))
 		}
 	},
 }
@@ -52,7 +50,6 @@ var listLLMsCmd = &cobra.Command{
 		fmt.Println("Available LLMs:")
 		
 		for _, llmType := range llm.GetAvailableLLMs() {
-			envVar := llm.GetAPIKeyEnvVar(llmType)
 			var description string
 			
 			switch llmType {
@@ -66,7 +63,11 @@ var listLLMsCmd = &cobra.Command{
 				description = "Google's Gemini models"
 			}
 			
-			fmt.Printf("- %s: %s (requires %s)\n", llmType, description, envVar)
+			keyStatus := "no API key"
+			if _, source := llm.LookupAPIKey(llmType); source != "" {
+				keyStatus = "key from " + source
+			}
+			fmt.Printf("- %s: %s (%s)\n", llmType, description, keyStatus)
 		}
 		
 		current := llm.GetCurrentLLM()
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(profilesCmd)
+}
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List system prompt profiles",
+	Long: `List the system prompt profiles McGraph can use.
+
+Profiles are Markdown files in ~/.mcgraph/profiles/<name>.md. The body is the
+system prompt; optional front matter sets the generation parameters:
+
+---
+description: Thorough code reviewer
+temperature: 0.2
+max_tokens: 4096
+stop: ["END"]
+---
+You are a meticulous code reviewer...
+
+Select a profile with --profile on ask and chat, or /profile in a chat.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := llm.ListProfiles()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Name\tDescription\tTemperature\tMax Tokens")
+		fmt.Fprintln(w, "----\t-----------\t-----------\t----------")
+		for _, profile := range profiles {
+			temperature := "default"
+			if profile.Temperature != nil {
+				temperature = fmt.Sprintf("%.1f", *profile.Temperature)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", profile.Name, profile.Description, temperature, profile.MaxTokens)
+		}
+		w.Flush()
+		
+		return nil
+	},
+}
+
+// completeProfileNames completes the names of the available profiles
+func completeProfileNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// Profiles that fail to load are left out
+	profiles, _ := llm.ListProfiles()
+	
+	var completions []string
+	for _, profile := range profiles {
+		completions = append(completions, fmt.Sprintf("%s\t%s", profile.Name, profile.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hawk/mcgraph/internal/project"
+	"github.com/spf13/cobra"
+)
+
+// Project context flags shared by ask and chat
+var (
+	noProject   bool
+	projectTree bool
+	projectDiff bool
+)
+
+// addProjectFlags adds the project context flags to a command
+func addProjectFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noProject, "no-project", false, "Don't add project context when run inside a git repository")
+	cmd.Flags().BoolVar(&projectTree, "tree", false, "Add the project's file tree to the context")
+	cmd.Flags().BoolVar(&projectDiff, "diff", false, "Add a summary of uncommitted changes to the context")
+}
+
+// currentProject returns the git repository of the working directory, or nil
+// when there is none or project context was disabled
+func currentProject() *project.Project {
+	if noProject {
+		return nil
+	}
+	
+	proj, err := project.DetectCurrent()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to detect project: %v\n", err)
+		return nil
+	}
+	return proj
+}
+
+// projectContext returns the project context for the system prompt
+func projectContext(proj *project.Project) string {
+	if proj == nil {
+		return ""
+	}
+	
+	context, err := proj.SystemContext(project.ContextOptions{Tree: projectTree, Diff: projectDiff})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load project context: %v\n", err)
+		return ""
+	}
+	return context
+}
+
+// projectRoot returns the root of the project, or an empty string for none
+func projectRoot(proj *project.Project) string {
+	if proj == nil {
+		return ""
+	}
+	return proj.Root
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// RetentionEnvVar sets how long unpinned conversations are kept, e.g. "6mo".
+// Older ones are deleted after each command.
+const RetentionEnvVar = "MCGRAPH_RETENTION"
+
+// maxDeletePreview is the number of conversations listed before confirming a deletion
+const maxDeletePreview = 10
+
+// deleteOptions holds the flags of history delete and history prune
+type deleteOptions struct {
+	olderThan string
+	model     string
+	tag       string
+	archived  bool
+	yes       bool
+	dryRun    bool
+}
+
+var (
+	deleteOpts deleteOptions
+	pruneOpts  deleteOptions
+)
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old conversations in bulk",
+	Long: `Delete the conversations that weren't updated for a while, e.g.
+mcg history prune --older-than 90d --model deepseek --dry-run.
+Without --older-than the retention policy in $MCGRAPH_RETENTION is used.
+Pinned conversations are always kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneOpts.olderThan == "" {
+			pruneOpts.olderThan = os.Getenv(RetentionEnvVar)
+			if pruneOpts.olderThan == "" {
+				return fmt.Errorf("tell how old conversations must be with --older-than, e.g. --older-than 90d, or set %s", RetentionEnvVar)
+			}
+		}
+		filter, err := pruneOpts.filter()
+		if err != nil {
+			return err
+		}
+		return deleteConversations(filter, pruneOpts)
+	},
+}
+
+func init() {
+	addDeleteFlags(historyDeleteCmd, &deleteOpts)
+	addDeleteFlags(historyPruneCmd, &pruneOpts)
+	historyCmd.AddCommand(historyPruneCmd)
+}
+
+// addDeleteFlags adds the flags shared by history delete and prune to cmd
+func addDeleteFlags(cmd *cobra.Command, opts *deleteOptions) {
+	cmd.Flags().StringVar(&opts.olderThan, "older-than", "", "Only delete conversations not updated for this long, e.g. 90d, 12w, 6mo or 1y")
+	cmd.Flags().StringVar(&opts.model, "model", "", "Only delete conversations with this provider or model")
+	cmd.Flags().StringVar(&opts.tag, "tag", "", "Only delete conversations with this tag")
+	cmd.Flags().BoolVar(&opts.archived, "archived", false, "Only delete archived conversations")
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "Don't ask for confirmation")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show what would be deleted without deleting it")
+}
+
+// hasFilters reports whether any flag narrows down the conversations to delete
+func (opts deleteOptions) hasFilters() bool {
+	return opts.olderThan != "" || opts.model != "" || opts.tag != "" || opts.archived
+}
+
+// filter returns the database filter for the options. Pinned conversations
+// are left out; they're only deleted by ID.
+func (opts deleteOptions) filter() (db.ConversationFilter, error) {
+	filter := db.ConversationFilter{
+		Tag:         opts.tag,
+		Model:       opts.model,
+		Archived:    opts.archived,
+		AnyArchived: !opts.archived,
+		Unpinned:    true,
+	}
+	if opts.olderThan != "" {
+		before, err := parseAge(opts.olderThan, time.Now())
+		if err != nil {
+			return db.ConversationFilter{}, fmt.Errorf("invalid --older-than: %w", err)
+		}
+		filter.Before = before
+	}
+	return filter, nil
+}
+
+// deleteConversations deletes the conversations matching filter after
+// showing them and asking for confirmation, unless opts say otherwise
+func deleteConversations(filter db.ConversationFilter, opts deleteOptions) error {
+	ctx := context.Background()
+	result, err := dbConn.DeleteConversations(ctx, filter, true)
+	if err != nil {
+		return err
+	}
+	if result.Conversations == 0 {
+		fmt.Println("No conversations to delete.")
+		return nil
+	}
+
+	if opts.dryRun || !opts.yes {
+		preview := filter
+		preview.Limit = maxDeletePreview
+		conversations, err := dbConn.FindConversations(ctx, preview)
+		if err != nil {
+			return fmt.Errorf("error listing conversations: %w", err)
+		}
+		for _, conv := range conversations {
+			fmt.Printf("  %s  %s  (%s, %s)\n", conv.ID.String()[:8], conv.Title, conv.Model, formatTimeAgo(time.Since(conv.UpdatedAt)))
+		}
+		if more := result.Conversations - len(conversations); more > 0 {
+			fmt.Printf("  ... and %d more\n", more)
+		}
+	}
+
+	if opts.dryRun {
+		fmt.Printf("Would delete %s, freeing %s.\n", describeDeletion(result), formatBytes(result.Bytes))
+		return nil
+	}
+
+	if !opts.yes {
+		confirmed, err := confirm(fmt.Sprintf("Delete %s", describeDeletion(result)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("Deletion cancelled.")
+			return nil
+		}
+	}
+
+	result, err = dbConn.DeleteConversations(ctx, filter, false)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %s, freeing %s.\n", describeDeletion(result), formatBytes(result.Bytes))
+	return nil
+}
+
+// deleteConversationsByID deletes the conversations with the given full or short IDs
+func deleteConversationsByID(partialIDs []string, opts deleteOptions) error {
+	filter, err := opts.filter()
+	if err != nil {
+		return err
+	}
+	// Conversations picked by ID are deleted even when pinned
+	filter.Unpinned = false
+
+	ids := make([]uuid.UUID, 0, len(partialIDs))
+	for _, partialID := range partialIDs {
+		id, err := resolveConversationID(partialID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	filter.IDs = ids
+	return deleteConversations(filter, opts)
+}
+
+// applyRetention deletes the unpinned conversations older than the retention
+// policy in $MCGRAPH_RETENTION, if one is set
+func applyRetention(ctx context.Context) {
+	retention := os.Getenv(RetentionEnvVar)
+	if retention == "" {
+		return
+	}
+	before, err := parseAge(retention, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: invalid %s: %v\n", RetentionEnvVar, err)
+		return
+	}
+
+	result, err := dbConn.DeleteConversations(ctx, db.ConversationFilter{Before: before, AnyArchived: true, Unpinned: true}, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to apply the retention policy: %v\n", err)
+		return
+	}
+	if result.Conversations > 0 {
+		fmt.Fprintf(os.Stderr, "Deleted %s not updated in %s, freeing %s.\n", describeDeletion(result), retention, formatBytes(result.Bytes))
+	}
+}
+
+// describeDeletion describes what a deletion removes, e.g. "3 conversations (42 messages, 1 attachment)"
+func describeDeletion(result db.DeleteResult) string {
+	description := fmt.Sprintf("%s (%s", plural(result.Conversations, "conversation"), plural(result.Messages, "message"))
+	if result.Attachments > 0 {
+		description += ", " + plural(result.Attachments, "attachment")
+	}
+	return description + ")"
+}
+
+// plural formats a count of things, e.g. "1 message" or "2 messages"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatBytes formats a size in bytes, e.g. "1.5 MB"
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal to ask
+// on, it fails rather than guessing.
+func confirm(question string) (bool, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("refusing to delete without confirmation, pass --yes to delete from a script")
+	}
+
+	fmt.Printf("%s [y/N]? ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// parseAge returns the time an age like 90d, 12w, 6mo, 1y or 36h before now
+func parseAge(value string, now time.Time) (time.Time, error) {
+	units := []struct {
+		suffix              string
+		years, months, days int
+	}{
+		{"mo", 0, 1, 0},
+		{"d", 0, 0, 1},
+		{"w", 0, 0, 7},
+		{"y", 1, 0, 0},
+	}
+	for _, unit := range units {
+		if count, ok := strings.CutSuffix(value, unit.suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				break
+			}
+			return now.AddDate(-n*unit.years, -n*unit.months, -n*unit.days), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("%q isn't an age like 90d, 12w, 6mo, 1y or 36h", value)
+}
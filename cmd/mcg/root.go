@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/hawk/mcgraph/internal/cassette"
 	"github.com/hawk/mcgraph/internal/db"
 	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
 	"github.com/spf13/cobra"
 )
 
@@ -21,37 +24,40 @@ var rootCmd = &cobra.Command{
 	Short: "mcgraph - A multi-LLM coding assistant",
 	Long:  `mcgraph is a CLI tool that can use multiple LLMs for coding assistance.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupAPIKeys(); err != nil {
+			return err
+		}
+		if err := setupRecording(); err != nil {
+			return err
+		}
+
 		// Skip database initialization for commands that don't need it
-		if cmd.Name() == "version" || cmd.Name() == "help" || cmd.Name() == "pick" || cmd.Name() == "llms" || 
-		   cmd.Name() == "ext" || cmd.Parent().Name() == "ext" {
+		if skipsDatabase(cmd) {
 			return nil
 		}
 
-		// Initialize database connection
-		ctx := context.Background()
-		config := db.ConfigFromEnv()
-		
 		// Validate configuration and show setup instructions if using defaults
+		config := db.ConfigFromEnv()
 		if setupInstructions := db.ValidateConfig(config); setupInstructions != "" {
 			fmt.Println(setupInstructions)
 			return fmt.Errorf("database configuration required")
 		}
 		
-		var err error
-		dbConn, err = db.New(ctx, config)
-		if err != nil {
-			// Provide a more user-friendly error message
-			return fmt.Errorf("failed to connect to database: %w\n\nPlease ensure PostgreSQL is running and properly configured.", err)
+		if err := connectDB(context.Background(), config); err != nil {
+			return err
 		}
-
-		// Initialize database schema
-		if err := dbConn.Init(ctx); err != nil {
-			return fmt.Errorf("failed to initialize database schema: %w", err)
+		if err := setupEncryption(); err != nil {
+			return err
 		}
-
+		setupCache()
 		return nil
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		// Apply the retention policy, unless deleting by hand
+		if dbConn != nil && cmd != historyDeleteCmd && cmd != historyPruneCmd {
+			applyRetention(context.Background())
+		}
+		
 		// Close database connection
 		if dbConn != nil {
 			dbConn.Close()
@@ -63,6 +69,68 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// noDatabaseCommands lists the commands that run without a database connection.
+// Subcommands of these commands skip it as well.
+var noDatabaseCommands = map[string]bool{
+	"version":                       true,
+	"help":                          true,
+	"pick":                          true,
+	"llms":                          true,
+	"profiles":                      true,
+	"ext":                           true,
+	"completion":                    true,
+	"docs":                          true,
+	"keygen":                        true,
+	"auth":                          true,
+	cobra.ShellCompRequestCmd:       true,
+	cobra.ShellCompNoDescRequestCmd: true,
+}
+
+// skipsDatabase reports whether cmd or one of its parents doesn't need the database
+func skipsDatabase(cmd *cobra.Command) bool {
+	// The root command on its own only prints help
+	if !cmd.HasParent() {
+		return true
+	}
+	
+	for c := cmd; c != nil; c = c.Parent() {
+		if noDatabaseCommands[c.Name()] {
+			return true
+		}
+	}
+	return false
+}
+
+// connectDB opens the global database connection and initializes the schema
+func connectDB(ctx context.Context, config db.Config) error {
+	var err error
+	dbConn, err = db.New(ctx, config)
+	if err != nil {
+		// Provide a more user-friendly error message
+		return fmt.Errorf("failed to connect to database: %w\n\nPlease ensure PostgreSQL is running and properly configured.", err)
+	}
+
+	// Initialize database schema
+	if err := dbConn.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize database schema: %w", err)
+	}
+
+	return nil
+}
+
+// setupRecording records the provider requests to a cassette, or replays
+// them from one, when $MCGRAPH_RECORD or $MCGRAPH_REPLAY is set
+func setupRecording() error {
+	transport, err := cassette.FromEnv()
+	if err != nil {
+		return err
+	}
+	if transport != nil {
+		llm.SetHTTPTransport(transport)
+	}
+	return nil
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -83,6 +151,11 @@ func init() {
 		// Create manager based on configuration
 		extManager = extensions.NewManager(extConfig.Enabled)
 		
+		// Shell completion reads stdout, so keep loading messages out of it
+		if isCompletionRequest() {
+			extManager.SetOutput(io.Discard)
+		}
+		
 		// Load extensions if enabled
 		if extConfig.Enabled {
 			if err := extManager.LoadExtensions(); err != nil {
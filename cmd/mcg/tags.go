@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var historyTagCmd = &cobra.Command{
+	Use:   "tag [id] [+tag|-tag]...",
+	Short: "Show, add or remove the tags of a conversation",
+	Long: `Show the tags of a conversation, or change them: +tag (or just tag)
+adds a tag and -tag removes it, e.g. mcg history tag 1a2b3c4d +go -scratch.
+List the conversations with a tag using mcg list --tag <tag>.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := resolveConversationID(args[0])
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+
+		if len(args) == 1 {
+			conversation, err := dbConn.GetConversation(ctx, id)
+			if err != nil {
+				return fmt.Errorf("error retrieving conversation: %w", err)
+			}
+			if len(conversation.Tags) == 0 {
+				fmt.Println("No tags.")
+			} else {
+				fmt.Println(formatTags(conversation.Tags))
+			}
+			return nil
+		}
+
+		add, remove := parseTagChanges(args[1:])
+		tags, err := dbConn.UpdateConversationTags(ctx, id, add, remove)
+		if err != nil {
+			return fmt.Errorf("error updating tags: %w", err)
+		}
+		if len(tags) == 0 {
+			fmt.Printf("%s has no tags\n", id.String()[:8])
+		} else {
+			fmt.Printf("%s is tagged %s\n", id.String()[:8], formatTags(tags))
+		}
+		return nil
+	},
+}
+
+// parseTagChanges splits "+tag" and "-tag" arguments into tags to add and remove
+func parseTagChanges(args []string) ([]string, []string) {
+	var add, remove []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-"):
+			remove = append(remove, arg[1:])
+		case strings.HasPrefix(arg, "+"):
+			add = append(add, arg[1:])
+		default:
+			add = append(add, arg)
+		}
+	}
+	return add, remove
+}
+
+// newFlagCommand returns a history subcommand that sets a flag of a conversation, like pin or archive
+func newFlagCommand(name, short, done string, set func(ctx context.Context, id uuid.UUID) error) *cobra.Command {
+	return &cobra.Command{
+		Use:               name + " [id]",
+		Short:             short,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConversationIDs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := resolveConversationID(args[0])
+			if err != nil {
+				return err
+			}
+			if err := set(context.Background(), id); err != nil {
+				return fmt.Errorf("error updating conversation: %w", err)
+			}
+			fmt.Printf("Conversation %s %s\n", id.String()[:8], done)
+			return nil
+		},
+	}
+}
+
+// setPinned returns a function that pins or unpins a conversation
+func setPinned(pinned bool) func(ctx context.Context, id uuid.UUID) error {
+	return func(ctx context.Context, id uuid.UUID) error {
+		return dbConn.SetConversationPinned(ctx, id, pinned)
+	}
+}
+
+// setArchived returns a function that archives or restores a conversation
+func setArchived(archived bool) func(ctx context.Context, id uuid.UUID) error {
+	return func(ctx context.Context, id uuid.UUID) error {
+		return dbConn.SetConversationArchived(ctx, id, archived)
+	}
+}
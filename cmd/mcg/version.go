@@ -6,6 +6,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// version is the current mcgraph version
+const version = "0.1 beta"
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
@@ -15,6 +18,6 @@ var versionCmd = &cobra.Command{
 	Short: "Print the version number of mcgraph",
 	Long:  `All software has versions. This is mcgraph's`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("0.1 beta")
+		fmt.Println(version)
 	},
 }
\ No newline at end of file
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/keyring"
+)
+
+// StoreEnvVar selects where API keys are stored: "keyring" or "file".
+// The keyring is used when the platform has one.
+const StoreEnvVar = "MCGRAPH_AUTH_STORE"
+
+// ErrNotFound is returned when no API key is stored for a provider
+var ErrNotFound = errors.New("no API key stored")
+
+// Store keeps the API keys of the providers
+type Store interface {
+	// Name describes where the keys are kept
+	Name() string
+	// Get returns the key of provider, or ErrNotFound
+	Get(provider string) (string, error)
+	// Set stores the key of provider, replacing any previous one
+	Set(provider, key string) error
+	// Delete removes the key of provider, failing with ErrNotFound if there is none
+	Delete(provider string) error
+}
+
+// Open returns the store selected by $MCGRAPH_AUTH_STORE
+func Open() (Store, error) {
+	switch kind := os.Getenv(StoreEnvVar); kind {
+	case "keyring":
+		return KeyringStore{}, nil
+	case "file":
+		return DefaultFileStore()
+	case "":
+		if keyring.Available() {
+			return KeyringStore{}, nil
+		}
+		return DefaultFileStore()
+	default:
+		return nil, fmt.Errorf("invalid %s %q: use keyring or file", StoreEnvVar, kind)
+	}
+}
+
+// KeyringStore keeps API keys in the OS keyring
+type KeyringStore struct{}
+
+// keyringAccount returns the keyring entry of a provider's API key
+func keyringAccount(provider string) string {
+	return "api-key-" + provider
+}
+
+// Name describes where the keys are kept
+func (KeyringStore) Name() string {
+	return "OS keyring"
+}
+
+// Get returns the key of provider
+func (KeyringStore) Get(provider string) (string, error) {
+	key, err := keyring.Get(keyringAccount(provider))
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return key, err
+}
+
+// Set stores the key of provider
+func (KeyringStore) Set(provider, key string) error {
+	return keyring.Set(keyringAccount(provider), key)
+}
+
+// Delete removes the key of provider
+func (s KeyringStore) Delete(provider string) error {
+	if _, err := s.Get(provider); err != nil {
+		return err
+	}
+	return keyring.Delete(keyringAccount(provider))
+}
+
+// FileStore keeps API keys in a file encrypted with AES-256-GCM. The key is
+// in a separate file, so the credentials file alone, e.g. in a backup or a
+// synced dotfiles directory, doesn't give the API keys away.
+type FileStore struct {
+	Path    string // Encrypted credentials
+	KeyPath string // Key the credentials are encrypted with
+}
+
+// DefaultFileStore returns the store in ~/.mcgraph/credentials
+func DefaultFileStore() (*FileStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dir := filepath.Join(homeDir, ".mcgraph")
+	return &FileStore{Path: filepath.Join(dir, "credentials"), KeyPath: filepath.Join(dir, "credentials.key")}, nil
+}
+
+// credentialsAAD binds the ciphertext to its purpose
+var credentialsAAD = []byte("mcgraph credentials")
+
+// Name describes where the keys are kept
+func (s *FileStore) Name() string {
+	return "encrypted file " + s.Path
+}
+
+// Get returns the key of provider
+func (s *FileStore) Get(provider string) (string, error) {
+	keys, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[provider]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+// Set stores the key of provider
+func (s *FileStore) Set(provider, key string) error {
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	keys[provider] = key
+	return s.save(keys)
+}
+
+// Delete removes the key of provider
+func (s *FileStore) Delete(provider string) error {
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[provider]; !ok {
+		return ErrNotFound
+	}
+	delete(keys, provider)
+	return s.save(keys)
+}
+
+// load decrypts the stored keys. A missing file holds no keys.
+func (s *FileStore) load() (map[string]string, error) {
+	keys := make(map[string]string)
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := s.cipher(false)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s is corrupt", s.Path)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], credentialsAAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: it was changed, or %s isn't its key", s.Path, s.KeyPath)
+	}
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		return nil, fmt.Errorf("%s is corrupt: %w", s.Path, err)
+	}
+	return keys, nil
+}
+
+// save encrypts keys and replaces the credentials file with them
+func (s *FileStore) save(keys map[string]string) error {
+	aead, err := s.cipher(true)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, credentialsAAD)
+
+	// Write a new file and move it in place so a failed write keeps the old keys
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(base64.StdEncoding.EncodeToString(sealed)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// cipher returns the cipher of the credentials, creating its key if create is set
+func (s *FileStore) cipher(create bool) (cipher.AEAD, error) {
+	data, err := os.ReadFile(s.KeyPath)
+	if os.IsNotExist(err) && create {
+		data, err = s.createKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the credentials key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s isn't a valid credentials key", s.KeyPath)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// createKey writes a random key for the credentials, readable only by the user
+func (s *FileStore) createKey() ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(s.KeyPath), 0700); err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(key) + "\n")
+	if err := os.WriteFile(s.KeyPath, encoded, 0600); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
@@ -0,0 +1,200 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Environment variables that make mcg record its provider requests to a
+// cassette, or answer them from one without touching the network
+const (
+	RecordEnvVar = "MCGRAPH_RECORD"
+	ReplayEnvVar = "MCGRAPH_REPLAY"
+)
+
+// ErrNoInteraction is returned when replaying a request the cassette doesn't hold
+var ErrNoInteraction = errors.New("no recorded response")
+
+// Mode is whether a Transport records or replays
+type Mode string
+
+const (
+	// Record sends requests and saves them with their responses
+	Record Mode = "record"
+	// Replay answers requests from the cassette
+	Replay Mode = "replay"
+)
+
+// Interaction is a request and the response it got
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is what identifies a recorded request. Headers aren't recorded so
+// API keys never end up in a cassette.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body"`
+}
+
+// Response is a recorded response
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Cassette is the file interactions are recorded to
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Transport records requests to a cassette or replays them from it
+type Transport struct {
+	Path string
+	Mode Mode
+	Next http.RoundTripper // Sends the requests being recorded, http.DefaultTransport when nil
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool // Replayed interactions, so repeated requests get the responses in order
+}
+
+// New returns a transport recording to, or replaying from, the cassette at path
+func New(path string, mode Mode) (*Transport, error) {
+	t := &Transport{Path: path, Mode: mode}
+	switch mode {
+	case Record:
+		return t, nil
+	case Replay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, fmt.Errorf("cassette %s is corrupt: %w", path, err)
+		}
+		t.used = make([]bool, len(t.cassette.Interactions))
+		return t, nil
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q: use record or replay", mode)
+	}
+}
+
+// FromEnv returns the transport set up by $MCGRAPH_RECORD or
+// $MCGRAPH_REPLAY, or nil when neither is set
+func FromEnv() (*Transport, error) {
+	record, replay := os.Getenv(RecordEnvVar), os.Getenv(ReplayEnvVar)
+	switch {
+	case record != "" && replay != "":
+		return nil, fmt.Errorf("set either %s or %s, not both", RecordEnvVar, ReplayEnvVar)
+	case record != "":
+		return New(record, Record)
+	case replay != "":
+		return New(replay, Replay)
+	default:
+		return nil, nil
+	}
+}
+
+// RoundTrip records or replays a request
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := Request{Method: req.Method, URL: req.URL.String()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.Mode == Replay {
+		return t.replay(req, recorded)
+	}
+	return t.record(req, recorded)
+}
+
+// replay answers with the first unused interaction matching the request
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, interaction := range t.cassette.Interactions {
+		if !t.used[i] && interaction.Request == recorded {
+			t.used[i] = true
+			return interaction.Response.http(req), nil
+		}
+	}
+	return nil, fmt.Errorf("%w in %s for %s %s", ErrNoInteraction, t.Path, recorded.Method, recorded.URL)
+}
+
+// record sends the request and saves it with its response
+func (t *Transport) record(req *http.Request, recorded Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request:  recorded,
+		Response: Response{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: string(body)},
+	})
+	return resp, t.save()
+}
+
+// save writes the cassette, after each interaction so a failing run keeps what it recorded
+func (t *Transport) save() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.Path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(t.Path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// http builds the response to replay for req
+func (r Response) http(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
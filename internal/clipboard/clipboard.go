@@ -0,0 +1,101 @@
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Method is how text was copied
+type Method string
+
+const (
+	// System means the text went to the system clipboard through a helper program
+	System Method = "system clipboard"
+	// OSC52 means the terminal was asked to set the clipboard, which also works over SSH
+	OSC52 Method = "terminal clipboard (OSC 52)"
+)
+
+// terminal receives the OSC 52 escape sequence
+var terminal io.Writer = os.Stdout
+
+// Copy copies text to the clipboard. Locally it uses the system clipboard and
+// falls back to OSC 52 when no clipboard program is available. Over SSH the
+// system clipboard is on the other machine, so OSC 52 is used right away.
+func Copy(text string) (Method, error) {
+	if !isRemote() {
+		if err := copySystem(text); err == nil {
+			return System, nil
+		}
+	}
+
+	if err := copyOSC52(text); err != nil {
+		return "", err
+	}
+	return OSC52, nil
+}
+
+// isRemote reports whether we run in an SSH session
+func isRemote() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_CLIENT") != ""
+}
+
+// copySystem copies text with the platform's clipboard program
+func copySystem(text string) error {
+	cmd, err := systemCommand()
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// systemCommand returns the first clipboard program found for the platform
+func systemCommand() (*exec.Cmd, error) {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip.exe"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, []string{"wl-copy"})
+		}
+		candidates = append(candidates,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+			// WSL can reach the Windows clipboard
+			[]string{"clip.exe"},
+		)
+	}
+
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate[0]); err == nil {
+			return exec.Command(path, candidate[1:]...), nil
+		}
+	}
+	return nil, errors.New("no clipboard program found")
+}
+
+// copyOSC52 asks the terminal to set the clipboard with an OSC 52 escape sequence
+func copyOSC52(text string) error {
+	sequence := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+
+	// tmux only passes escape sequences through to the terminal when wrapped
+	if os.Getenv("TMUX") != "" {
+		sequence = "\x1bPtmux;\x1b" + sequence + "\x1b\\"
+	}
+
+	_, err := io.WriteString(terminal, sequence)
+	return err
+}
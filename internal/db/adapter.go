@@ -16,12 +16,88 @@ func NewAdapter(db *DB) *DBAdapter {
 	return &DBAdapter{DB: db}
 }
 
-// AddMessage adds a message and returns an interface{} compatible with tui.DBInterface
-func (a *DBAdapter) AddMessage(ctx context.Context, conversationID uuid.UUID, role, content string) (interface{}, error) {
-	return a.DB.AddMessage(ctx, conversationID, role, content)
+// AddMessage adds a message replying to parentID and returns its ID
+func (a *DBAdapter) AddMessage(ctx context.Context, conversationID uuid.UUID, parentID uuid.NullUUID, role, model, content string) (uuid.UUID, error) {
+	message, err := a.DB.AddReply(ctx, conversationID, parentID, role, model, content)
+	return message.ID, err
+}
+
+// SetActiveMessage selects the branch a conversation continues from
+func (a *DBAdapter) SetActiveMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID) error {
+	return a.DB.SetActiveMessage(ctx, conversationID, messageID)
+}
+
+// UpdateConversationModel records the backend a conversation continues with
+func (a *DBAdapter) UpdateConversationModel(ctx context.Context, conversationID uuid.UUID, model string) error {
+	return a.DB.UpdateConversationModel(ctx, conversationID, model)
+}
+
+// UpdateConversationProfile records the profile used by a conversation
+func (a *DBAdapter) UpdateConversationProfile(ctx context.Context, conversationID uuid.UUID, profile string) error {
+	return a.DB.UpdateConversationProfile(ctx, conversationID, profile)
+}
+
+// UpdateConversationSummary stores the running summary of a conversation
+func (a *DBAdapter) UpdateConversationSummary(ctx context.Context, conversationID uuid.UUID, summary string, messageCount int) error {
+	return a.DB.UpdateConversationSummary(ctx, conversationID, summary, messageCount)
 }
 
 // GenerateTitle generates a title from the first user message
 func (a *DBAdapter) GenerateTitle(ctx context.Context, conversationID uuid.UUID) (string, error) {
 	return a.DB.GenerateTitle(ctx, conversationID)
-}
\ No newline at end of file
+}
+
+// CreateConversation creates a new conversation
+func (a *DBAdapter) CreateConversation(ctx context.Context, title, model, profile, repoPath string) (Conversation, error) {
+	return a.DB.CreateConversation(ctx, title, model, profile, repoPath)
+}
+
+// GetConversation retrieves a conversation with its active branch
+func (a *DBAdapter) GetConversation(ctx context.Context, conversationID uuid.UUID) (Conversation, error) {
+	return a.DB.GetConversation(ctx, conversationID)
+}
+
+// GetMessages retrieves every message of a conversation, across all branches
+func (a *DBAdapter) GetMessages(ctx context.Context, conversationID uuid.UUID) ([]Message, error) {
+	return a.DB.GetMessages(ctx, conversationID)
+}
+
+// UpdateConversationTitle renames a conversation
+func (a *DBAdapter) UpdateConversationTitle(ctx context.Context, conversationID uuid.UUID, title string) error {
+	return a.DB.UpdateConversationTitle(ctx, conversationID, title)
+}
+
+// DeleteConversation deletes a conversation with its messages
+func (a *DBAdapter) DeleteConversation(ctx context.Context, conversationID uuid.UUID) error {
+	return a.DB.DeleteConversation(ctx, conversationID)
+}
+
+// AddAttachments stores the files sent with a message
+func (a *DBAdapter) AddAttachments(ctx context.Context, messageID uuid.UUID, attachments []Attachment) error {
+	return a.DB.AddAttachments(ctx, messageID, attachments)
+}
+
+// FindConversations lists the conversations matching filter, pinned first
+func (a *DBAdapter) FindConversations(ctx context.Context, filter ConversationFilter) ([]Conversation, error) {
+	return a.DB.FindConversations(ctx, filter)
+}
+
+// UpdateConversationTags adds and removes tags of a conversation
+func (a *DBAdapter) UpdateConversationTags(ctx context.Context, conversationID uuid.UUID, add, remove []string) ([]string, error) {
+	return a.DB.UpdateConversationTags(ctx, conversationID, add, remove)
+}
+
+// SetConversationPinned pins or unpins a conversation
+func (a *DBAdapter) SetConversationPinned(ctx context.Context, conversationID uuid.UUID, pinned bool) error {
+	return a.DB.SetConversationPinned(ctx, conversationID, pinned)
+}
+
+// MarkMessageCached records that an answer came from the response cache
+func (a *DBAdapter) MarkMessageCached(ctx context.Context, messageID uuid.UUID) error {
+	return a.DB.MarkMessageCached(ctx, messageID)
+}
+
+// SetConversationArchived archives or restores a conversation
+func (a *DBAdapter) SetConversationArchived(ctx context.Context, conversationID uuid.UUID, archived bool) error {
+	return a.DB.SetConversationArchived(ctx, conversationID, archived)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a file sent with a message. The data is stored once per
+// content hash, however many messages it is attached to.
+type Attachment struct {
+	Hash      string `json:"hash"` // Hex SHA-256 of the data, keyed when encrypted
+	Name      string `json:"name"`
+	MediaType string `json:"media_type"`
+	Size      int    `json:"size"`
+	Data      []byte `json:"-"`
+}
+
+// HashAttachment returns the content hash an attachment is stored under
+func HashAttachment(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashAttachment returns the hash an attachment is stored under, keyed by the
+// encryption key when there is one
+func (db *DB) hashAttachment(data []byte) string {
+	if db.cipher == nil {
+		return HashAttachment(data)
+	}
+	return db.cipher.hash(data)
+}
+
+// AddAttachments stores the files sent with a message, skipping data that is already stored
+func (db *DB) AddAttachments(ctx context.Context, messageID uuid.UUID, attachments []Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save attachments: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+	for i, attachment := range attachments {
+		hash := db.hashAttachment(attachment.Data)
+		data, keyID, err := db.encryptAttachment(hash, attachment.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt attachment %s: %w", attachment.Name, err)
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO attachments (hash, media_type, size, data, key_id, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (hash) DO NOTHING",
+			hash, attachment.MediaType, len(attachment.Data), data, keyID, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save attachment %s: %w", attachment.Name, err)
+		}
+
+		_, err = tx.Exec(ctx,
+			"INSERT INTO message_attachments (message_id, position, hash, name) VALUES ($1, $2, $3, $4)",
+			messageID, i, hash, attachment.Name,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save attachment %s: %w", attachment.Name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to save attachments: %w", err)
+	}
+	return nil
+}
+
+// loadAttachments fills in the attachments of a conversation's messages
+func (db *DB) loadAttachments(ctx context.Context, conversationID uuid.UUID, messages []Message) error {
+	rows, err := db.pool.Query(ctx,
+		`SELECT ma.message_id, ma.name, a.hash, a.media_type, a.size, a.data, a.key_id
+		FROM message_attachments ma
+		JOIN attachments a ON a.hash = ma.hash
+		JOIN messages m ON m.id = ma.message_id
+		WHERE m.conversation_id = $1
+		ORDER BY ma.message_id, ma.position`,
+		conversationID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[uuid.UUID]int, len(messages))
+	for i, message := range messages {
+		index[message.ID] = i
+	}
+	for rows.Next() {
+		var messageID uuid.UUID
+		var attachment Attachment
+		var keyID string
+		err := rows.Scan(&messageID, &attachment.Name, &attachment.Hash, &attachment.MediaType, &attachment.Size, &attachment.Data, &keyID)
+		if err != nil {
+			return err
+		}
+		if attachment.Data, err = db.decryptAttachment(attachment.Hash, keyID, attachment.Data); err != nil {
+			return err
+		}
+		if i, ok := index[messageID]; ok {
+			messages[i].Attachments = append(messages[i].Attachments, attachment)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CachedResponse is an answer stored in the response cache
+type CachedResponse struct {
+	Provider         string
+	Model            string // Model that answered
+	Content          string
+	PromptTokens     int
+	CompletionTokens int
+	CreatedAt        time.Time
+}
+
+// CacheLimits bounds the response cache
+type CacheLimits struct {
+	TTL      time.Duration // How long answers are used, zero for no limit
+	MaxBytes int64         // Size the least recently used answers are evicted down to, zero for no limit
+}
+
+// CacheStats describes the response cache
+type CacheStats struct {
+	Entries int
+	Bytes   int64
+	Hits    int // Requests answered from the cache
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// GetCachedResponse returns the answer stored under key unless it is older
+// than ttl. Answers encrypted with another key count as missing.
+func (db *DB) GetCachedResponse(ctx context.Context, key string, ttl time.Duration) (CachedResponse, bool, error) {
+	var response CachedResponse
+	var id uuid.UUID
+	var keyID string
+	err := db.pool.QueryRow(ctx,
+		`SELECT id, provider, model, content, key_id, prompt_tokens, completion_tokens, created_at
+		FROM response_cache WHERE key = $1`,
+		key,
+	).Scan(&id, &response.Provider, &response.Model, &response.Content, &keyID, &response.PromptTokens, &response.CompletionTokens, &response.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return CachedResponse{}, false, nil
+	}
+	if err != nil {
+		return CachedResponse{}, false, fmt.Errorf("failed to read the response cache: %w", err)
+	}
+	if ttl > 0 && time.Since(response.CreatedAt) > ttl {
+		return CachedResponse{}, false, nil
+	}
+	if response.Content, err = db.decryptContent(id, keyID, response.Content); err != nil {
+		return CachedResponse{}, false, nil
+	}
+
+	_, err = db.pool.Exec(ctx, "UPDATE response_cache SET hits = hits + 1, used_at = $1 WHERE key = $2", time.Now().UTC(), key)
+	if err != nil {
+		return CachedResponse{}, false, fmt.Errorf("failed to update the response cache: %w", err)
+	}
+	return response, true, nil
+}
+
+// PutCachedResponse stores an answer under key, then drops the answers past
+// the limits, the least recently used first
+func (db *DB) PutCachedResponse(ctx context.Context, key string, response CachedResponse, limits CacheLimits) error {
+	id := uuid.New()
+	now := time.Now().UTC()
+	content, keyID, err := db.encryptContent(id, response.Content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the cached response: %w", err)
+	}
+	_, err = db.pool.Exec(ctx,
+		`INSERT INTO response_cache (key, id, provider, model, content, key_id, prompt_tokens, completion_tokens, size, created_at, used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		ON CONFLICT (key) DO UPDATE SET id = $2, provider = $3, model = $4, content = $5, key_id = $6,
+			prompt_tokens = $7, completion_tokens = $8, size = $9, hits = 0, created_at = $10, used_at = $10`,
+		key, id, response.Provider, response.Model, content, keyID, response.PromptTokens, response.CompletionTokens, len(content), now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write the response cache: %w", err)
+	}
+
+	if limits.TTL > 0 {
+		if _, err := db.pool.Exec(ctx, "DELETE FROM response_cache WHERE created_at < $1", now.Add(-limits.TTL)); err != nil {
+			return fmt.Errorf("failed to expire cached responses: %w", err)
+		}
+	}
+	if limits.MaxBytes > 0 {
+		_, err := db.pool.Exec(ctx,
+			`DELETE FROM response_cache WHERE key IN (
+				SELECT key FROM (SELECT key, SUM(size) OVER (ORDER BY used_at DESC, key) AS total FROM response_cache) ranked
+				WHERE total > $1
+			)`,
+			limits.MaxBytes,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to evict cached responses: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResponseCacheStats describes the response cache
+func (db *DB) ResponseCacheStats(ctx context.Context) (CacheStats, error) {
+	var stats CacheStats
+	var oldest, newest *time.Time
+	err := db.pool.QueryRow(ctx,
+		"SELECT COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(hits), 0), MIN(created_at), MAX(created_at) FROM response_cache",
+	).Scan(&stats.Entries, &stats.Bytes, &stats.Hits, &oldest, &newest)
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to read the response cache: %w", err)
+	}
+	if oldest != nil {
+		stats.Oldest, stats.Newest = *oldest, *newest
+	}
+	return stats, nil
+}
+
+// ClearResponseCache deletes the cached answers, only those older than
+// olderThan when it is set, and returns how many there were
+func (db *DB) ClearResponseCache(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().UTC()
+	if olderThan > 0 {
+		cutoff = cutoff.Add(-olderThan)
+	}
+	tag, err := db.pool.Exec(ctx, "DELETE FROM response_cache WHERE created_at <= $1", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear the response cache: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// MarkMessageCached records that an assistant message was answered from the response cache
+func (db *DB) MarkMessageCached(ctx context.Context, id uuid.UUID) error {
+	_, err := db.pool.Exec(ctx, "UPDATE messages SET cached = TRUE WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,639 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/keyring"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyEnvVar tells where the key that encrypts message content comes from:
+// "keyring", "passphrase" or "file:<path>". Messages are stored in plain text when unset.
+const KeyEnvVar = "MCGRAPH_ENCRYPTION_KEY"
+
+// PassphraseEnvVar holds the passphrase when the key is derived from one
+const PassphraseEnvVar = "MCGRAPH_PASSPHRASE"
+
+// keyringAccount is the keyring entry holding the encryption key
+const keyringAccount = "encryption-key"
+
+// keySize is the length of AES-256 keys
+const keySize = 32
+
+// reencryptBatch is the number of messages migrated per transaction
+const reencryptBatch = 500
+
+// ErrKeyMissing is returned when reading messages encrypted with a key that isn't configured
+var ErrKeyMissing = errors.New("encryption key missing")
+
+// KeySource is where an encryption key comes from
+type KeySource struct {
+	Kind string // "keyring", "passphrase" or "file"
+	Path string // Key file of the "file" kind
+}
+
+func (s KeySource) String() string {
+	if s.Kind == "file" {
+		return "file:" + s.Path
+	}
+	return s.Kind
+}
+
+// ParseKeySource parses a key source like "keyring", "passphrase" or "file:~/.mcgraph/key"
+func ParseKeySource(spec string) (KeySource, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "keyring", spec == "passphrase":
+		return KeySource{Kind: spec}, nil
+	case strings.HasPrefix(spec, "file:") && len(spec) > len("file:"):
+		return KeySource{Kind: "file", Path: expandHome(strings.TrimPrefix(spec, "file:"))}, nil
+	default:
+		return KeySource{}, fmt.Errorf("invalid key source %q: use keyring, passphrase or file:<path>", spec)
+	}
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
+
+// Cipher encrypts and decrypts message content with AES-256-GCM
+type Cipher struct {
+	aead    cipher.AEAD
+	hashKey []byte // Key of the HMAC attachments are stored under
+	KeyID   string // Fingerprint of the key, stored with the messages it encrypted
+}
+
+// NewCipher returns a cipher for a 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption keys are %d bytes, not %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("mcgraph key id\x00"), key...))
+	hashKey := sha256.Sum256(append([]byte("mcgraph attachment hash\x00"), key...))
+	return &Cipher{aead: aead, hashKey: hashKey[:], KeyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+// hash returns the hash an attachment encrypted with c is stored under. It is
+// keyed, so equal hashes don't tell which files are stored without the key.
+func (c *Cipher) hash(data []byte) string {
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts data. aad is authenticated with it, so the ciphertext
+// can't be moved to another row.
+func (c *Cipher) seal(aad, data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to read a random nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, data, aad), nil
+}
+
+// open decrypts data sealed with seal
+func (c *Cipher) open(aad, sealed []byte) ([]byte, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted content is corrupt")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	data, err := c.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("failed to decrypt, the content was changed or corrupted")
+	}
+	return data, nil
+}
+
+// sealText encrypts text for a TEXT column
+func (c *Cipher) sealText(aad []byte, content string) (string, error) {
+	sealed, err := c.seal(aad, []byte(content))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openText decrypts text sealed with sealText
+func (c *Cipher) openText(aad []byte, content string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", errors.New("encrypted content is corrupt")
+	}
+	data, err := c.open(aad, sealed)
+	return string(data), err
+}
+
+// messageAAD is authenticated with the content of a message or cached answer
+func messageAAD(id uuid.UUID) []byte {
+	return id[:]
+}
+
+// summaryAAD is authenticated with the summary of a conversation
+func summaryAAD(id uuid.UUID) []byte {
+	return append([]byte("summary\x00"), id[:]...)
+}
+
+// titleAAD is authenticated with the title of a conversation
+func titleAAD(id uuid.UUID) []byte {
+	return append([]byte("title\x00"), id[:]...)
+}
+
+// attachmentAAD is authenticated with the data of an attachment. Attachments
+// are shared by the messages they were sent with, so it binds to the hash.
+func attachmentAAD(hash string) []byte {
+	return []byte("attachment\x00" + hash)
+}
+
+// SetCipher makes the database encrypt new messages with c and decrypt the
+// ones c encrypted. A nil cipher stores new messages in plain text.
+func (db *DB) SetCipher(c *Cipher) {
+	db.cipher = c
+}
+
+// Cipher returns the cipher set with SetCipher, if any
+func (db *DB) Cipher() *Cipher {
+	return db.cipher
+}
+
+// encryptContent returns the stored form of a new message's content and the ID of the key encrypting it
+func (db *DB) encryptContent(id uuid.UUID, content string) (string, string, error) {
+	if db.cipher == nil {
+		return content, "", nil
+	}
+	sealed, err := db.cipher.sealText(messageAAD(id), content)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, db.cipher.KeyID, nil
+}
+
+// decryptContent returns the content of a stored message encrypted with keyID, if any
+func (db *DB) decryptContent(id uuid.UUID, keyID, content string) (string, error) {
+	if keyID == "" {
+		return content, nil
+	}
+	if err := checkKey(db.cipher, keyID); err != nil {
+		return "", err
+	}
+	content, err := db.cipher.openText(messageAAD(id), content)
+	if err != nil {
+		return "", fmt.Errorf("message %s: %w", id, err)
+	}
+	return content, nil
+}
+
+// encryptSummary returns the stored form of a conversation's summary and the
+// ID of the key encrypting it. An empty summary stays empty.
+func (db *DB) encryptSummary(id uuid.UUID, summary string) (string, string, error) {
+	if db.cipher == nil || summary == "" {
+		return summary, "", nil
+	}
+	sealed, err := db.cipher.sealText(summaryAAD(id), summary)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, db.cipher.KeyID, nil
+}
+
+// decryptSummary returns the summary of a conversation encrypted with keyID, if any
+func (db *DB) decryptSummary(id uuid.UUID, keyID, summary string) (string, error) {
+	if keyID == "" {
+		return summary, nil
+	}
+	if err := checkKey(db.cipher, keyID); err != nil {
+		return "", err
+	}
+	summary, err := db.cipher.openText(summaryAAD(id), summary)
+	if err != nil {
+		return "", fmt.Errorf("summary of conversation %s: %w", id, err)
+	}
+	return summary, nil
+}
+
+// encryptTitle returns the stored form of a conversation's title and the ID of the key encrypting it
+func (db *DB) encryptTitle(id uuid.UUID, title string) (string, string, error) {
+	if db.cipher == nil {
+		return title, "", nil
+	}
+	sealed, err := db.cipher.sealText(titleAAD(id), title)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, db.cipher.KeyID, nil
+}
+
+// decryptTitle returns the title of a conversation encrypted with keyID, if
+// any. Titles are listed along with others, so one that can't be read for
+// want of its key is shown as encrypted rather than failing the listing.
+func (db *DB) decryptTitle(id uuid.UUID, keyID, title string) (string, error) {
+	if keyID == "" {
+		return title, nil
+	}
+	if err := checkKey(db.cipher, keyID); err != nil {
+		return fmt.Sprintf("(encrypted with key %s)", keyID), nil
+	}
+	title, err := db.cipher.openText(titleAAD(id), title)
+	if err != nil {
+		return "", fmt.Errorf("title of conversation %s: %w", id, err)
+	}
+	return title, nil
+}
+
+// encryptAttachment returns the stored form of an attachment's data and the ID of the key encrypting it
+func (db *DB) encryptAttachment(hash string, data []byte) ([]byte, string, error) {
+	if db.cipher == nil {
+		return data, "", nil
+	}
+	sealed, err := db.cipher.seal(attachmentAAD(hash), data)
+	if err != nil {
+		return nil, "", err
+	}
+	return sealed, db.cipher.KeyID, nil
+}
+
+// decryptAttachment returns the data of an attachment encrypted with keyID, if any
+func (db *DB) decryptAttachment(hash, keyID string, data []byte) ([]byte, error) {
+	if keyID == "" {
+		return data, nil
+	}
+	if err := checkKey(db.cipher, keyID); err != nil {
+		return nil, err
+	}
+	data, err := db.cipher.open(attachmentAAD(hash), data)
+	if err != nil {
+		return nil, fmt.Errorf("attachment %s: %w", hash, err)
+	}
+	return data, nil
+}
+
+// checkKey checks that c is the key content encrypted with keyID needs
+func checkKey(c *Cipher, keyID string) error {
+	switch {
+	case c == nil:
+		return fmt.Errorf("%w: the content is encrypted with key %s, set %s to read it", ErrKeyMissing, keyID, KeyEnvVar)
+	case c.KeyID != keyID:
+		return fmt.Errorf("%w: the content is encrypted with key %s, but the configured key is %s (a different key or passphrase?)", ErrKeyMissing, keyID, c.KeyID)
+	}
+	return nil
+}
+
+// LoadKey reads the key from source. passphrase is asked for the passphrase
+// a key is derived from.
+func (db *DB) LoadKey(ctx context.Context, source KeySource, passphrase func() (string, error)) ([]byte, error) {
+	switch source.Kind {
+	case "keyring":
+		encoded, err := keyring.Get(keyringAccount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w (create one with mcg db keygen --keyring)", ErrKeyMissing, err)
+		}
+		return decodeKey(encoded)
+	case "file":
+		data, err := os.ReadFile(source.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeyMissing, err)
+		}
+		return decodeKey(string(data))
+	case "passphrase":
+		phrase, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if phrase == "" {
+			return nil, fmt.Errorf("%w: the passphrase is empty", ErrKeyMissing)
+		}
+		salt, err := db.passphraseSalt(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return scrypt.Key([]byte(phrase), salt, 1<<15, 8, 1, keySize)
+	default:
+		return nil, fmt.Errorf("invalid key source %q", source.Kind)
+	}
+}
+
+// decodeKey decodes a base64 key as written by GenerateKey
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("the encryption key isn't %d base64 encoded bytes", keySize)
+	}
+	return key, nil
+}
+
+// GenerateKey creates a random key and stores it in source, which must be
+// the keyring or a file that doesn't exist yet
+func GenerateKey(source KeySource) error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	switch source.Kind {
+	case "keyring":
+		if _, err := keyring.Get(keyringAccount); err == nil {
+			return fmt.Errorf("the keyring already holds an encryption key")
+		}
+		return keyring.Set(keyringAccount, encoded)
+	case "file":
+		file, err := os.OpenFile(source.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := file.WriteString(encoded + "\n"); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	default:
+		return fmt.Errorf("keys are only generated for the keyring or a file, a passphrase is its own key")
+	}
+}
+
+// passphraseSalt returns the salt passphrases are derived with, creating it on first use
+func (db *DB) passphraseSalt(ctx context.Context) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	_, err := db.pool.Exec(ctx,
+		"INSERT INTO settings (name, value) VALUES ('passphrase_salt', $1) ON CONFLICT (name) DO NOTHING",
+		base64.StdEncoding.EncodeToString(salt),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save the passphrase salt: %w", err)
+	}
+
+	var encoded string
+	if err := db.pool.QueryRow(ctx, "SELECT value FROM settings WHERE name = 'passphrase_salt'").Scan(&encoded); err != nil {
+		return nil, fmt.Errorf("failed to read the passphrase salt: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// sealedColumn is a TEXT column whose content is encrypted when a key is configured
+type sealedColumn struct {
+	table   string
+	key     string // Column identifying a row
+	content string
+	keyID   string // Column holding the ID of the key the content is encrypted with
+	where   string // Condition on the rows that are encrypted at all
+	aad     func(key string) ([]byte, error)
+	count   func(*ReencryptCounts) *int
+}
+
+// sealedColumns are the columns migrated to a new key, besides the attachments
+var sealedColumns = []sealedColumn{
+	{
+		table: "messages", key: "id", content: "content", keyID: "key_id", where: "TRUE",
+		aad:   uuidAAD(messageAAD),
+		count: func(c *ReencryptCounts) *int { return &c.Messages },
+	},
+	{
+		table: "conversations", key: "id", content: "summary", keyID: "summary_key_id", where: "summary <> ''",
+		aad:   uuidAAD(summaryAAD),
+		count: func(c *ReencryptCounts) *int { return &c.Summaries },
+	},
+	{
+		table: "conversations", key: "id", content: "title", keyID: "title_key_id", where: "TRUE",
+		aad:   uuidAAD(titleAAD),
+		count: func(c *ReencryptCounts) *int { return &c.Titles },
+	},
+}
+
+// uuidAAD adapts aad to rows identified by a UUID
+func uuidAAD(aad func(uuid.UUID) []byte) func(string) ([]byte, error) {
+	return func(key string) ([]byte, error) {
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return nil, err
+		}
+		return aad(id), nil
+	}
+}
+
+// ReencryptCounts counts the rows of each kind a migration went through
+type ReencryptCounts struct {
+	Messages    int
+	Attachments int
+	Summaries   int
+	Titles      int
+}
+
+// Total returns the number of rows counted
+func (c ReencryptCounts) Total() int {
+	return c.Messages + c.Attachments + c.Summaries + c.Titles
+}
+
+// ReencryptResult reports what a migration of encrypted content changed
+type ReencryptResult struct {
+	Migrated ReencryptCounts // Rows now stored with the new key, or in plain text
+	Skipped  ReencryptCounts // Rows encrypted with another key, left as they are
+}
+
+// Reencrypt migrates the messages, attachments and conversation summaries and
+// titles stored in plain text (from nil) or encrypted with from to the key of
+// to, or to plain text when to is nil. Rows are migrated in batches, so an
+// interrupted run can be resumed.
+func (db *DB) Reencrypt(ctx context.Context, from, to *Cipher) (ReencryptResult, error) {
+	var result ReencryptResult
+	fromKeyID, toKeyID := "", ""
+	if from != nil {
+		fromKeyID = from.KeyID
+	}
+	if to != nil {
+		toKeyID = to.KeyID
+	}
+	if fromKeyID == toKeyID {
+		return result, fmt.Errorf("the old and new keys are the same")
+	}
+
+	for _, column := range sealedColumns {
+		for {
+			migrated, err := db.reencryptBatch(ctx, column, from, to, fromKeyID, toKeyID)
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", column.table, err)
+			}
+			*column.count(&result.Migrated) += migrated
+			if migrated < reencryptBatch {
+				break
+			}
+		}
+
+		err := db.pool.QueryRow(ctx,
+			fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s <> $1 AND %s <> $2 AND %s", column.table, column.keyID, column.keyID, column.where),
+			fromKeyID, toKeyID,
+		).Scan(column.count(&result.Skipped))
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", column.table, err)
+		}
+	}
+
+	for {
+		migrated, err := db.reencryptAttachmentBatch(ctx, from, to, fromKeyID, toKeyID)
+		if err != nil {
+			return result, fmt.Errorf("attachments: %w", err)
+		}
+		result.Migrated.Attachments += migrated
+		if migrated < reencryptBatch {
+			break
+		}
+	}
+	err := db.pool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM attachments WHERE key_id <> $1 AND key_id <> $2", fromKeyID, toKeyID,
+	).Scan(&result.Skipped.Attachments)
+	if err != nil {
+		return result, fmt.Errorf("attachments: %w", err)
+	}
+	return result, nil
+}
+
+// reencryptBatch migrates up to reencryptBatch rows of column in one transaction
+func (db *DB) reencryptBatch(ctx context.Context, column sealedColumn, from, to *Cipher, fromKeyID, toKeyID string) (int, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		fmt.Sprintf("SELECT %s::text, %s FROM %s WHERE %s = $1 AND %s LIMIT $2 FOR UPDATE",
+			column.key, column.content, column.table, column.keyID, column.where),
+		fromKeyID, reencryptBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	type storedContent struct {
+		key     string
+		content string
+	}
+	batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storedContent, error) {
+		var stored storedContent
+		err := row.Scan(&stored.key, &stored.content)
+		return stored, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2 WHERE %s = $3", column.table, column.content, column.keyID, column.key)
+	for _, stored := range batch {
+		aad, err := column.aad(stored.key)
+		if err != nil {
+			return 0, err
+		}
+		content := stored.content
+		if from != nil {
+			if content, err = from.openText(aad, content); err != nil {
+				return 0, fmt.Errorf("%s: %w", stored.key, err)
+			}
+		}
+		if to != nil {
+			if content, err = to.sealText(aad, content); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec(ctx, update, content, toKeyID, stored.key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// reencryptAttachmentBatch migrates up to reencryptBatch attachments in one
+// transaction. The hash an attachment is stored under depends on the key, so
+// each one moves to its new hash along with the messages it is attached to.
+func (db *DB) reencryptAttachmentBatch(ctx context.Context, from, to *Cipher, fromKeyID, toKeyID string) (int, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "SELECT hash, data FROM attachments WHERE key_id = $1 LIMIT $2 FOR UPDATE", fromKeyID, reencryptBatch)
+	if err != nil {
+		return 0, err
+	}
+	type storedAttachment struct {
+		hash string
+		data []byte
+	}
+	batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storedAttachment, error) {
+		var stored storedAttachment
+		err := row.Scan(&stored.hash, &stored.data)
+		return stored, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, stored := range batch {
+		data := stored.data
+		if from != nil {
+			if data, err = from.open(attachmentAAD(stored.hash), data); err != nil {
+				return 0, fmt.Errorf("%s: %w", stored.hash, err)
+			}
+		}
+		hash := HashAttachment(data)
+		if to != nil {
+			hash = to.hash(data)
+			if data, err = to.seal(attachmentAAD(hash), data); err != nil {
+				return 0, err
+			}
+		}
+
+		// The same file may already be stored under its new hash
+		_, err = tx.Exec(ctx,
+			`INSERT INTO attachments (hash, media_type, size, data, key_id, created_at)
+			SELECT $1, media_type, size, $2, $3, created_at FROM attachments WHERE hash = $4
+			ON CONFLICT (hash) DO NOTHING`,
+			hash, data, toKeyID, stored.hash,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE message_attachments SET hash = $1 WHERE hash = $2", hash, stored.hash); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM attachments WHERE hash = $1", stored.hash); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
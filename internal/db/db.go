@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,9 +17,13 @@ import (
 type Message struct {
 	ID            uuid.UUID `json:"id"`
 	ConversationID uuid.UUID `json:"conversation_id"`
+	ParentID      uuid.NullUUID `json:"parent_id"` // Message this one replies to, unset for the first message
 	Role          string    `json:"role"`
+	Model         string    `json:"model,omitempty"` // "provider:model" that wrote an assistant message
 	Content       string    `json:"content"`
+	Cached        bool      `json:"cached,omitempty"` // Answered from the response cache
 	CreatedAt     time.Time `json:"created_at"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
 }
 
 // Conversation represents a chat conversation with an LLM
@@ -26,14 +31,28 @@ type Conversation struct {
 	ID        uuid.UUID `json:"id"`
 	Title     string    `json:"title"`
 	Model     string    `json:"model"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Messages  []Message `json:"messages,omitempty"`
+	Profile   string    `json:"profile"`
+	RepoPath  string    `json:"repo_path,omitempty"` // Root of the git repository the chat was started in
+	Summary   string    `json:"summary,omitempty"`   // Running summary of the turns folded out of the context
+	// SummaryMessageCount is the number of leading messages covered by Summary
+	SummaryMessageCount int       `json:"summary_message_count,omitempty"`
+	// ActiveMessageID is the last message of the branch the conversation continues from
+	ActiveMessageID     uuid.NullUUID `json:"active_message_id"`
+	Pinned              bool      `json:"pinned,omitempty"`   // Listed before the other conversations
+	Archived            bool      `json:"archived,omitempty"` // Hidden from the default listings
+	Tags                []string  `json:"tags,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	Messages            []Message `json:"messages,omitempty"`
 }
 
+// maxFallbackTitleRunes is the length a first message is cut to when it becomes the title
+const maxFallbackTitleRunes = 50
+
 // DB handles database operations
 type DB struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	cipher *Cipher // Encrypts message content, nil to store it in plain text
 }
 
 // Config represents database configuration
@@ -163,14 +182,113 @@ func (db *DB) Init(ctx context.Context) error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
+
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS profile TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS repo_path TEXT NOT NULL DEFAULT '';
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS summary TEXT NOT NULL DEFAULT '';
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS summary_message_count INTEGER NOT NULL DEFAULT 0;
+
+	CREATE INDEX IF NOT EXISTS idx_conversations_repo_path ON conversations(repo_path);
+
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS active_message_id UUID;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '';
+
+	-- Messages form a tree so that conversations can branch. Existing
+	-- conversations are linked up in the order their messages were created.
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'messages' AND column_name = 'parent_id') THEN
+			ALTER TABLE messages ADD COLUMN parent_id UUID REFERENCES messages(id) ON DELETE CASCADE;
+			UPDATE messages SET parent_id = linked.prev_id
+			FROM (
+				SELECT id, LAG(id) OVER (PARTITION BY conversation_id ORDER BY created_at) AS prev_id FROM messages
+			) AS linked
+			WHERE messages.id = linked.id AND linked.prev_id IS NOT NULL;
+		END IF;
+	END $$;
+
+	CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages(parent_id);
+
+	-- Attached files are stored once per content hash and linked to the messages they were sent with
+	CREATE TABLE IF NOT EXISTS attachments (
+		hash TEXT PRIMARY KEY,
+		media_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BYTEA NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS message_attachments (
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		hash TEXT NOT NULL REFERENCES attachments(hash),
+		name TEXT NOT NULL,
+		PRIMARY KEY (message_id, position)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_message_attachments_hash ON message_attachments(hash);
+
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE
+	);
+
+	CREATE TABLE IF NOT EXISTS conversation_tags (
+		conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (conversation_id, tag_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_conversation_tags_tag_id ON conversation_tags(tag_id);
+
+	CREATE INDEX IF NOT EXISTS idx_conversations_listing ON conversations(archived, pinned DESC, updated_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
+
+	-- Encrypted message content records the fingerprint of its key, plain text has none
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS key_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS idx_messages_key_id ON messages(key_id);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+
+	-- Answers to identical requests, keyed on a hash of the request
+	CREATE TABLE IF NOT EXISTS response_cache (
+		key TEXT PRIMARY KEY,
+		id UUID NOT NULL,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		content TEXT NOT NULL,
+		key_id TEXT NOT NULL DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		size INTEGER NOT NULL,
+		hits INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		used_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_response_cache_used_at ON response_cache(used_at);
+
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS cached BOOLEAN NOT NULL DEFAULT FALSE;
+
+	-- Attachments, summaries and titles are encrypted like messages
+	ALTER TABLE attachments ADD COLUMN IF NOT EXISTS key_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS summary_key_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE conversations ADD COLUMN IF NOT EXISTS title_key_id TEXT NOT NULL DEFAULT '';
 	`
 
 	_, err := db.pool.Exec(ctx, schema)
 	return err
 }
 
-// CreateConversation creates a new conversation
-func (db *DB) CreateConversation(ctx context.Context, title, model string) (Conversation, error) {
+// CreateConversation creates a new conversation. repoPath is the root of the
+// git repository it belongs to, or empty outside of a repository.
+func (db *DB) CreateConversation(ctx context.Context, title, model, profile, repoPath string) (Conversation, error) {
 	id := uuid.New()
 	now := time.Now().UTC()
 
@@ -178,13 +296,19 @@ func (db *DB) CreateConversation(ctx context.Context, title, model string) (Conv
 		ID:        id,
 		Title:     title,
 		Model:     model,
+		Profile:   profile,
+		RepoPath:  repoPath,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	_, err := db.pool.Exec(ctx,
-		"INSERT INTO conversations (id, title, model, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)",
-		conversation.ID, conversation.Title, conversation.Model, conversation.CreatedAt, conversation.UpdatedAt,
+	storedTitle, keyID, err := db.encryptTitle(id, title)
+	if err != nil {
+		return Conversation{}, err
+	}
+	_, err = db.pool.Exec(ctx,
+		"INSERT INTO conversations (id, title, title_key_id, model, profile, repo_path, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		conversation.ID, storedTitle, keyID, conversation.Model, conversation.Profile, conversation.RepoPath, conversation.CreatedAt, conversation.UpdatedAt,
 	)
 
 	return conversation, err
@@ -193,14 +317,23 @@ func (db *DB) CreateConversation(ctx context.Context, title, model string) (Conv
 // GetConversation retrieves a conversation by ID
 func (db *DB) GetConversation(ctx context.Context, id uuid.UUID) (Conversation, error) {
 	var conversation Conversation
+	var titleKeyID, summaryKeyID string
 
 	err := db.pool.QueryRow(ctx,
-		"SELECT id, title, model, created_at, updated_at FROM conversations WHERE id = $1",
+		"SELECT id, title, title_key_id, model, profile, repo_path, summary, summary_key_id, summary_message_count, active_message_id, created_at, updated_at, pinned, archived, "+tagsColumn+" FROM conversations c WHERE id = $1",
 		id,
-	).Scan(&conversation.ID, &conversation.Title, &conversation.Model, &conversation.CreatedAt, &conversation.UpdatedAt)
+	).Scan(&conversation.ID, &conversation.Title, &titleKeyID, &conversation.Model, &conversation.Profile, &conversation.RepoPath,
+		&conversation.Summary, &summaryKeyID, &conversation.SummaryMessageCount, &conversation.ActiveMessageID, &conversation.CreatedAt, &conversation.UpdatedAt,
+		&conversation.Pinned, &conversation.Archived, &conversation.Tags)
 	if err != nil {
 		return Conversation{}, err
 	}
+	if conversation.Title, err = db.decryptTitle(id, titleKeyID, conversation.Title); err != nil {
+		return Conversation{}, err
+	}
+	if conversation.Summary, err = db.decryptSummary(id, summaryKeyID, conversation.Summary); err != nil {
+		return Conversation{}, err
+	}
 
 	// Get messages for the conversation
 	messages, err := db.GetMessages(ctx, id)
@@ -208,74 +341,163 @@ func (db *DB) GetConversation(ctx context.Context, id uuid.UUID) (Conversation,
 		return Conversation{}, err
 	}
 
-	conversation.Messages = messages
+	// Only the active branch is part of the conversation as it is continued
+	conversation.Messages = ActivePath(messages, conversation.ActiveMessageID)
 	return conversation, nil
 }
 
 // UpdateConversationTitle updates the title of a conversation
 func (db *DB) UpdateConversationTitle(ctx context.Context, id uuid.UUID, title string) error {
+	title, keyID, err := db.encryptTitle(id, title)
+	if err != nil {
+		return err
+	}
 	now := time.Now().UTC()
+	_, err = db.pool.Exec(ctx,
+		"UPDATE conversations SET title = $1, title_key_id = $2, updated_at = $3 WHERE id = $4",
+		title, keyID, now, id,
+	)
+	return err
+}
+
+// UpdateConversationModel records the backend a conversation continues with
+func (db *DB) UpdateConversationModel(ctx context.Context, id uuid.UUID, model string) error {
+	_, err := db.pool.Exec(ctx,
+		"UPDATE conversations SET model = $1 WHERE id = $2",
+		model, id,
+	)
+	return err
+}
+
+// UpdateConversationProfile records the profile used by a conversation
+func (db *DB) UpdateConversationProfile(ctx context.Context, id uuid.UUID, profile string) error {
+	_, err := db.pool.Exec(ctx,
+		"UPDATE conversations SET profile = $1 WHERE id = $2",
+		profile, id,
+	)
+	return err
+}
+
+// UpdateConversationSummary stores the running summary of a conversation and
+// the number of leading messages it covers
+func (db *DB) UpdateConversationSummary(ctx context.Context, id uuid.UUID, summary string, messageCount int) error {
+	summary, keyID, err := db.encryptSummary(id, summary)
+	if err != nil {
+		return err
+	}
+	_, err = db.pool.Exec(ctx,
+		"UPDATE conversations SET summary = $1, summary_key_id = $2, summary_message_count = $3 WHERE id = $4",
+		summary, keyID, messageCount, id,
+	)
+	return err
+}
+
+// SetActiveMessage selects the branch a conversation continues from by its last message
+func (db *DB) SetActiveMessage(ctx context.Context, id uuid.UUID, messageID uuid.UUID) error {
 	_, err := db.pool.Exec(ctx,
-		"UPDATE conversations SET title = $1, updated_at = $2 WHERE id = $3",
-		title, now, id,
+		"UPDATE conversations SET active_message_id = $1 WHERE id = $2",
+		messageID, id,
 	)
 	return err
 }
 
 // DeleteConversation deletes a conversation by ID
 func (db *DB) DeleteConversation(ctx context.Context, id uuid.UUID) error {
-	_, err := db.pool.Exec(ctx, "DELETE FROM conversations WHERE id = $1", id)
+	_, err := db.DeleteConversations(ctx, ConversationFilter{IDs: []uuid.UUID{id}, AnyArchived: true}, false)
 	return err
 }
 
-// ListConversations retrieves a list of all conversations
+// tagsColumn selects the sorted tag names of the conversation aliased c
+const tagsColumn = `COALESCE((SELECT array_agg(t.name ORDER BY t.name) FROM conversation_tags ct
+	JOIN tags t ON t.id = ct.tag_id WHERE ct.conversation_id = c.id), '{}') AS tags`
+
+// conversationColumns are the columns read by scanConversations
+const conversationColumns = "c.id, c.title, c.title_key_id, c.model, c.profile, c.repo_path, c.created_at, c.updated_at, c.pinned, c.archived, " + tagsColumn
+
+// ListConversations retrieves a list of all conversations, archived or not,
+// pinned conversations first
 func (db *DB) ListConversations(ctx context.Context) ([]Conversation, error) {
 	rows, err := db.pool.Query(ctx,
-		"SELECT id, title, model, created_at, updated_at FROM conversations ORDER BY updated_at DESC",
+		"SELECT "+conversationColumns+" FROM conversations c ORDER BY c.pinned DESC, c.updated_at DESC",
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	return db.scanConversations(rows)
+}
+
+// scanConversations reads conversation rows and closes them
+func (db *DB) scanConversations(rows pgx.Rows) ([]Conversation, error) {
 	defer rows.Close()
 
 	var conversations []Conversation
 	for rows.Next() {
 		var conversation Conversation
-		err := rows.Scan(&conversation.ID, &conversation.Title, &conversation.Model, &conversation.CreatedAt, &conversation.UpdatedAt)
+		var titleKeyID string
+		err := rows.Scan(&conversation.ID, &conversation.Title, &titleKeyID, &conversation.Model, &conversation.Profile, &conversation.RepoPath, &conversation.CreatedAt, &conversation.UpdatedAt,
+			&conversation.Pinned, &conversation.Archived, &conversation.Tags)
 		if err != nil {
 			return nil, err
 		}
+		if conversation.Title, err = db.decryptTitle(conversation.ID, titleKeyID, conversation.Title); err != nil {
+			return nil, err
+		}
 		conversations = append(conversations, conversation)
 	}
 
 	return conversations, rows.Err()
 }
 
-// AddMessage adds a new message to a conversation
-func (db *DB) AddMessage(ctx context.Context, conversationID uuid.UUID, role, content string) (Message, error) {
+// AddMessage adds a new message to the end of the conversation's active branch.
+// model is the backend that wrote an assistant message, empty for user messages.
+func (db *DB) AddMessage(ctx context.Context, conversationID uuid.UUID, role, model, content string) (Message, error) {
+	// Conversations saved before branching have no active message, they continue from the latest one
+	var parentID uuid.NullUUID
+	err := db.pool.QueryRow(ctx,
+		`SELECT COALESCE(c.active_message_id, (SELECT id FROM messages WHERE conversation_id = c.id ORDER BY created_at DESC LIMIT 1))
+		FROM conversations c WHERE c.id = $1`,
+		conversationID,
+	).Scan(&parentID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return db.AddReply(ctx, conversationID, parentID, role, model, content)
+}
+
+// AddReply adds a new message replying to parentID and makes it the end of the
+// active branch. Replying to a message that already has replies starts a new branch.
+func (db *DB) AddReply(ctx context.Context, conversationID uuid.UUID, parentID uuid.NullUUID, role, model, content string) (Message, error) {
 	id := uuid.New()
 	now := time.Now().UTC()
 
 	message := Message{
 		ID:            id,
 		ConversationID: conversationID,
+		ParentID:      parentID,
 		Role:          role,
+		Model:         model,
 		Content:       content,
 		CreatedAt:     now,
 	}
 
-	_, err := db.pool.Exec(ctx,
-		"INSERT INTO messages (id, conversation_id, role, content, created_at) VALUES ($1, $2, $3, $4, $5)",
-		message.ID, message.ConversationID, message.Role, message.Content, message.CreatedAt,
+	content, keyID, err := db.encryptContent(message.ID, message.Content)
+	if err != nil {
+		return Message{}, err
+	}
+	_, err = db.pool.Exec(ctx,
+		"INSERT INTO messages (id, conversation_id, parent_id, role, model, content, key_id, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		message.ID, message.ConversationID, message.ParentID, message.Role, message.Model, content, keyID, message.CreatedAt,
 	)
 	if err != nil {
 		return Message{}, err
 	}
 
-	// Update the conversation's updated_at timestamp
+	// Update the conversation's updated_at timestamp and active branch
 	_, err = db.pool.Exec(ctx,
-		"UPDATE conversations SET updated_at = $1 WHERE id = $2",
-		now, conversationID,
+		"UPDATE conversations SET updated_at = $1, active_message_id = $2 WHERE id = $3",
+		now, message.ID, conversationID,
 	)
 	if err != nil {
 		return Message{}, err
@@ -284,10 +506,10 @@ func (db *DB) AddMessage(ctx context.Context, conversationID uuid.UUID, role, co
 	return message, nil
 }
 
-// GetMessages retrieves all messages for a conversation
+// GetMessages retrieves all messages for a conversation across all branches
 func (db *DB) GetMessages(ctx context.Context, conversationID uuid.UUID) ([]Message, error) {
 	rows, err := db.pool.Query(ctx,
-		"SELECT id, conversation_id, role, content, created_at FROM messages WHERE conversation_id = $1 ORDER BY created_at ASC",
+		"SELECT id, conversation_id, parent_id, role, model, content, key_id, cached, created_at FROM messages WHERE conversation_id = $1 ORDER BY created_at ASC",
 		conversationID,
 	)
 	if err != nil {
@@ -298,36 +520,53 @@ func (db *DB) GetMessages(ctx context.Context, conversationID uuid.UUID) ([]Mess
 	var messages []Message
 	for rows.Next() {
 		var message Message
-		err := rows.Scan(&message.ID, &message.ConversationID, &message.Role, &message.Content, &message.CreatedAt)
+		var keyID string
+		err := rows.Scan(&message.ID, &message.ConversationID, &message.ParentID, &message.Role, &message.Model, &message.Content, &keyID, &message.Cached, &message.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if message.Content, err = db.decryptContent(message.ID, keyID, message.Content); err != nil {
+			return nil, err
+		}
 		messages = append(messages, message)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return messages, rows.Err()
+	if err := db.loadAttachments(ctx, conversationID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
 }
 
-// GenerateTitle uses the first user message to generate a title for the conversation
+// GenerateTitle titles the conversation after its first user message. It is
+// the fallback for when no model can write a title.
 func (db *DB) GenerateTitle(ctx context.Context, conversationID uuid.UUID) (string, error) {
 	// Get the first user message
-	var content string
+	var id uuid.UUID
+	var content, keyID string
 	err := db.pool.QueryRow(ctx,
-		"SELECT content FROM messages WHERE conversation_id = $1 AND role = 'user' ORDER BY created_at ASC LIMIT 1",
+		"SELECT id, content, key_id FROM messages WHERE conversation_id = $1 AND role = 'user' ORDER BY created_at ASC LIMIT 1",
 		conversationID,
-	).Scan(&content)
+	).Scan(&id, &content, &keyID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return "New Conversation", nil
 		}
 		return "", err
 	}
+	if content, err = db.decryptContent(id, keyID, content); err != nil {
+		return "", err
+	}
 
-	// Create a title from the message
-	// For now, just truncate the first message; later we could use an LLM to generate a better title
-	title := content
-	if len(title) > 50 {
-		title = title[:47] + "..."
+	// Create a title from the message, cut on a character boundary
+	title := strings.Join(strings.Fields(content), " ")
+	if title == "" {
+		return "New Conversation", nil
+	}
+	if runes := []rune(title); len(runes) > maxFallbackTitleRunes {
+		title = strings.TrimSpace(string(runes[:maxFallbackTitleRunes-3])) + "..."
 	}
 
 	// Update the conversation title
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DeleteResult reports what a bulk deletion removed, or would remove
+type DeleteResult struct {
+	Conversations int
+	Messages      int
+	Attachments   int   // Stored files no remaining message uses
+	Bytes         int64 // Size of the message text and files, roughly the space freed
+}
+
+// deleteStatsQuery measures the conversations in "doomed", their messages and
+// the attachment data only they use
+const deleteStatsQuery = `
+	SELECT
+		(SELECT COUNT(*) FROM doomed),
+		COUNT(m.id),
+		COALESCE(SUM(octet_length(m.content)), 0),
+		(SELECT COUNT(*) FROM orphaned),
+		(SELECT COALESCE(SUM(size), 0) FROM orphaned)
+	FROM messages m
+	WHERE m.conversation_id IN (SELECT id FROM doomed)`
+
+// orphanedAttachments selects the attachments only used by the conversations in "doomed"
+const orphanedAttachments = `
+	orphaned AS (
+		SELECT a.hash, a.size FROM attachments a
+		WHERE EXISTS (SELECT 1 FROM message_attachments ma JOIN messages m ON m.id = ma.message_id
+			WHERE ma.hash = a.hash AND m.conversation_id IN (SELECT id FROM doomed))
+		AND NOT EXISTS (SELECT 1 FROM message_attachments ma JOIN messages m ON m.id = ma.message_id
+			WHERE ma.hash = a.hash AND m.conversation_id NOT IN (SELECT id FROM doomed))
+	)`
+
+// DeleteConversations deletes the conversations matching filter with their
+// messages, and the attachment data and tags nothing else uses. The limit and
+// offset of filter are ignored. With dryRun nothing is deleted and the result
+// tells what would be.
+func (db *DB) DeleteConversations(ctx context.Context, filter ConversationFilter, dryRun bool) (DeleteResult, error) {
+	if filter.Query != "" {
+		// Encrypted titles are matched once decrypted, so the matches are picked by ID
+		filter.Limit, filter.Offset = 0, 0
+		matches, err := db.FindConversations(ctx, filter)
+		if err != nil {
+			return DeleteResult{}, fmt.Errorf("failed to find conversations: %w", err)
+		}
+		ids := make([]uuid.UUID, len(matches))
+		for i, conversation := range matches {
+			ids[i] = conversation.ID
+		}
+		filter = ConversationFilter{IDs: ids, AnyArchived: true}
+	}
+	where, args := filter.where()
+	doomed := "WITH doomed AS (SELECT c.id FROM conversations c" + where + "),"
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to delete conversations: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var result DeleteResult
+	var messageBytes, attachmentBytes int64
+	err = tx.QueryRow(ctx, doomed+orphanedAttachments+deleteStatsQuery, args...).Scan(
+		&result.Conversations, &result.Messages, &messageBytes, &result.Attachments, &attachmentBytes,
+	)
+	if err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to measure conversations: %w", err)
+	}
+	result.Bytes = messageBytes + attachmentBytes
+	if dryRun || result.Conversations == 0 {
+		return result, nil
+	}
+
+	// Messages and their links to attachments and tags cascade
+	if _, err := tx.Exec(ctx, "DELETE FROM conversations c"+where, args...); err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to delete conversations: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM attachments a WHERE NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.hash = a.hash)"); err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to delete unused attachments: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM tags t WHERE NOT EXISTS (SELECT 1 FROM conversation_tags ct WHERE ct.tag_id = t.id)"); err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to delete unused tags: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return DeleteResult{}, fmt.Errorf("failed to delete conversations: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxIDCandidates is the number of matches listed when a short ID is ambiguous
+const maxIDCandidates = 10
+
+// ErrConversationNotFound is returned when no conversation has the given ID
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// AmbiguousIDError is returned when a short ID matches several conversations
+type AmbiguousIDError struct {
+	Prefix     string
+	Candidates []Conversation // The most recently updated matches
+	More       bool           // Whether there are more matches than Candidates
+}
+
+func (e *AmbiguousIDError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "conversation ID %s is ambiguous, it matches:", e.Prefix)
+	for _, conversation := range e.Candidates {
+		fmt.Fprintf(&sb, "\n  %s  %s", conversation.ID.String()[:13], conversation.Title)
+	}
+	if e.More {
+		sb.WriteString("\n  ...")
+	}
+	sb.WriteString("\nType more of the ID to pick one")
+	return sb.String()
+}
+
+// ConversationFilter selects the conversations to list
+type ConversationFilter struct {
+	IDs         []uuid.UUID // Only these conversations
+	Tag         string      // Only conversations with this tag
+	RepoPath    string      // Only conversations started in this repository
+	Archived    bool        // List the archived conversations instead of the others
+	AnyArchived bool        // Match archived and other conversations alike, ignoring Archived
+	Unpinned    bool        // Leave out the pinned conversations
+	Since       time.Time   // Only conversations updated since then
+	Before      time.Time   // Only conversations last updated before then
+	Model       string      // Only conversations with this provider, or "provider:model"
+	Query       string      // Only conversations whose title contains this, ignoring case
+	Limit       int         // Maximum number of conversations, 0 for no limit
+	Offset      int         // Number of conversations to skip
+}
+
+// where returns the WHERE clause selecting the conversations aliased c and its arguments
+func (f ConversationFilter) where() (string, []any) {
+	var args []any
+	var conditions []string
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !f.AnyArchived {
+		add("c.archived = $%d", f.Archived)
+	}
+	if f.Unpinned {
+		conditions = append(conditions, "NOT c.pinned")
+	}
+	if f.IDs != nil {
+		add("c.id = ANY($%d)", f.IDs)
+	}
+	if f.RepoPath != "" {
+		add("c.repo_path = $%d", f.RepoPath)
+	}
+	if f.Tag != "" {
+		add(`EXISTS (SELECT 1 FROM conversation_tags ct JOIN tags t ON t.id = ct.tag_id
+			WHERE ct.conversation_id = c.id AND t.name = $%d)`, NormalizeTag(f.Tag))
+	}
+	if !f.Since.IsZero() {
+		add("c.updated_at >= $%d", f.Since)
+	}
+	if !f.Before.IsZero() {
+		add("c.updated_at < $%d", f.Before)
+	}
+	if f.Model != "" {
+		// A provider also matches the conversations that picked one of its models
+		args = append(args, f.Model, escapeLike(f.Model)+":%")
+		conditions = append(conditions, fmt.Sprintf("(c.model = $%d OR c.model LIKE $%d)", len(args)-1, len(args)))
+	}
+	if f.Query != "" {
+		// Encrypted titles can only be matched once decrypted, by matchTitles
+		add("(c.title_key_id <> '' OR c.title ILIKE '%%' || $%d || '%%')", escapeLike(f.Query))
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// FindConversations retrieves the conversations matching filter, pinned
+// conversations first and then the most recently updated
+func (db *DB) FindConversations(ctx context.Context, filter ConversationFilter) ([]Conversation, error) {
+	where, args := filter.where()
+	query := "SELECT " + conversationColumns + " FROM conversations c" + where + " ORDER BY c.pinned DESC, c.updated_at DESC"
+	// The page is cut after titles are matched when they have to be decrypted first
+	paged := filter.Query == ""
+	if paged && filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if paged && filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := db.scanConversations(rows)
+	if err != nil || paged {
+		return conversations, err
+	}
+	conversations = filter.matchTitles(conversations)
+	if filter.Offset > 0 {
+		conversations = conversations[min(filter.Offset, len(conversations)):]
+	}
+	if filter.Limit > 0 && len(conversations) > filter.Limit {
+		conversations = conversations[:filter.Limit]
+	}
+	return conversations, nil
+}
+
+// matchTitles returns the conversations whose title contains the query, ignoring case
+func (f ConversationFilter) matchTitles(conversations []Conversation) []Conversation {
+	query := strings.ToLower(f.Query)
+	var matches []Conversation
+	for _, conversation := range conversations {
+		if strings.Contains(strings.ToLower(conversation.Title), query) {
+			matches = append(matches, conversation)
+		}
+	}
+	return matches
+}
+
+// CountConversations counts the conversations matching filter, ignoring its limit and offset
+func (db *DB) CountConversations(ctx context.Context, filter ConversationFilter) (int, error) {
+	if filter.Query != "" {
+		filter.Limit, filter.Offset = 0, 0
+		conversations, err := db.FindConversations(ctx, filter)
+		return len(conversations), err
+	}
+	where, args := filter.where()
+	var count int
+	err := db.pool.QueryRow(ctx, "SELECT COUNT(*) FROM conversations c"+where, args...).Scan(&count)
+	return count, err
+}
+
+// FindConversationsByIDPrefix retrieves up to limit conversations whose ID starts
+// with prefix, most recently updated first. The ID range is looked up in the
+// primary key index rather than by comparing every ID as text.
+func (db *DB) FindConversationsByIDPrefix(ctx context.Context, prefix string, limit int) ([]Conversation, error) {
+	low, high, err := idPrefixRange(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.Query(ctx,
+		"SELECT "+conversationColumns+" FROM conversations c WHERE c.id BETWEEN $1 AND $2 ORDER BY c.updated_at DESC LIMIT $3",
+		low, high, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.scanConversations(rows)
+}
+
+// ResolveConversationID finds the conversation with a full ID or an ID prefix.
+// A prefix matching several conversations returns an *AmbiguousIDError.
+func (db *DB) ResolveConversationID(ctx context.Context, prefix string) (uuid.UUID, error) {
+	matches, err := db.FindConversationsByIDPrefix(ctx, prefix, maxIDCandidates+1)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	switch len(matches) {
+	case 0:
+		return uuid.Nil, fmt.Errorf("%w: no conversation ID starts with %s", ErrConversationNotFound, prefix)
+	case 1:
+		return matches[0].ID, nil
+	default:
+		ambiguous := &AmbiguousIDError{Prefix: prefix, Candidates: matches}
+		if len(matches) > maxIDCandidates {
+			ambiguous.Candidates = matches[:maxIDCandidates]
+			ambiguous.More = true
+		}
+		return uuid.Nil, ambiguous
+	}
+}
+
+// idPrefixRange returns the lowest and highest UUIDs starting with prefix
+func idPrefixRange(prefix string) (uuid.UUID, uuid.UUID, error) {
+	hex := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(prefix), "-", ""))
+	if hex == "" || len(hex) > 32 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid conversation ID: %s", prefix)
+	}
+
+	low, err := uuid.Parse(hex + strings.Repeat("0", 32-len(hex)))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid conversation ID: %s", prefix)
+	}
+	high, err := uuid.Parse(hex + strings.Repeat("f", 32-len(hex)))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid conversation ID: %s", prefix)
+	}
+	return low, high, nil
+}
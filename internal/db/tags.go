@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// NormalizeTag returns the form a tag is stored in: lower case, without a leading '#'
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// ValidateTag checks that a normalized tag is a single word
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tags can't be empty")
+	}
+	for _, r := range tag {
+		if unicode.IsSpace(r) || r == ',' || r == '#' {
+			return fmt.Errorf("invalid tag %q: tags can't contain spaces, commas or '#'", tag)
+		}
+	}
+	return nil
+}
+
+// UpdateConversationTags adds and removes tags of a conversation and returns the resulting tags
+func (db *DB) UpdateConversationTags(ctx context.Context, id uuid.UUID, add, remove []string) ([]string, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, tag := range add {
+		tag = NormalizeTag(tag)
+		if err := ValidateTag(tag); err != nil {
+			return nil, err
+		}
+		var tagID int
+		err := tx.QueryRow(ctx,
+			"INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id",
+			tag,
+		).Scan(&tagID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO conversation_tags (conversation_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			id, tagID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tag := range remove {
+		_, err := tx.Exec(ctx,
+			"DELETE FROM conversation_tags WHERE conversation_id = $1 AND tag_id = (SELECT id FROM tags WHERE name = $2)",
+			id, NormalizeTag(tag),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Tags no conversation uses anymore are dropped
+	if len(remove) > 0 {
+		_, err := tx.Exec(ctx, "DELETE FROM tags t WHERE NOT EXISTS (SELECT 1 FROM conversation_tags ct WHERE ct.tag_id = t.id)")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tags []string
+	err = tx.QueryRow(ctx, "SELECT "+tagsColumn+" FROM conversations c WHERE c.id = $1", id).Scan(&tags)
+	if err != nil {
+		return nil, err
+	}
+	return tags, tx.Commit(ctx)
+}
+
+// SetConversationPinned pins a conversation to the top of the listings, or unpins it
+func (db *DB) SetConversationPinned(ctx context.Context, id uuid.UUID, pinned bool) error {
+	_, err := db.pool.Exec(ctx, "UPDATE conversations SET pinned = $1 WHERE id = $2", pinned, id)
+	return err
+}
+
+// SetConversationArchived hides a conversation from the default listings, or brings it back
+func (db *DB) SetConversationArchived(ctx context.Context, id uuid.UUID, archived bool) error {
+	_, err := db.pool.Exec(ctx, "UPDATE conversations SET archived = $1 WHERE id = $2", archived, id)
+	return err
+}
+
+// ListTags returns every tag in use with the number of conversations that have it
+func (db *DB) ListTags(ctx context.Context) (map[string]int, error) {
+	rows, err := db.pool.Query(ctx,
+		"SELECT t.name, COUNT(ct.conversation_id) FROM tags t JOIN conversation_tags ct ON ct.tag_id = t.id GROUP BY t.name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		tags[name] = count
+	}
+	return tags, rows.Err()
+}
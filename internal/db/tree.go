@@ -0,0 +1,67 @@
+package db
+
+import "github.com/google/uuid"
+
+// Children groups messages by the message they reply to, keeping their order.
+// The first messages of a conversation are grouped under uuid.Nil.
+func Children(messages []Message) map[uuid.UUID][]Message {
+	children := make(map[uuid.UUID][]Message)
+	for _, message := range messages {
+		parent := uuid.Nil
+		if message.ParentID.Valid {
+			parent = message.ParentID.UUID
+		}
+		children[parent] = append(children[parent], message)
+	}
+	return children
+}
+
+// ActivePath returns the branch ending at leafID, from the first message down.
+// The messages must be ordered by creation time; when leafID isn't one of them
+// the most recently created message is used.
+func ActivePath(messages []Message, leafID uuid.NullUUID) []Message {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]Message, len(messages))
+	for _, message := range messages {
+		byID[message.ID] = message
+	}
+
+	leaf, ok := byID[leafID.UUID]
+	if !leafID.Valid || !ok {
+		leaf = messages[len(messages)-1]
+	}
+
+	path := []Message{leaf}
+	for leaf.ParentID.Valid {
+		parent, ok := byID[leaf.ParentID.UUID]
+		if !ok {
+			break
+		}
+		path = append(path, parent)
+		leaf = parent
+	}
+
+	// The path was collected from the leaf up
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// FirstExchange returns the first question on a branch and the answer to it,
+// the answer being empty when there is none yet
+func FirstExchange(branch []Message) (string, string) {
+	var question, answer string
+	for _, message := range branch {
+		if question == "" && message.Role == "user" {
+			question = message.Content
+		} else if question != "" && message.Role == "assistant" {
+			answer = message.Content
+			break
+		}
+	}
+	return question, answer
+}
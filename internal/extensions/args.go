@@ -0,0 +1,85 @@
+package extensions
+
+import (
+	"reflect"
+)
+
+// ArgKind describes what kind of value a command argument expects
+type ArgKind string
+
+const (
+	// ArgString is a free-form string argument
+	ArgString ArgKind = "string"
+	// ArgPath is a path to a file or directory
+	ArgPath ArgKind = "path"
+	// ArgDir is a path to a directory
+	ArgDir ArgKind = "dir"
+	// ArgEnum is one of a fixed set of choices
+	ArgEnum ArgKind = "enum"
+)
+
+// Arg describes a single positional argument of a command
+type Arg struct {
+	Name     string
+	Kind     ArgKind
+	Choices  []string // Only used for ArgEnum
+	Optional bool
+}
+
+// ArgSchema is an optional interface for commands that describe their arguments.
+// The chat TUI uses it to offer argument completion.
+type ArgSchema interface {
+	Args() []Arg
+}
+
+// GetArgs returns the argument schema for a command, or nil if the command
+// doesn't declare one
+func (m *Manager) GetArgs(extName, cmdName string) []Arg {
+	cmd, ok := m.commands[extName][cmdName]
+	if !ok {
+		return nil
+	}
+
+	schema, ok := cmd.(ArgSchema)
+	if !ok {
+		return nil
+	}
+
+	return schema.Args()
+}
+
+// convertToArgs converts a slice of plugin-defined argument structs to Args.
+// Plugins can't return our Arg type directly, so the fields are read by name.
+func convertToArgs(value interface{}) []Arg {
+	var args []Arg
+	for _, item := range convertToInterfaceSlice(value) {
+		itemVal := reflect.Indirect(reflect.ValueOf(item))
+		if itemVal.Kind() != reflect.Struct {
+			continue
+		}
+
+		var arg Arg
+		if f := itemVal.FieldByName("Name"); f.IsValid() && f.Kind() == reflect.String {
+			arg.Name = f.String()
+		}
+		if f := itemVal.FieldByName("Kind"); f.IsValid() && f.Kind() == reflect.String {
+			arg.Kind = ArgKind(f.String())
+		}
+		if f := itemVal.FieldByName("Choices"); f.IsValid() && f.Kind() == reflect.Slice {
+			for i := 0; i < f.Len(); i++ {
+				if choice := f.Index(i); choice.Kind() == reflect.String {
+					arg.Choices = append(arg.Choices, choice.String())
+				}
+			}
+		}
+		if f := itemVal.FieldByName("Optional"); f.IsValid() && f.Kind() == reflect.Bool {
+			arg.Optional = f.Bool()
+		}
+
+		if arg.Kind == "" {
+			arg.Kind = ArgString
+		}
+		args = append(args, arg)
+	}
+	return args
+}
@@ -2,6 +2,7 @@ package extensions
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"plugin"
@@ -27,6 +28,7 @@ type Manager struct {
 	extensions map[string]Extension
 	commands   map[string]map[string]Command // map[extensionName][commandName]Command
 	enabled    bool
+	out        io.Writer // Where loading progress is reported
 }
 
 // NewManager creates a new extension manager
@@ -35,13 +37,20 @@ func NewManager(enabled bool) *Manager {
 		extensions: make(map[string]Extension),
 		commands:   make(map[string]map[string]Command),
 		enabled:    enabled,
+		out:        os.Stdout,
 	}
 }
 
+// SetOutput sets where the manager reports loading progress.
+// Use io.Discard to keep stdout clean, e.g. for shell completion.
+func (m *Manager) SetOutput(w io.Writer) {
+	m.out = w
+}
+
 // LoadExtensions loads extensions from the extensions directory
 func (m *Manager) LoadExtensions() error {
 	if !m.enabled {
-		fmt.Println("Extensions are disabled")
+		fmt.Fprintln(m.out, "Extensions are disabled")
 		return nil
 	}
 
@@ -82,7 +91,7 @@ func (m *Manager) LoadExtensions() error {
 	}
 	
 	if !pluginsLoaded {
-		fmt.Println("No plugin extensions loaded. Using built-in extensions only.")
+		fmt.Fprintln(m.out, "No plugin extensions loaded. Using built-in extensions only.")
 	}
 
 	return nil
@@ -109,7 +118,7 @@ func (m *Manager) LoadExtension(path string) error {
 	}
 	
 	// For debugging
-	fmt.Printf("Extension type: %T\n", extValue)
+	fmt.Fprintf(m.out, "Extension type: %T\n", extValue)
 	
 	// Try to use reflection to check if it has the required methods
 	extName, err := callExtensionMethod(extValue, "Name")
@@ -156,25 +165,25 @@ func (m *Manager) LoadExtension(path string) error {
 	for _, cmdValue := range cmdSlice {
 		cmdName, err := callExtensionMethod(cmdValue, "Name")
 		if err != nil {
-			fmt.Printf("Warning: command doesn't implement Name(): %v\n", err)
+			fmt.Fprintf(m.out, "Warning: command doesn't implement Name(): %v\n", err)
 			continue
 		}
 		
 		cmdNameStr, ok := cmdName.(string)
 		if !ok {
-			fmt.Printf("Warning: command's Name() doesn't return a string\n")
+			fmt.Fprintf(m.out, "Warning: command's Name() doesn't return a string\n")
 			continue
 		}
 		
 		cmdDesc, err := callExtensionMethod(cmdValue, "Description")
 		if err != nil {
-			fmt.Printf("Warning: command %s doesn't implement Description(): %v\n", cmdNameStr, err)
+			fmt.Fprintf(m.out, "Warning: command %s doesn't implement Description(): %v\n", cmdNameStr, err)
 			continue
 		}
 		
 		cmdDescStr, ok := cmdDesc.(string)
 		if !ok {
-			fmt.Printf("Warning: command %s's Description() doesn't return a string\n", cmdNameStr)
+			fmt.Fprintf(m.out, "Warning: command %s's Description() doesn't return a string\n", cmdNameStr)
 			continue
 		}
 		
@@ -190,7 +199,7 @@ func (m *Manager) LoadExtension(path string) error {
 	m.extensions[name] = wrapper
 	m.commands[name] = commands
 
-	fmt.Printf("Loaded extension: %s - %s\n", name, description)
+	fmt.Fprintf(m.out, "Loaded extension: %s - %s\n", name, description)
 	return nil
 }
 
@@ -15,12 +15,12 @@ func (m *Manager) LoadSimpleExtensions() {
 	
 	// Add commands
 	m.commands[sysExt.Name()] = map[string]Command{
-		"ls":   &SimpleCommand{name: "ls", description: "List files in a directory", execute: commandLS},
+		"ls":   &SimpleCommand{name: "ls", description: "List files in a directory", execute: commandLS, args: lsArgs},
 		"pwd":  &SimpleCommand{name: "pwd", description: "Print working directory", execute: commandPWD},
-		"read": &SimpleCommand{name: "read", description: "Read file contents", execute: commandRead},
+		"read": &SimpleCommand{name: "read", description: "Read file contents", execute: commandRead, args: readArgs},
 	}
 	
-	fmt.Printf("Loaded built-in extension: %s - %s\n", sysExt.Name(), sysExt.Description())
+	fmt.Fprintf(m.out, "Loaded built-in extension: %s - %s\n", sysExt.Name(), sysExt.Description())
 }
 
 // SimpleExtension is a basic built-in extension
@@ -39,17 +39,24 @@ func (e *SimpleExtension) Description() string {
 // Commands returns the extension commands
 func (e *SimpleExtension) Commands() []Command {
 	return []Command{
-		&SimpleCommand{name: "ls", description: "List files in a directory", execute: commandLS},
+		&SimpleCommand{name: "ls", description: "List files in a directory", execute: commandLS, args: lsArgs},
 		&SimpleCommand{name: "pwd", description: "Print working directory", execute: commandPWD},
-		&SimpleCommand{name: "read", description: "Read file contents", execute: commandRead},
+		&SimpleCommand{name: "read", description: "Read file contents", execute: commandRead, args: readArgs},
 	}
 }
 
+// Argument schemas for the built-in commands
+var (
+	lsArgs   = []Arg{{Name: "path", Kind: ArgDir, Optional: true}}
+	readArgs = []Arg{{Name: "path", Kind: ArgPath}}
+)
+
 // SimpleCommand is a basic command
 type SimpleCommand struct {
 	name        string
 	description string
 	execute     func(args []string) (string, error)
+	args        []Arg
 }
 
 // Name returns the command name
@@ -67,6 +74,11 @@ func (c *SimpleCommand) Execute(args []string) (string, error) {
 	return c.execute(args)
 }
 
+// Args returns the command's argument schema
+func (c *SimpleCommand) Args() []Arg {
+	return c.args
+}
+
 // commandPWD implements the pwd command
 func commandPWD(args []string) (string, error) {
 	dir, err := os.Getwd()
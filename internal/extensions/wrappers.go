@@ -101,6 +101,16 @@ func (w *CommandWrapper) Execute(args []string) (string, error) {
 	return resultStr, nil
 }
 
+// Args returns the argument schema of the wrapped command, if it declares one
+func (w *CommandWrapper) Args() []Arg {
+	result, err := callExtensionMethod(w.value, "Args")
+	if err != nil {
+		return nil
+	}
+	
+	return convertToArgs(result)
+}
+
 // callExtensionMethod calls a method on an extension or command using reflection
 func callExtensionMethod(value interface{}, methodName string) (interface{}, error) {
 	return callExtensionMethodWithArgs(value, methodName, nil)
@@ -0,0 +1,97 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Service is the name secrets are stored under in the keyring
+const Service = "mcgraph"
+
+// ErrNotFound is returned when the keyring has no secret for an account
+var ErrNotFound = errors.New("secret not found in the keyring")
+
+// ErrUnavailable is returned when there is no keyring program for the platform
+var ErrUnavailable = errors.New("no OS keyring available (needs security on macOS or secret-tool on Linux)")
+
+// Get reads the secret of account from the OS keyring
+func Get(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin" && available("security"):
+		cmd = exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w")
+	case runtime.GOOS != "windows" && available("secret-tool"):
+		cmd = exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	default:
+		return "", ErrUnavailable
+	}
+
+	out, err := cmd.Output()
+	secret := strings.TrimRight(string(out), "\r\n")
+	if err != nil || secret == "" {
+		// Both programs fail when nothing is stored, without telling why apart
+		return "", fmt.Errorf("%w: %s", ErrNotFound, account)
+	}
+	return secret, nil
+}
+
+// Set stores the secret of account in the OS keyring, replacing any previous one
+func Set(account, secret string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin" && available("security"):
+		// The secret goes through stdin, hex encoded, as arguments are visible to other users in ps
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", Service, account, hex.EncodeToString([]byte(secret))))
+	case runtime.GOOS != "windows" && available("secret-tool"):
+		cmd = exec.Command("secret-tool", "store", "--label", Service+" "+account, "service", Service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return ErrUnavailable
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Delete removes the secret of account from the OS keyring
+func Delete(account string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin" && available("security"):
+		cmd = exec.Command("security", "delete-generic-password", "-s", Service, "-a", account)
+	case runtime.GOOS != "windows" && available("secret-tool"):
+		cmd = exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	default:
+		return ErrUnavailable
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Available reports whether the platform has a keyring program to store secrets with
+func Available() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		return available("security")
+	case "windows":
+		return false
+	default:
+		return available("secret-tool")
+	}
+}
+
+// available reports whether a program is on the PATH
+func available(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
@@ -7,29 +7,49 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 )
 
-const anthropicAPI = "https://api.anthropic.com/v1/messages"
+// claudeModel is the Claude model used unless another one is selected
+const claudeModel = "claude-3-sonnet-20240229"
 
 // AnthropicRequest represents the request structure for Anthropic API
 type AnthropicRequest struct {
-	Model     string     `json:"model"`
-	MaxTokens int        `json:"max_tokens"`
-	System    string     `json:"system"`
-	Messages  []Message  `json:"messages"`
+	Model         string     `json:"model"`
+	MaxTokens     int        `json:"max_tokens"`
+	System        string     `json:"system"`
+	Messages      []AnthropicMessage `json:"messages"`
+	Temperature   *float64   `json:"temperature,omitempty"`
+	StopSequences []string   `json:"stop_sequences,omitempty"`
 }
 
-// Message represents a message in the conversation
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// AnthropicMessage represents a message in the request
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock represents a text or image block of a request message
+type AnthropicContentBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *AnthropicImageSource `json:"source,omitempty"`
+}
+
+// AnthropicImageSource holds the data of an image block
+type AnthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 // AnthropicResponse represents the response structure from Anthropic API
 type AnthropicResponse struct {
 	Content []ContentBlock `json:"content"`
+	Usage   struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 	Error   struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
@@ -41,62 +61,58 @@ type ContentBlock struct {
 	Text  string `json:"text"`
 }
 
-// GetClaudeResponse sends a question to Anthropic's Claude and returns the response
-func GetClaudeResponse(question string) (string, error) {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return "", errors.New("ANTHROPIC_API_KEY environment variable not set")
+// GetClaudeResponse sends a conversation to Anthropic's Claude and returns the response
+func GetClaudeResponse(model string, messages []Message, profile Profile) (Response, error) {
+	apiKey, err := APIKey(Claude)
+	if err != nil {
+		return Response{}, err
 	}
 
 	requestBody := AnthropicRequest{
-		Model:     "claude-3-sonnet-20240229",
-		MaxTokens: 800,
-		System:    "You are McGraph, a helpful coding assistant AI. Provide concise and technical answers to coding questions.",
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: question,
-			},
-		},
+		Model:         model,
+		MaxTokens:     profile.MaxTokens,
+		System:        profile.SystemPrompt,
+		Messages:      anthropicMessages(messages),
+		Temperature:   profile.Temperature,
+		StopSequences: profile.Stop,
 	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	req, err := http.NewRequest("POST", anthropicAPI, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", BaseURL(Claude)+"/messages", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
+		return Response{}, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
 	}
 
 	var anthropicResp AnthropicResponse
 	if err := json.Unmarshal(body, &anthropicResp); err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if len(anthropicResp.Content) == 0 {
-		return "", errors.New("no response from Claude")
+		return Response{}, errors.New("no response from Claude")
 	}
 
 	var textParts []string
@@ -109,5 +125,35 @@ func GetClaudeResponse(question string) (string, error) {
 	answer := strings.Join(textParts, "\n")
 	answer = strings.TrimSpace(answer)
 
-	return answer, nil
-}
\ No newline at end of file
+	return Response{
+		Content: answer,
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:     anthropicResp.Usage.InputTokens,
+			CompletionTokens: anthropicResp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// anthropicMessages converts messages, sending images as base64 image blocks
+func anthropicMessages(messages []Message) []AnthropicMessage {
+	var converted []AnthropicMessage
+	for _, msg := range messages {
+		var blocks []AnthropicContentBlock
+		for _, image := range msg.Images() {
+			blocks = append(blocks, AnthropicContentBlock{
+				Type: "image",
+				Source: &AnthropicImageSource{
+					Type:      "base64",
+					MediaType: image.MediaType,
+					Data:      image.Base64(),
+				},
+			})
+		}
+		if text := msg.Text(); text != "" || len(blocks) == 0 {
+			blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: text})
+		}
+		converted = append(converted, AnthropicMessage{Role: msg.Role, Content: blocks})
+	}
+	return converted
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/hawk/mcgraph/internal/auth"
+)
+
+// ErrNoAPIKey is returned when no API key is configured for a provider
+var ErrNoAPIKey = errors.New("no API key")
+
+// Where an API key was found, in lookup order
+const (
+	KeyFromFlag  = "--api-key flag"
+	KeyFromEnv   = "environment"
+	KeyFromStore = "key store"
+)
+
+var (
+	// flagAPIKeys are the keys given with --api-key
+	flagAPIKeys = make(map[LLMType]string)
+
+	// storedAPIKeys caches the keys read from the key store, "" when there is none
+	storedAPIKeys   = make(map[LLMType]string)
+	storedAPIKeysMu sync.Mutex
+)
+
+// SetAPIKey sets the key of a provider given on the command line. It takes
+// precedence over the environment and the key store.
+func SetAPIKey(llmType LLMType, key string) {
+	flagAPIKeys[llmType] = key
+}
+
+// LookupAPIKey returns the key of a provider and where it was found: the
+// --api-key flag, then the environment variable, then the key store
+func LookupAPIKey(llmType LLMType) (string, string) {
+	if key := flagAPIKeys[llmType]; key != "" {
+		return key, KeyFromFlag
+	}
+	if key := os.Getenv(GetAPIKeyEnvVar(llmType)); key != "" {
+		return key, KeyFromEnv
+	}
+	if key := storedAPIKey(llmType); key != "" {
+		return key, KeyFromStore
+	}
+	return "", ""
+}
+
+// storedAPIKey reads the key of a provider from the key store once per run
+func storedAPIKey(llmType LLMType) string {
+	storedAPIKeysMu.Lock()
+	defer storedAPIKeysMu.Unlock()
+	if key, ok := storedAPIKeys[llmType]; ok {
+		return key
+	}
+
+	var key string
+	if store, err := auth.Open(); err == nil {
+		key, _ = store.Get(string(llmType))
+	}
+	storedAPIKeys[llmType] = key
+	return key
+}
+
+// APIKey returns the key of a provider, or an error telling how to set one
+func APIKey(llmType LLMType) (string, error) {
+	if key, _ := LookupAPIKey(llmType); key != "" {
+		return key, nil
+	}
+	return "", fmt.Errorf("%w for %s: %s", ErrNoAPIKey, llmType, APIKeyHint(llmType))
+}
+
+// HasAPIKey reports whether a key is configured for a provider. The fake
+// provider needs none.
+func HasAPIKey(llmType LLMType) bool {
+	if llmType == Fake {
+		return true
+	}
+	key, _ := LookupAPIKey(llmType)
+	return key != ""
+}
+
+// APIKeyHint tells how to configure the key of a provider
+func APIKeyHint(llmType LLMType) string {
+	return fmt.Sprintf("run 'mcg auth login %s', set %s or pass --api-key %s=<key>", llmType, GetAPIKeyEnvVar(llmType), llmType)
+}
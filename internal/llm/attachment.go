@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Attachment size limits
+const (
+	maxTextAttachmentSize  = 1 << 20  // 1 MiB
+	maxImageAttachmentSize = 20 << 20 // 20 MiB
+)
+
+// imageTokens is a rough per-image token count used for budgeting
+const imageTokens = 1000
+
+// imageMediaTypes are the image formats accepted by the providers
+var imageMediaTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Attachment is a file sent along with a message. Text files are included as
+// fenced context, images as image parts for providers that accept them.
+type Attachment struct {
+	Name      string // Path as given by the user
+	MediaType string // e.g. text/plain or image/png
+	Data      []byte
+}
+
+// IsImage reports whether the attachment is sent as an image
+func (a Attachment) IsImage() bool {
+	return imageMediaTypes[a.MediaType]
+}
+
+// DataURL returns the attachment as a base64 data URL
+func (a Attachment) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", a.MediaType, a.Base64())
+}
+
+// Base64 returns the attachment data encoded as base64
+func (a Attachment) Base64() string {
+	return base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// Describe returns the name, kind and size of the attachment, e.g. "main.go (text, 2.1 KB)"
+func (a Attachment) Describe() string {
+	kind := "text"
+	if a.IsImage() {
+		kind = strings.TrimPrefix(a.MediaType, "image/") + " image"
+	}
+	size := fmt.Sprintf("%d B", len(a.Data))
+	if len(a.Data) >= 1024*1024 {
+		size = fmt.Sprintf("%.1f MB", float64(len(a.Data))/(1024*1024))
+	} else if len(a.Data) >= 1024 {
+		size = fmt.Sprintf("%.1f KB", float64(len(a.Data))/1024)
+	}
+	return fmt.Sprintf("%s (%s, %s)", a.Name, kind, size)
+}
+
+// fence returns the attachment as a fenced code block labeled with its name
+func (a Attachment) fence() string {
+	content := string(a.Data)
+	// A longer fence keeps code blocks inside the file from closing it
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	lang := strings.TrimPrefix(filepath.Ext(a.Name), ".")
+	return fmt.Sprintf("File: %s\n%s%s\n%s\n%s", a.Name, fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+// Text returns the message content followed by its text attachments as fenced blocks
+func (m Message) Text() string {
+	var parts []string
+	if m.Content != "" {
+		parts = append(parts, m.Content)
+	}
+	for _, attachment := range m.Attachments {
+		if !attachment.IsImage() {
+			parts = append(parts, attachment.fence())
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Images returns the image attachments of the message
+func (m Message) Images() []Attachment {
+	var images []Attachment
+	for _, attachment := range m.Attachments {
+		if attachment.IsImage() {
+			images = append(images, attachment)
+		}
+	}
+	return images
+}
+
+// TextWithoutImages returns Text with a note for each image, for providers that don't accept images
+func (m Message) TextWithoutImages() string {
+	text := m.Text()
+	for _, image := range m.Images() {
+		text += fmt.Sprintf("\n\n[Image %s omitted: this model doesn't accept images]", image.Name)
+	}
+	return text
+}
+
+// ReadAttachment reads a file to attach, detecting whether it is text or an image
+func ReadAttachment(path string) (Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageAttachmentSize {
+		return Attachment{}, fmt.Errorf("%s is too large to attach (%d MB)", path, info.Size()>>20)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	mediaType := http.DetectContentType(data)
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	if imageMediaTypes[mediaType] {
+		return Attachment{Name: path, MediaType: mediaType, Data: data}, nil
+	}
+
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return Attachment{}, fmt.Errorf("%s is neither text nor a PNG, JPEG, GIF or WebP image", path)
+	}
+	if len(data) > maxTextAttachmentSize {
+		return Attachment{}, fmt.Errorf("%s is too large to attach as text (%d KB)", path, len(data)>>10)
+	}
+	return Attachment{Name: path, MediaType: "text/plain", Data: data}, nil
+}
+
+// ReadAttachments reads the files matching a path or glob pattern. A leading
+// ~ is expanded to the home directory.
+func ReadAttachments(pattern string) ([]Attachment, error) {
+	if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			pattern = filepath.Join(home, pattern[1:])
+		}
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	sort.Strings(paths)
+
+	var attachments []Attachment
+	for _, path := range paths {
+		// Directories matched by a glob are skipped rather than failing the rest
+		if info, err := os.Stat(path); err == nil && info.IsDir() && len(paths) > 1 {
+			continue
+		}
+		attachment, err := ReadAttachment(path)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend is the provider and model that answer a request
+type Backend struct {
+	LLM   LLMType
+	Model string // Empty for the provider's default model
+}
+
+// knownModels lists the models offered for each provider, the default first.
+// Other model names can be used as well.
+var knownModels = map[LLMType][]string{
+	OpenAI:   {openAIModel, "gpt-4o", "gpt-4o-mini", "gpt-4-turbo"},
+	Claude:   {claudeModel, "claude-3-5-sonnet-20240620", "claude-3-opus-20240229", "claude-3-haiku-20240307"},
+	DeepSeek: {deepseekModel, "deepseek-chat"},
+	Gemini:   {geminiModel, "gemini-1.5-flash"},
+	Fake:     {FakeEcho, FakeScript},
+}
+
+// KnownModels returns the models offered for a provider, the default first
+func KnownModels(llmType LLMType) []string {
+	return knownModels[llmType]
+}
+
+// CurrentBackend returns the current LLM with its default model
+func CurrentBackend() Backend {
+	return Backend{LLM: currentLLM}
+}
+
+// ParseBackend parses "provider" or "provider:model"
+func ParseBackend(s string) (Backend, error) {
+	name, model, _ := strings.Cut(strings.TrimSpace(s), ":")
+
+	llmType, err := ParseLLMType(name)
+	if err != nil {
+		return Backend{}, err
+	}
+	return Backend{LLM: llmType, Model: strings.TrimSpace(model)}, nil
+}
+
+// ModelName returns the model, falling back to the provider's default
+func (b Backend) ModelName() string {
+	if b.Model != "" {
+		return b.Model
+	}
+	return DefaultModel(b.LLM)
+}
+
+// Resolved returns the backend with the default model filled in
+func (b Backend) Resolved() Backend {
+	b.Model = b.ModelName()
+	return b
+}
+
+// String formats the backend as "provider" or "provider:model"
+func (b Backend) String() string {
+	if b.Model == "" {
+		return string(b.LLM)
+	}
+	return fmt.Sprintf("%s:%s", b.LLM, b.Model)
+}
+
+// AcceptsImages reports whether the provider accepts images in messages.
+// Images sent to other providers are replaced by a note.
+func (b Backend) AcceptsImages() bool {
+	return b.LLM != DeepSeek
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ResponseCache stores answers so an identical request isn't sent again
+type ResponseCache interface {
+	// Get returns the answer stored under key, if it is still fresh
+	Get(key string) (Response, bool)
+	// Put stores the answer of backend under key
+	Put(key string, backend Backend, response Response)
+}
+
+// responseCache is used by ChatWith when set; nil disables caching
+var responseCache ResponseCache
+
+// SetResponseCache makes ChatWith answer identical requests from cache, or
+// send every request when cache is nil
+func SetResponseCache(cache ResponseCache) {
+	responseCache = cache
+}
+
+// cacheRequest is what makes two requests identical
+type cacheRequest struct {
+	Provider     LLMType        `json:"provider"`
+	Model        string         `json:"model"`
+	SystemPrompt string         `json:"system"`
+	Temperature  *float64       `json:"temperature"`
+	MaxTokens    int            `json:"max_tokens"`
+	Stop         []string       `json:"stop"`
+	Messages     []cacheMessage `json:"messages"`
+}
+
+// cacheMessage is a message with its attachments reduced to their hashes
+type cacheMessage struct {
+	Role        string   `json:"role"`
+	Content     string   `json:"content"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// CacheKey returns the key of a request: a hash of the provider, model,
+// system prompt, generation parameters and messages
+func CacheKey(backend Backend, messages []Message, profile Profile) string {
+	request := cacheRequest{
+		Provider:     backend.LLM,
+		Model:        backend.ModelName(),
+		SystemPrompt: profile.SystemPrompt,
+		Temperature:  profile.Temperature,
+		MaxTokens:    profile.MaxTokens,
+		Stop:         profile.Stop,
+	}
+	for _, msg := range messages {
+		cached := cacheMessage{Role: msg.Role, Content: msg.Content}
+		for _, attachment := range msg.Attachments {
+			sum := sha256.Sum256(attachment.Data)
+			cached.Attachments = append(cached.Attachments, attachment.MediaType+":"+hex.EncodeToString(sum[:]))
+		}
+		request.Messages = append(request.Messages, cached)
+	}
+
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package llm
+
+import "testing"
+
+// mapCache is a ResponseCache in memory
+type mapCache map[string]Response
+
+func (c mapCache) Get(key string) (Response, bool) {
+	response, ok := c[key]
+	return response, ok
+}
+
+func (c mapCache) Put(key string, backend Backend, response Response) {
+	c[key] = response
+}
+
+func TestCacheKey(t *testing.T) {
+	backend := Backend{LLM: Fake}
+	messages := []Message{{Role: RoleUser, Content: "hi"}}
+	profile := DefaultProfile()
+	key := CacheKey(backend, messages, profile)
+
+	if CacheKey(Backend{LLM: Fake, Model: FakeEcho}, messages, profile) != key {
+		t.Error("the default model and the same model named explicitly should share a key")
+	}
+
+	hotter := profile
+	hotter.Temperature = floatPtr(1)
+	withImage := []Message{{Role: RoleUser, Content: "hi", Attachments: []Attachment{{Name: "a.png", MediaType: "image/png", Data: []byte{1}}}}}
+	for name, other := range map[string]string{
+		"model":       CacheKey(Backend{LLM: Fake, Model: FakeScript}, messages, profile),
+		"provider":    CacheKey(Backend{LLM: OpenAI}, messages, profile),
+		"message":     CacheKey(backend, []Message{{Role: RoleUser, Content: "hello"}}, profile),
+		"temperature": CacheKey(backend, messages, hotter),
+		"attachment":  CacheKey(backend, withImage, profile),
+	} {
+		if other == key {
+			t.Errorf("changing the %s should change the key", name)
+		}
+	}
+}
+
+func TestChatWithCache(t *testing.T) {
+	cache := mapCache{}
+	SetResponseCache(cache)
+	defer SetResponseCache(nil)
+
+	SetFakeResponses("fresh answer")
+	defer SetFakeResponses()
+
+	backend := Backend{LLM: Fake, Model: FakeScript}
+	messages := []Message{{Role: RoleUser, Content: "hi"}}
+
+	first, err := ChatWith(backend, messages, DefaultProfile())
+	if err != nil || first.Cached {
+		t.Fatalf("first request = %+v, %v; want a fresh answer", first, err)
+	}
+	// The script is used up, so only the cache can answer
+	second, err := ChatWith(backend, messages, DefaultProfile())
+	if err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	if !second.Cached || second.Content != "fresh answer" {
+		t.Errorf("second request = %+v, want the cached answer", second)
+	}
+}
+
+func TestChatWithoutCache(t *testing.T) {
+	cache := mapCache{}
+	SetResponseCache(cache)
+	defer SetResponseCache(nil)
+
+	SetFakeResponses("first answer", "second answer")
+	defer SetFakeResponses()
+
+	backend := Backend{LLM: Fake, Model: FakeScript}
+	messages := []Message{{Role: RoleUser, Content: "hi"}}
+
+	if _, err := ChatWith(backend, messages, DefaultProfile()); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := ChatWith(backend, messages, DefaultProfile().WithoutCache())
+	if err != nil || fresh.Cached || fresh.Content != "second answer" {
+		t.Fatalf("fresh request = %+v, %v; want a new answer", fresh, err)
+	}
+	// The new answer replaces the cached one
+	cached, err := ChatWith(backend, messages, DefaultProfile())
+	if err != nil || !cached.Cached || cached.Content != "second answer" {
+		t.Errorf("cached request = %+v, %v; want the new answer from the cache", cached, err)
+	}
+}
@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message represents a message in the conversation
+type Message struct {
+	Role        string       `json:"role"`
+	Content     string       `json:"content"`
+	Attachments []Attachment `json:"-"`
+}
+
+// Usage reports the tokens used by a request as counted by the provider
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// TotalTokens returns the prompt and completion tokens combined
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Response is a model's answer to a chat request
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+	Cached  bool // Answered from the response cache
+}
+
+// Chat sends a conversation to the current LLM and returns its answer.
+// The last message is the one being answered.
+func Chat(messages []Message, profile Profile) (Response, error) {
+	return ChatWith(CurrentBackend(), messages, profile)
+}
+
+// ChatWith sends a conversation to the given backend and returns its answer
+func ChatWith(backend Backend, messages []Message, profile Profile) (Response, error) {
+	return ChatStream(backend, messages, profile, nil)
+}
+
+// ChatStream is ChatWith passing the answer to onChunk as it arrives. The
+// fake provider streams word by word; the others, and cached answers, arrive
+// in one chunk.
+func ChatStream(backend Backend, messages []Message, profile Profile, onChunk func(string)) (Response, error) {
+	messages = normalizeMessages(messages)
+	if len(messages) == 0 {
+		return Response{}, errors.New("no user message to answer")
+	}
+	messages, profile = redactRequest(messages, profile)
+	
+	if responseCache == nil {
+		return send(backend, messages, profile, onChunk)
+	}
+	key := CacheKey(backend, messages, profile)
+	// A fresh request is asked again on purpose, its answer replaces the cached one
+	if !profile.Fresh {
+		if response, ok := responseCache.Get(key); ok {
+			response.Cached = true
+			if onChunk != nil {
+				onChunk(response.Content)
+			}
+			return response, nil
+		}
+	}
+	response, err := send(backend, messages, profile, onChunk)
+	if err == nil {
+		responseCache.Put(key, backend, response)
+	}
+	return response, err
+}
+
+// send sends a request to the provider of backend
+func send(backend Backend, messages []Message, profile Profile, onChunk func(string)) (Response, error) {
+	if backend.LLM == Fake {
+		return GetFakeResponse(backend.ModelName(), messages, onChunk)
+	}
+	response, err := request(backend, messages, profile)
+	if err == nil && onChunk != nil {
+		onChunk(response.Content)
+	}
+	return response, err
+}
+
+// request sends a request to one of the real providers
+func request(backend Backend, messages []Message, profile Profile) (Response, error) {
+	model := backend.ModelName()
+	switch backend.LLM {
+	case OpenAI:
+		return GetOpenAIResponse(model, messages, profile)
+	case Claude:
+		return GetClaudeResponse(model, messages, profile)
+	case DeepSeek:
+		return GetDeepSeekResponse(model, messages, profile)
+	case Gemini:
+		return GetGeminiResponse(model, messages, profile)
+	default:
+		return Response{}, fmt.Errorf("%w: %s", ErrInvalidLLM, backend.LLM)
+	}
+}
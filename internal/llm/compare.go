@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comparison is one LLM's answer to a prompt sent to several LLMs
+type Comparison struct {
+	LLM      LLMType
+	Response Response
+	Err      error
+	Latency  time.Duration
+}
+
+// Header describes who answered and how long and how many tokens it took
+func (c Comparison) Header() string {
+	name := string(c.LLM)
+	if c.Response.Model != "" {
+		name = fmt.Sprintf("%s (%s)", c.LLM, c.Response.Model)
+	}
+
+	stats := []string{c.Latency.Round(100 * time.Millisecond).String()}
+	if c.Response.Cached {
+		stats[0] = "cached"
+	}
+	if c.Err == nil && c.Response.Usage.TotalTokens() > 0 {
+		stats = append(stats, fmt.Sprintf("%d tokens", c.Response.Usage.TotalTokens()))
+	}
+	return fmt.Sprintf("%s - %s", name, strings.Join(stats, ", "))
+}
+
+// Compare sends the same conversation to several LLMs concurrently. The
+// results are in the order of llmTypes; a failing LLM doesn't affect the others.
+func Compare(llmTypes []LLMType, messages []Message, profile Profile) []Comparison {
+	results := make([]Comparison, len(llmTypes))
+
+	var wg sync.WaitGroup
+	for i, llmType := range llmTypes {
+		wg.Add(1)
+		go func(i int, llmType LLMType) {
+			defer wg.Done()
+
+			start := time.Now()
+			response, err := ChatWith(Backend{LLM: llmType}, messages, profile)
+			results[i] = Comparison{
+				LLM:      llmType,
+				Response: response,
+				Err:      err,
+				Latency:  time.Since(start),
+			}
+		}(i, llmType)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// ParseLLMList parses LLM names separated by commas or spaces, dropping duplicates
+func ParseLLMList(names []string) ([]LLMType, error) {
+	var llmTypes []LLMType
+	seen := make(map[LLMType]bool)
+	for _, name := range names {
+		for _, field := range strings.FieldsFunc(name, func(r rune) bool { return r == ',' || r == ' ' }) {
+			llmType, err := ParseLLMType(field)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[llmType] {
+				seen[llmType] = true
+				llmTypes = append(llmTypes, llmType)
+			}
+		}
+	}
+
+	if len(llmTypes) == 0 {
+		return nil, errors.New("no LLMs to compare")
+	}
+	return llmTypes, nil
+}
+
+// ConfiguredLLMs returns the LLMs with an API key
+func ConfiguredLLMs() []LLMType {
+	var configured []LLMType
+	for _, llmType := range GetAvailableLLMs() {
+		if HasAPIKey(llmType) {
+			configured = append(configured, llmType)
+		}
+	}
+	return configured
+}
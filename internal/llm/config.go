@@ -20,6 +20,8 @@ const (
 	DeepSeek LLMType = "deepseek"
 	// Gemini LLM type
 	Gemini LLMType = "gemini"
+	// Fake LLM type, answering without a network request. It isn't listed with the others.
+	Fake LLMType = "fake"
 )
 
 var (
@@ -30,25 +32,28 @@ var (
 	ErrInvalidLLM = errors.New("invalid LLM type")
 )
 
-// SetCurrentLLM sets the current LLM to use
-func SetCurrentLLM(llmType string) error {
-	llmType = strings.ToLower(llmType)
+// ParseLLMType parses an LLM name, ignoring case and surrounding space
+func ParseLLMType(name string) (LLMType, error) {
+	llmType := LLMType(strings.ToLower(strings.TrimSpace(name)))
 	
-	switch LLMType(llmType) {
-	case OpenAI:
-		currentLLM = OpenAI
-	case Claude:
-		currentLLM = Claude
-	case DeepSeek:
-		currentLLM = DeepSeek
-	case Gemini:
-		currentLLM = Gemini
+	switch llmType {
+	case OpenAI, Claude, DeepSeek, Gemini, Fake:
+		return llmType, nil
 	default:
-		return fmt.Errorf("%w: %s", ErrInvalidLLM, llmType)
+		return "", fmt.Errorf("%w: %s", ErrInvalidLLM, name)
+	}
+}
+
+// SetCurrentLLM sets the current LLM to use
+func SetCurrentLLM(llmType string) error {
+	parsed, err := ParseLLMType(llmType)
+	if err != nil {
+		return err
 	}
+	currentLLM = parsed
 
 	// Save the selection to config file
-	err := saveConfig()
+	err = saveConfig()
 	if err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
@@ -61,20 +66,18 @@ func GetCurrentLLM() LLMType {
 	return currentLLM
 }
 
-// GetResponse gets a response from the current LLM
+// GetResponse gets a response from the current LLM using the default profile
 func GetResponse(question string) (string, error) {
-	switch currentLLM {
-	case OpenAI:
-		return GetOpenAIResponse(question)
-	case Claude:
-		return GetClaudeResponse(question)
-	case DeepSeek:
-		return GetDeepSeekResponse(question)
-	case Gemini:
-		return GetGeminiResponse(question)
-	default:
-		return "", fmt.Errorf("%w: %s", ErrInvalidLLM, currentLLM)
+	return GetResponseWithProfile(question, DefaultProfile())
+}
+
+// GetResponseWithProfile gets a response from the current LLM using the given profile
+func GetResponseWithProfile(question string, profile Profile) (string, error) {
+	response, err := Chat([]Message{{Role: RoleUser, Content: question}}, profile)
+	if err != nil {
+		return "", err
 	}
+	return response.Content, nil
 }
 
 // GetAvailableLLMs returns a list of available LLM types
@@ -148,15 +151,12 @@ func LoadConfig() error {
 		return err
 	}
 
-	llmType := LLMType(strings.TrimSpace(string(data)))
-	
-	switch llmType {
-	case OpenAI, Claude, DeepSeek, Gemini:
-		currentLLM = llmType
-	default:
+	llmType, err := ParseLLMType(string(data))
+	if err != nil {
 		// If the saved value is invalid, fall back to default
-		currentLLM = OpenAI
+		llmType = OpenAI
 	}
+	currentLLM = llmType
 
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultContextLimit is used for models without a known context window
+const defaultContextLimit = 8192
+
+// messageOverheadTokens approximates the tokens each message costs for its role and framing
+const messageOverheadTokens = 4
+
+// contextLimits are the context window sizes of the models, in tokens
+var contextLimits = map[string]int{
+	openAIModel:                  16385,
+	"gpt-4o":                     128000,
+	"gpt-4o-mini":                128000,
+	"gpt-4-turbo":                128000,
+	claudeModel:                  200000,
+	"claude-3-5-sonnet-20240620": 200000,
+	"claude-3-opus-20240229":     200000,
+	"claude-3-haiku-20240307":    200000,
+	deepseekModel:                16000,
+	"deepseek-chat":              64000,
+	geminiModel:                  2097152,
+	"gemini-1.5-flash":           1048576,
+}
+
+// summarizerProfile is used to fold old turns into the running summary
+var summarizerProfile = Profile{
+	Name: "summarizer",
+	SystemPrompt: "You maintain a running summary of a conversation between a user and a coding assistant. " +
+		"Keep the facts needed to continue the conversation: the user's goals, decisions made, code, file and " +
+		"function names, errors and open questions. Be concise and don't address the user.",
+	Temperature: floatPtr(0.2),
+	MaxTokens:   1024,
+}
+
+// DefaultModel returns the model used for an LLM type
+func DefaultModel(llmType LLMType) string {
+	switch llmType {
+	case OpenAI:
+		return openAIModel
+	case Claude:
+		return claudeModel
+	case DeepSeek:
+		return deepseekModel
+	case Gemini:
+		return geminiModel
+	case Fake:
+		return FakeEcho
+	default:
+		return ""
+	}
+}
+
+// CurrentModel returns the model used by the current LLM
+func CurrentModel() string {
+	return CurrentBackend().ModelName()
+}
+
+// ContextLimit returns the context window size of a model in tokens
+func ContextLimit(model string) int {
+	if limit, ok := contextLimits[model]; ok {
+		return limit
+	}
+	return defaultContextLimit
+}
+
+// EstimateTokens estimates the number of tokens in text. Providers report the
+// exact count after a request; this is only used for budgeting before one.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// EstimateMessagesTokens estimates the number of tokens in a list of messages
+func EstimateMessagesTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateMessageTokens(msg)
+	}
+	return total
+}
+
+// estimateMessageTokens estimates the tokens of a message with its attachments
+func estimateMessageTokens(msg Message) int {
+	return EstimateTokens(msg.Text()) + len(msg.Images())*imageTokens + messageOverheadTokens
+}
+
+// ContextBudget returns the tokens left for conversation history once the
+// system prompt and the room reserved for the answer are taken out
+func ContextBudget(model string, profile Profile) int {
+	return ContextLimit(model) - profile.MaxTokens - EstimateTokens(profile.SystemPrompt)
+}
+
+// FoldPoint returns how many of the oldest messages must be folded into the
+// summary for the rest to fit in budget. Whole turns are folded so the
+// remaining messages still start with a user message, and some headroom is
+// left so that not every following turn has to fold again. The last message
+// is never folded.
+func FoldPoint(messages []Message, budget int) int {
+	total := EstimateMessagesTokens(messages)
+	if total <= budget {
+		return 0
+	}
+
+	target := budget * 3 / 4
+	n := 0
+	for n < len(messages)-1 && total > target {
+		total -= estimateMessageTokens(messages[n])
+		n++
+	}
+	for n < len(messages)-1 && messages[n].Role != RoleUser {
+		n++
+	}
+	return n
+}
+
+// SummaryContext formats a running summary for the system prompt
+func SummaryContext(summary string) string {
+	if summary == "" {
+		return ""
+	}
+	return "Summary of the earlier part of this conversation:\n" + summary
+}
+
+// SummarizeTurns folds turns into the previous running summary using backend
+func SummarizeTurns(backend Backend, previous string, turns []Message) (string, error) {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString("CURRENT SUMMARY:\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString("NEW TURNS:\n")
+	for _, turn := range turns {
+		if turn.Role == RoleUser {
+			sb.WriteString("User: ")
+		} else {
+			sb.WriteString("Assistant: ")
+		}
+		sb.WriteString(turn.TextWithoutImages())
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("Write the updated summary.")
+
+	response, err := ChatWith(backend, []Message{{Role: RoleUser, Content: sb.String()}}, summarizerProfile)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	return response.Content, nil
+}
+
+// normalizeMessages prepares messages for providers that require the
+// conversation to start with the user and alternate roles. Leading assistant
+// messages are dropped and consecutive messages from the same role are merged.
+func normalizeMessages(messages []Message) []Message {
+	var normalized []Message
+	for _, msg := range messages {
+		if len(normalized) == 0 && msg.Role != RoleUser {
+			continue
+		}
+
+		last := len(normalized) - 1
+		if last >= 0 && normalized[last].Role == msg.Role {
+			normalized[last].Content += "\n\n" + msg.Content
+			normalized[last].Attachments = append(append([]Attachment(nil), normalized[last].Attachments...), msg.Attachments...)
+			continue
+		}
+		normalized = append(normalized, msg)
+	}
+	return normalized
+}
@@ -7,18 +7,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 )
 
-const deepseekAPI = "https://api.deepseek.com/v1/chat/completions"
+// deepseekModel is the DeepSeek model used unless another one is selected
+const deepseekModel = "deepseek-coder"
 
 // DeepSeekRequest represents the request structure for DeepSeek API
 type DeepSeekRequest struct {
 	Model       string              `json:"model"`
 	Messages    []DeepSeekMessage   `json:"messages"`
-	Temperature float64             `json:"temperature,omitempty"`
+	Temperature *float64            `json:"temperature,omitempty"`
 	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Stop        []string            `json:"stop,omitempty"`
 }
 
 // DeepSeekMessage represents a message in the conversation
@@ -38,75 +39,90 @@ type DeepSeekResponse struct {
 		Message      DeepSeekMessage `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 	Error struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 	} `json:"error,omitempty"`
 }
 
-// GetDeepSeekResponse sends a question to DeepSeek and returns the response
-func GetDeepSeekResponse(question string) (string, error) {
-	apiKey := os.Getenv("DEEPSEEK_API_KEY")
-	if apiKey == "" {
-		return "", errors.New("DEEPSEEK_API_KEY environment variable not set")
+// GetDeepSeekResponse sends a conversation to DeepSeek and returns the response
+func GetDeepSeekResponse(model string, messages []Message, profile Profile) (Response, error) {
+	apiKey, err := APIKey(DeepSeek)
+	if err != nil {
+		return Response{}, err
 	}
 
-	requestBody := DeepSeekRequest{
-		Model: "deepseek-coder",
-		Messages: []DeepSeekMessage{
-			{
-				Role:    "system",
-				Content: "You are McGraph, a helpful coding assistant AI. Provide concise and technical answers to coding questions.",
-			},
-			{
-				Role:    "user",
-				Content: question,
-			},
+	deepseekMessages := []DeepSeekMessage{
+		{
+			Role:    "system",
+			Content: profile.SystemPrompt,
 		},
-		Temperature: 0.7,
-		MaxTokens:   800,
+	}
+	for _, msg := range messages {
+		deepseekMessages = append(deepseekMessages, DeepSeekMessage{
+			Role:    msg.Role,
+			Content: msg.TextWithoutImages(),
+		})
+	}
+
+	requestBody := DeepSeekRequest{
+		Model:       model,
+		Messages:    deepseekMessages,
+		Temperature: profile.Temperature,
+		MaxTokens:   profile.MaxTokens,
+		Stop:        profile.Stop,
 	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	req, err := http.NewRequest("POST", deepseekAPI, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", BaseURL(DeepSeek)+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
+		return Response{}, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
 	}
 
 	var deepseekResp DeepSeekResponse
 	if err := json.Unmarshal(body, &deepseekResp); err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if len(deepseekResp.Choices) == 0 {
-		return "", errors.New("no response from DeepSeek")
+		return Response{}, errors.New("no response from DeepSeek")
 	}
 
 	answer := deepseekResp.Choices[0].Message.Content
 	answer = strings.TrimSpace(answer)
 
-	return answer, nil
+	return Response{
+		Content: answer,
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:     deepseekResp.Usage.PromptTokens,
+			CompletionTokens: deepseekResp.Usage.CompletionTokens,
+		},
+	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Public API base URLs of the providers
+const (
+	openAIAPI    = "https://api.openai.com/v1"
+	anthropicAPI = "https://api.anthropic.com/v1"
+	deepseekAPI  = "https://api.deepseek.com/v1"
+	geminiAPI    = "https://generativelanguage.googleapis.com/v1"
+)
+
+// httpClient sends the requests of every provider
+var httpClient = &http.Client{}
+
+// SetHTTPTransport makes the providers send their requests through
+// transport, e.g. to record or replay them. nil restores the default.
+func SetHTTPTransport(transport http.RoundTripper) {
+	httpClient.Transport = transport
+}
+
+// GetBaseURLEnvVar returns the environment variable that overrides the API base URL of an LLM
+func GetBaseURLEnvVar(llmType LLMType) string {
+	switch llmType {
+	case OpenAI:
+		return "OPENAI_BASE_URL"
+	case Claude:
+		return "ANTHROPIC_BASE_URL"
+	case DeepSeek:
+		return "DEEPSEEK_BASE_URL"
+	case Gemini:
+		return "GEMINI_BASE_URL"
+	default:
+		return ""
+	}
+}
+
+// BaseURL returns the API base URL of an LLM: its $<PROVIDER>_BASE_URL, for
+// proxies, compatible servers and test servers, or the public API
+func BaseURL(llmType LLMType) string {
+	if envVar := GetBaseURLEnvVar(llmType); envVar != "" {
+		if url := os.Getenv(envVar); url != "" {
+			return strings.TrimRight(url, "/")
+		}
+	}
+
+	switch llmType {
+	case OpenAI:
+		return openAIAPI
+	case Claude:
+		return anthropicAPI
+	case DeepSeek:
+		return deepseekAPI
+	case Gemini:
+		return geminiAPI
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FakeResponsesEnvVar names a file of scripted answers for the fake
+// provider's "script" model, separated by lines holding only "---"
+const FakeResponsesEnvVar = "MCGRAPH_FAKE_RESPONSES"
+
+// Models of the fake provider
+const (
+	// FakeEcho answers with the last user message
+	FakeEcho = "echo"
+	// FakeScript answers with the scripted responses in turn
+	FakeScript = "script"
+)
+
+// fakeErrorPrefix makes a scripted response fail with the rest of it as the error
+const fakeErrorPrefix = "error: "
+
+// ErrFakeScriptDone is returned when every scripted response was used
+var ErrFakeScriptDone = errors.New("the fake provider has no scripted responses left")
+
+var (
+	fakeScript       []string
+	fakeScriptLoaded bool
+	fakeScriptMu     sync.Mutex
+)
+
+// SetFakeResponses scripts the answers of the fake provider's "script"
+// model, in order. A response starting with "error: " fails the request instead.
+func SetFakeResponses(responses ...string) {
+	fakeScriptMu.Lock()
+	defer fakeScriptMu.Unlock()
+	fakeScript = append([]string(nil), responses...)
+	fakeScriptLoaded = true
+}
+
+// nextFakeResponse takes the next scripted response, loading the script
+// from $MCGRAPH_FAKE_RESPONSES the first time
+func nextFakeResponse() (string, error) {
+	fakeScriptMu.Lock()
+	defer fakeScriptMu.Unlock()
+
+	if !fakeScriptLoaded {
+		fakeScriptLoaded = true
+		if path := os.Getenv(FakeResponsesEnvVar); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read the fake responses: %w", err)
+			}
+			for _, response := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n---\n") {
+				fakeScript = append(fakeScript, strings.TrimSpace(response))
+			}
+		}
+	}
+
+	if len(fakeScript) == 0 {
+		return "", ErrFakeScriptDone
+	}
+	response := fakeScript[0]
+	fakeScript = fakeScript[1:]
+	return response, nil
+}
+
+// GetFakeResponse answers without a network request, for tests and demos.
+// The answer is streamed to onChunk word by word when it is set.
+func GetFakeResponse(model string, messages []Message, onChunk func(string)) (Response, error) {
+	var answer string
+	switch model {
+	case FakeEcho, "":
+		answer = messages[len(messages)-1].Content
+	case FakeScript:
+		response, err := nextFakeResponse()
+		if err != nil {
+			return Response{}, err
+		}
+		if message, ok := strings.CutPrefix(response, fakeErrorPrefix); ok {
+			return Response{}, errors.New(message)
+		}
+		answer = response
+	default:
+		return Response{}, fmt.Errorf("unknown fake model %q: use %s or %s", model, FakeEcho, FakeScript)
+	}
+
+	if onChunk != nil {
+		for _, chunk := range strings.SplitAfter(answer, " ") {
+			onChunk(chunk)
+		}
+	}
+	return Response{
+		Content: answer,
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:     EstimateMessagesTokens(messages),
+			CompletionTokens: EstimateTokens(answer),
+		},
+	}, nil
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFakeEcho(t *testing.T) {
+	var chunks []string
+	response, err := ChatStream(Backend{LLM: Fake}, []Message{{Role: RoleUser, Content: "one two three"}}, DefaultProfile(), func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if response.Content != "one two three" {
+		t.Errorf("Content = %q, want the question echoed", response.Content)
+	}
+	if response.Model != FakeEcho {
+		t.Errorf("Model = %q, want %q", response.Model, FakeEcho)
+	}
+	if len(chunks) != 3 || strings.Join(chunks, "") != response.Content {
+		t.Errorf("chunks = %q, want the answer word by word", chunks)
+	}
+	if response.Usage.TotalTokens() == 0 {
+		t.Error("Usage is empty")
+	}
+}
+
+func TestFakeScript(t *testing.T) {
+	SetFakeResponses("first", "error: rate limited", "second")
+	defer SetFakeResponses()
+
+	backend := Backend{LLM: Fake, Model: FakeScript}
+	messages := []Message{{Role: RoleUser, Content: "hi"}}
+
+	response, err := ChatWith(backend, messages, DefaultProfile())
+	if err != nil || response.Content != "first" {
+		t.Fatalf("first request = %q, %v; want \"first\"", response.Content, err)
+	}
+	if _, err := ChatWith(backend, messages, DefaultProfile()); err == nil || err.Error() != "rate limited" {
+		t.Fatalf("second request error = %v, want \"rate limited\"", err)
+	}
+	if response, _ := ChatWith(backend, messages, DefaultProfile()); response.Content != "second" {
+		t.Fatalf("third request = %q, want \"second\"", response.Content)
+	}
+	if _, err := ChatWith(backend, messages, DefaultProfile()); !errors.Is(err, ErrFakeScriptDone) {
+		t.Fatalf("fourth request error = %v, want ErrFakeScriptDone", err)
+	}
+}
+
+func TestFakeScriptFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "responses.txt")
+	if err := os.WriteFile(path, []byte("# Answer\n\nmultiple lines\n---\nlast\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FakeResponsesEnvVar, path)
+	fakeScript, fakeScriptLoaded = nil, false
+	defer SetFakeResponses()
+
+	backend := Backend{LLM: Fake, Model: FakeScript}
+	for _, want := range []string{"# Answer\n\nmultiple lines", "last"} {
+		response, err := ChatWith(backend, []Message{{Role: RoleUser, Content: "hi"}}, DefaultProfile())
+		if err != nil || response.Content != want {
+			t.Fatalf("response = %q, %v; want %q", response.Content, err, want)
+		}
+	}
+}
+
+func TestParseFakeBackend(t *testing.T) {
+	backend, err := ParseBackend("fake:script")
+	if err != nil {
+		t.Fatalf("ParseBackend: %v", err)
+	}
+	if backend.LLM != Fake || backend.ModelName() != FakeScript {
+		t.Errorf("backend = %+v, want fake:script", backend)
+	}
+	if !HasAPIKey(Fake) {
+		t.Error("the fake provider should need no API key")
+	}
+	for _, llmType := range GetAvailableLLMs() {
+		if llmType == Fake {
+			t.Error("the fake provider shouldn't be listed")
+		}
+	}
+}
@@ -7,11 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 )
 
-const geminiAPI = "https://generativelanguage.googleapis.com/v1/models/gemini-1.5-pro:generateContent"
+// geminiModel is the Gemini model used unless another one is selected
+const geminiModel = "gemini-1.5-pro"
 
 // GeminiRequest represents the request structure for Google's Gemini API
 type GeminiRequest struct {
@@ -27,13 +27,21 @@ type GeminiContent struct {
 
 // GeminiContentPart represents a part of the content
 type GeminiContentPart struct {
-	Text string `json:"text"`
+	Text       string            `json:"text,omitempty"`
+	InlineData *GeminiInlineData `json:"inline_data,omitempty"`
+}
+
+// GeminiInlineData holds the data of an image part
+type GeminiInlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
 }
 
 // GeminiGenerationConfig represents generation configuration for Gemini
 type GeminiGenerationConfig struct {
-	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
-	Temperature     float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
 }
 
 // GeminiResponse represents the response structure from Gemini API
@@ -45,86 +53,114 @@ type GeminiResponse struct {
 			} `json:"parts"`
 		} `json:"content"`
 	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
 	Error struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-// GetGeminiResponse sends a question to Google's Gemini and returns the response
-func GetGeminiResponse(question string) (string, error) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return "", errors.New("GEMINI_API_KEY environment variable not set")
+// GetGeminiResponse sends a conversation to Google's Gemini and returns the response
+func GetGeminiResponse(model string, messages []Message, profile Profile) (Response, error) {
+	apiKey, err := APIKey(Gemini)
+	if err != nil {
+		return Response{}, err
 	}
 
-	systemPrompt := "You are McGraph, a helpful coding assistant AI. Provide concise and technical answers to coding questions."
+	systemPrompt := profile.SystemPrompt
 	
-	// Gemini doesn't have a dedicated system message, so we include it in the user message
-	fullQuestion := fmt.Sprintf("%s\n\nUser question: %s", systemPrompt, question)
+	var contents []GeminiContent
+	for i, msg := range messages {
+		text := msg.Text()
+		if i == 0 {
+			// Gemini doesn't have a dedicated system message, so we include it in the first user message
+			text = fmt.Sprintf("%s\n\nUser question: %s", systemPrompt, text)
+		}
+		
+		// Gemini calls the assistant role "model"
+		role := "user"
+		if msg.Role == RoleAssistant {
+			role = "model"
+		}
+		
+		parts := []GeminiContentPart{{Text: text}}
+		for _, image := range msg.Images() {
+			parts = append(parts, GeminiContentPart{
+				InlineData: &GeminiInlineData{MimeType: image.MediaType, Data: image.Base64()},
+			})
+		}
+		
+		contents = append(contents, GeminiContent{
+			Role:  role,
+			Parts: parts,
+		})
+	}
 	
 	requestBody := GeminiRequest{
-		Contents: []GeminiContent{
-			{
-				Parts: []GeminiContentPart{
-					{
-						Text: fullQuestion,
-					},
-				},
-			},
-		},
+		Contents: contents,
 		GenerationConfig: GeminiGenerationConfig{
-			MaxOutputTokens: 800,
-			Temperature:     0.7,
+			MaxOutputTokens: profile.MaxTokens,
+			Temperature:     profile.Temperature,
+			StopSequences:   profile.Stop,
 		},
 	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	// Add API key as a query parameter
-	url := fmt.Sprintf("%s?key=%s", geminiAPI, apiKey)
+	// The key goes in a header so it can't leak through errors that echo the URL
+	url := fmt.Sprintf("%s/models/%s:generateContent", BaseURL(Gemini), model)
 	
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
+		return Response{}, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(body))
 	}
 
 	var geminiResp GeminiResponse
 	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if geminiResp.Error.Message != "" {
-		return "", fmt.Errorf("Gemini API error: %s", geminiResp.Error.Message)
+		return Response{}, fmt.Errorf("Gemini API error: %s", geminiResp.Error.Message)
 	}
 
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", errors.New("no response from Gemini")
+		return Response{}, errors.New("no response from Gemini")
 	}
 
 	answer := geminiResp.Candidates[0].Content.Parts[0].Text
 	answer = strings.TrimSpace(answer)
 
-	return answer, nil
+	return Response{
+		Content: answer,
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+		},
+	}, nil
 }
\ No newline at end of file
@@ -3,49 +3,82 @@ package llm
 import (
 	"context"
 	"errors"
-	"os"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
 )
 
-// GetOpenAIResponse sends a question to OpenAI and returns the response
-func GetOpenAIResponse(question string) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", errors.New("OPENAI_API_KEY environment variable not set")
-	}
-
-	client := openai.NewClient(apiKey)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT3Dot5Turbo,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are McGraph, a helpful coding assistant AI. Provide concise and technical answers to coding questions.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: question,
-				},
-			},
-			MaxTokens: 800,
+// openAIModel is the OpenAI model used unless another one is selected
+const openAIModel = openai.GPT3Dot5Turbo
+
+// GetOpenAIResponse sends a conversation to OpenAI and returns the response
+func GetOpenAIResponse(model string, messages []Message, profile Profile) (Response, error) {
+	apiKey, err := APIKey(OpenAI)
+	if err != nil {
+		return Response{}, err
+	}
+
+	chatMessages := []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: profile.SystemPrompt,
 		},
-	)
+	}
+	for _, msg := range messages {
+		chatMessages = append(chatMessages, openAIMessage(msg))
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  chatMessages,
+		MaxTokens: profile.MaxTokens,
+		Stop:      profile.Stop,
+	}
+	if profile.Temperature != nil {
+		request.Temperature = float32(*profile.Temperature)
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = BaseURL(OpenAI)
+	config.HTTPClient = httpClient
+	client := openai.NewClientWithConfig(config)
+	resp, err := client.CreateChatCompletion(context.Background(), request)
 
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if len(resp.Choices) == 0 {
-		return "", errors.New("no response from OpenAI")
+		return Response{}, errors.New("no response from OpenAI")
 	}
 
 	// Clean up the response a bit
 	answer := resp.Choices[0].Message.Content
 	answer = strings.TrimSpace(answer)
 
-	return answer, nil
-}
\ No newline at end of file
+	return Response{
+		Content: answer,
+		Model:   model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		},
+	}, nil
+}
+
+// openAIMessage converts a message, sending images as base64 data URLs
+func openAIMessage(msg Message) openai.ChatCompletionMessage {
+	images := msg.Images()
+	if len(images) == 0 {
+		return openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Text()}
+	}
+
+	parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: msg.Text()}}
+	for _, image := range images {
+		parts = append(parts, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: image.DataURL()},
+		})
+	}
+	return openai.ChatCompletionMessage{Role: msg.Role, MultiContent: parts}
+}
@@ -0,0 +1,282 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultProfileName is the name of the profile used when none is selected
+const DefaultProfileName = "default"
+
+// DefaultSystemPrompt is the system prompt of the default profile
+const DefaultSystemPrompt = "You are McGraph, a helpful coding assistant AI. Provide concise and technical answers to coding questions."
+
+// ErrProfileNotFound is returned when a profile doesn't exist
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile is a named system prompt together with its generation parameters
+type Profile struct {
+	Name         string
+	Description  string
+	SystemPrompt string
+	Temperature  *float64 // nil leaves the provider default
+	MaxTokens    int
+	Stop         []string
+	Fresh        bool // Ask the provider even when the response cache holds an answer
+}
+
+// builtinProfiles are available without any files in the profiles directory.
+// A file with the same name in ~/.mcgraph/profiles overrides them.
+var builtinProfiles = map[string]Profile{
+	DefaultProfileName: {
+		Name:         DefaultProfileName,
+		Description:  "General coding assistant",
+		SystemPrompt: DefaultSystemPrompt,
+		Temperature:  floatPtr(0.7),
+		MaxTokens:    4096,
+	},
+	"reviewer": {
+		Name:        "reviewer",
+		Description: "Thorough code reviewer",
+		SystemPrompt: "You are McGraph, an experienced code reviewer. Review the code you are given for bugs, " +
+			"security issues, performance problems and readability. Point to specific lines, explain why each issue " +
+			"matters and suggest a concrete fix. Say so plainly when the code is fine.",
+		Temperature: floatPtr(0.2),
+		MaxTokens:   4096,
+	},
+	"go-expert": {
+		Name:        "go-expert",
+		Description: "Idiomatic Go specialist",
+		SystemPrompt: "You are McGraph, an expert Go developer. Answer with idiomatic, gofmt-formatted Go that " +
+			"uses the standard library where possible, handles errors explicitly and follows Effective Go.",
+		Temperature: floatPtr(0.3),
+		MaxTokens:   4096,
+	},
+	"sql": {
+		Name:        "sql",
+		Description: "SQL and database design helper",
+		SystemPrompt: "You are McGraph, a database expert. Write correct, readable SQL, mention the dialect you " +
+			"assume, and point out indexing and performance considerations.",
+		Temperature: floatPtr(0.2),
+		MaxTokens:   4096,
+	},
+	"terse": {
+		Name:         "terse",
+		Description:  "Shortest possible answers",
+		SystemPrompt: "You are McGraph, a coding assistant. Answer as briefly as possible: code first, at most one sentence of explanation.",
+		Temperature:  floatPtr(0),
+		MaxTokens:    1024,
+	},
+}
+
+// WithSystemContext returns a copy of the profile with extra context appended
+// to its system prompt
+func (p Profile) WithSystemContext(context string) Profile {
+	if context != "" {
+		p.SystemPrompt = p.SystemPrompt + "\n\n" + context
+	}
+	return p
+}
+
+// WithoutCache returns the profile asking for a new answer rather than a cached one.
+// The new answer replaces the cached one.
+func (p Profile) WithoutCache() Profile {
+	p.Fresh = true
+	return p
+}
+
+// floatPtr returns a pointer to f
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// DefaultProfile returns the default profile
+func DefaultProfile() Profile {
+	profile, err := LoadProfile(DefaultProfileName)
+	if err != nil {
+		return builtinProfiles[DefaultProfileName]
+	}
+	return profile
+}
+
+// getProfilesDir returns the directory containing user profiles
+func getProfilesDir() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "profiles"), nil
+}
+
+// LoadProfile loads a profile by name, preferring ~/.mcgraph/profiles/<name>.md
+// over the built-in profiles
+func LoadProfile(name string) (Profile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultProfileName
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return Profile{}, fmt.Errorf("invalid profile name: %s", name)
+	}
+
+	profilesDir, err := getProfilesDir()
+	if err != nil {
+		return Profile{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(profilesDir, name+".md"))
+	if err == nil {
+		profile, err := ParseProfile(name, string(data))
+		if err != nil {
+			return Profile{}, fmt.Errorf("failed to parse profile %s: %w", name, err)
+		}
+		return profile, nil
+	}
+	if !os.IsNotExist(err) {
+		return Profile{}, err
+	}
+
+	profile, ok := builtinProfiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return profile, nil
+}
+
+// ListProfiles returns all available profiles sorted by name. Profiles that
+// fail to load are left out and reported in the error, which comes with the
+// profiles that did load.
+func ListProfiles() ([]Profile, error) {
+	names := make(map[string]bool)
+	for name := range builtinProfiles {
+		names[name] = true
+	}
+
+	profilesDir, err := getProfilesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+			names[strings.TrimSuffix(entry.Name(), ".md")] = true
+		}
+	}
+
+	profiles := make([]Profile, 0, len(names))
+	for name := range names {
+		profile, err := LoadProfile(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, errors.Join(errs...)
+}
+
+// ParseProfile parses a profile file. The file is Markdown whose body is the
+// system prompt, with optional front matter for the generation parameters:
+//
+//	---
+//	description: Thorough code reviewer
+//	temperature: 0.2
+//	max_tokens: 4096
+//	stop: ["END"]
+//	---
+//	You are a meticulous code reviewer...
+func ParseProfile(name, content string) (Profile, error) {
+	profile := Profile{
+		Name:      name,
+		MaxTokens: builtinProfiles[DefaultProfileName].MaxTokens,
+	}
+
+	body := content
+	if strings.HasPrefix(content, "---\n") || strings.HasPrefix(content, "---\r\n") {
+		rest := content[strings.Index(content, "\n")+1:]
+		end := strings.Index(rest, "\n---")
+		if end < 0 {
+			return Profile{}, errors.New("unterminated front matter")
+		}
+
+		if err := parseFrontMatter(rest[:end], &profile); err != nil {
+			return Profile{}, err
+		}
+
+		body = rest[end+len("\n---"):]
+		// Drop the rest of the closing delimiter line
+		if idx := strings.Index(body, "\n"); idx >= 0 {
+			body = body[idx+1:]
+		} else {
+			body = ""
+		}
+	}
+
+	profile.SystemPrompt = strings.TrimSpace(body)
+	if profile.SystemPrompt == "" {
+		return Profile{}, errors.New("profile has no system prompt")
+	}
+
+	return profile, nil
+}
+
+// parseFrontMatter parses simple "key: value" lines into the profile
+func parseFrontMatter(frontMatter string, profile *Profile) error {
+	scanner := bufio.NewScanner(strings.NewReader(frontMatter))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("invalid front matter line: %s", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "description":
+			profile.Description = strings.Trim(value, `"'`)
+		case "temperature":
+			temperature, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid temperature: %w", err)
+			}
+			profile.Temperature = &temperature
+		case "max_tokens":
+			maxTokens, err := strconv.Atoi(value)
+			if err != nil || maxTokens <= 0 {
+				return fmt.Errorf("invalid max_tokens: %s", value)
+			}
+			profile.MaxTokens = maxTokens
+		case "stop":
+			if strings.HasPrefix(value, "[") {
+				if err := json.Unmarshal([]byte(value), &profile.Stop); err != nil {
+					return fmt.Errorf("invalid stop sequences: %w", err)
+				}
+			} else if value != "" {
+				profile.Stop = []string{strings.Trim(value, `"'`)}
+			}
+		default:
+			return fmt.Errorf("unknown profile setting: %s", key)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListProfilesSkipsBroken checks that a profile that fails to load doesn't hide the others
+func TestListProfilesSkipsBroken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".mcgraph", "profiles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.md"), []byte("---\ntemperature: 0.2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mine.md"), []byte("You answer in haiku."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := ListProfiles()
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("err = %v, want the broken profile reported", err)
+	}
+	var names []string
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	if got := strings.Join(names, ","); !strings.Contains(got, "default") || !strings.Contains(got, "mine") || strings.Contains(got, "broken") {
+		t.Errorf("profiles = %s, want the built-in ones and mine without broken", got)
+	}
+}
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// providerCases describe each provider's endpoint, how it receives its key and a canned answer
+var providerCases = []struct {
+	llm       LLMType
+	path      string
+	keyHeader string
+	keyValue  string
+	response  string
+}{
+	{
+		llm:       OpenAI,
+		path:      "/chat/completions",
+		keyHeader: "Authorization",
+		keyValue:  "Bearer test-key",
+		response:  `{"choices":[{"message":{"role":"assistant","content":"Hello from OpenAI"}}],"usage":{"prompt_tokens":11,"completion_tokens":4}}`,
+	},
+	{
+		llm:       Claude,
+		path:      "/messages",
+		keyHeader: "x-api-key",
+		keyValue:  "test-key",
+		response:  `{"content":[{"type":"text","text":"Hello from Claude"}],"usage":{"input_tokens":11,"output_tokens":4}}`,
+	},
+	{
+		llm:       DeepSeek,
+		path:      "/chat/completions",
+		keyHeader: "Authorization",
+		keyValue:  "Bearer test-key",
+		response:  `{"choices":[{"message":{"role":"assistant","content":"Hello from DeepSeek"}}],"usage":{"prompt_tokens":11,"completion_tokens":4}}`,
+	},
+	{
+		llm:       Gemini,
+		path:      "/models/" + geminiModel + ":generateContent",
+		keyHeader: "x-goog-api-key",
+		keyValue:  "test-key",
+		response:  `{"candidates":[{"content":{"parts":[{"text":"Hello from Gemini"}]}}],"usageMetadata":{"promptTokenCount":11,"candidatesTokenCount":4}}`,
+	},
+}
+
+func TestProvidersUseBaseURL(t *testing.T) {
+	for _, tc := range providerCases {
+		t.Run(string(tc.llm), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tc.path {
+					t.Errorf("path = %q, want %q", r.URL.Path, tc.path)
+				}
+				if got := r.Header.Get(tc.keyHeader); got != tc.keyValue {
+					t.Errorf("%s header = %q, want %q", tc.keyHeader, got, tc.keyValue)
+				}
+				if strings.Contains(r.URL.RawQuery, "test-key") {
+					t.Errorf("API key leaked into the URL: %s", r.URL)
+				}
+				body, _ := io.ReadAll(r.Body)
+				if !strings.Contains(string(body), "Say hello") {
+					t.Errorf("request body doesn't hold the question: %s", body)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tc.response)
+			}))
+			defer server.Close()
+
+			t.Setenv(GetAPIKeyEnvVar(tc.llm), "test-key")
+			t.Setenv(GetBaseURLEnvVar(tc.llm), server.URL)
+
+			response, err := ChatWith(Backend{LLM: tc.llm}, []Message{{Role: RoleUser, Content: "Say hello"}}, DefaultProfile())
+			if err != nil {
+				t.Fatalf("ChatWith: %v", err)
+			}
+			if !strings.HasPrefix(response.Content, "Hello from") {
+				t.Errorf("Content = %q", response.Content)
+			}
+			if response.Usage.PromptTokens != 11 || response.Usage.CompletionTokens != 4 {
+				t.Errorf("Usage = %+v, want 11 prompt and 4 completion tokens", response.Usage)
+			}
+		})
+	}
+}
+
+func TestProviderErrorsDontLeakKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	t.Setenv(GetAPIKeyEnvVar(Gemini), "secret-gemini-key")
+	t.Setenv(GetBaseURLEnvVar(Gemini), server.URL)
+
+	_, err := ChatWith(Backend{LLM: Gemini}, []Message{{Role: RoleUser, Content: "Say hello"}}, DefaultProfile())
+	if err == nil {
+		t.Fatal("ChatWith succeeded, want an error")
+	}
+	if strings.Contains(err.Error(), "secret-gemini-key") {
+		t.Errorf("error leaks the API key: %v", err)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	t.Setenv(GetBaseURLEnvVar(Claude), "")
+	if got := BaseURL(Claude); got != anthropicAPI {
+		t.Errorf("BaseURL(Claude) = %q, want %q", got, anthropicAPI)
+	}
+	t.Setenv(GetBaseURLEnvVar(Claude), "http://localhost:8080/v1/")
+	if got := BaseURL(Claude); got != "http://localhost:8080/v1" {
+		t.Errorf("BaseURL(Claude) = %q, want the override without the trailing slash", got)
+	}
+}
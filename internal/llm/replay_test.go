@@ -0,0 +1,31 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/hawk/mcgraph/internal/cassette"
+)
+
+// TestReplayClaude answers a Claude request from a recorded cassette, without the network.
+// Record new fixtures with MCGRAPH_RECORD=<path> mcg ask ...
+func TestReplayClaude(t *testing.T) {
+	player, err := cassette.New("testdata/claude.json", cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetHTTPTransport(player)
+	defer SetHTTPTransport(nil)
+	t.Setenv(GetAPIKeyEnvVar(Claude), "test-key")
+	t.Setenv(GetBaseURLEnvVar(Claude), "")
+
+	response, err := ChatWith(Backend{LLM: Claude}, []Message{{Role: RoleUser, Content: "How do I start a goroutine?"}}, DefaultProfile())
+	if err != nil {
+		t.Fatalf("ChatWith: %v", err)
+	}
+	if response.Content != "Use the go keyword: go doWork()" {
+		t.Errorf("Content = %q", response.Content)
+	}
+	if response.Usage.PromptTokens != 42 || response.Usage.CompletionTokens != 9 {
+		t.Errorf("Usage = %+v, want 42 prompt and 9 completion tokens", response.Usage)
+	}
+}
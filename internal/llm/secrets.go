@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"github.com/hawk/mcgraph/internal/secrets"
+)
+
+// CheckSecrets applies policy to the content and text attachments of a
+// message. It returns the message to send and save, redacted when the policy
+// says so, and the secrets found. The Block policy fails with secrets.ErrBlocked.
+func CheckSecrets(policy secrets.Policy, msg Message) (Message, []secrets.Finding, error) {
+	content, findings, err := secrets.Check(policy, msg.Content)
+	if err != nil {
+		return msg, findings, err
+	}
+	msg.Content = content
+
+	var attachments []Attachment
+	for _, attachment := range msg.Attachments {
+		if !attachment.IsImage() {
+			text, found, err := secrets.Check(policy, string(attachment.Data))
+			if err != nil {
+				return msg, append(findings, found...), err
+			}
+			attachment.Data = []byte(text)
+			findings = append(findings, found...)
+		}
+		attachments = append(attachments, attachment)
+	}
+	msg.Attachments = attachments
+	return msg, findings, nil
+}
+
+// redactRequest redacts the secrets in everything sent to a provider, the
+// system prompt included, unless $MCGRAPH_SECRETS is "warn". Prompts are
+// checked, and blocked, when they're typed; this catches what reaches the
+// request other ways, like project context or messages saved before.
+func redactRequest(messages []Message, profile Profile) ([]Message, Profile) {
+	if policy, _ := secrets.PolicyFromEnv(); policy == secrets.Warn {
+		return messages, profile
+	}
+
+	profile.SystemPrompt, _, _ = secrets.Check(secrets.Redact, profile.SystemPrompt)
+	redacted := make([]Message, len(messages))
+	for i, msg := range messages {
+		redacted[i], _, _ = CheckSecrets(secrets.Redact, msg)
+	}
+	return redacted, profile
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// TitleModelEnvVar selects the provider and model that write conversation
+// titles, e.g. "openai:gpt-4o-mini". The chat's own backend is used when unset.
+const TitleModelEnvVar = "MCGRAPH_TITLE_MODEL"
+
+// maxTitleRunes is the length titles are cut to
+const maxTitleRunes = 60
+
+// maxTitleExcerpt is how much of the first question and answer the titler gets to see
+const maxTitleExcerpt = 2000
+
+// titleDecoration is what models wrap titles in
+const titleDecoration = " \t*#\"'`“”‘’"
+
+// titleProfile is used to name conversations after their first exchange
+var titleProfile = Profile{
+	Name: "titler",
+	SystemPrompt: "You name conversations between a user and a coding assistant. Reply with a title of 3 to 7 words " +
+		"that says what the conversation is about. No quotes, no trailing punctuation, nothing else.",
+	Temperature: floatPtr(0.2),
+	MaxTokens:   32,
+}
+
+// TitleBackend returns the backend configured in MCGRAPH_TITLE_MODEL, or fallback
+func TitleBackend(fallback Backend) Backend {
+	if backend, err := ParseBackend(os.Getenv(TitleModelEnvVar)); err == nil {
+		return backend
+	}
+	return fallback
+}
+
+// GenerateTitle asks backend for a short title for a conversation that
+// starts with question and answer
+func GenerateTitle(backend Backend, question, answer string) (string, error) {
+	prompt := "USER: " + truncateRunes(question, maxTitleExcerpt) + "\n\nASSISTANT: " + truncateRunes(answer, maxTitleExcerpt)
+	response, err := ChatWith(backend, []Message{{Role: RoleUser, Content: prompt}}, titleProfile)
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanTitle(response.Content)
+	if title == "" {
+		return "", errors.New("the model didn't reply with a title")
+	}
+	return title, nil
+}
+
+// cleanTitle strips the quotes, labels and punctuation models like to add
+func cleanTitle(reply string) string {
+	title := strings.TrimSpace(reply)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	for _, label := range []string{"Title:", "title:"} {
+		title = strings.TrimPrefix(strings.Trim(title, titleDecoration), label)
+	}
+	title = strings.Trim(title, titleDecoration)
+	title = strings.TrimRight(title, ".!:;,")
+	title = strings.Join(strings.Fields(title), " ")
+	return truncateRunes(title, maxTitleRunes)
+}
+
+// truncateRunes cuts s to at most n runes, marking the cut with "..."
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n-3])) + "..."
+}
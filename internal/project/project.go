@@ -0,0 +1,226 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InstructionsFile is the per-project instructions file added to the system prompt
+const InstructionsFile = ".mcgraph.md"
+
+// maxInstructionsSize caps how much of the instructions file is sent to the model
+const maxInstructionsSize = 16 * 1024
+
+// DefaultMaxTreeFiles is the number of files shown in the file tree by default
+const DefaultMaxTreeFiles = 300
+
+// Project is a git repository the user is working in
+type Project struct {
+	Root string
+}
+
+// ContextOptions selects the optional parts of the project context
+type ContextOptions struct {
+	Tree bool // Include a compact file tree
+	Diff bool // Include a summary of uncommitted changes
+}
+
+// Detect finds the git repository containing dir.
+// It returns nil without an error when dir is not inside a repository.
+func Detect(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		// .git is a directory in normal clones and a file in worktrees
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return &Project{Root: dir}, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// DetectCurrent finds the git repository containing the working directory
+func DetectCurrent() (*Project, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return Detect(dir)
+}
+
+// Name returns the name of the project directory
+func (p *Project) Name() string {
+	return filepath.Base(p.Root)
+}
+
+// Instructions returns the contents of the project's instructions file,
+// or an empty string if it doesn't have one
+func (p *Project) Instructions() (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.Root, InstructionsFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if len(data) > maxInstructionsSize {
+		data = data[:maxInstructionsSize]
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Branch returns the current branch name
+func (p *Project) Branch() (string, error) {
+	return p.git("rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// DiffSummary returns a summary of the uncommitted changes
+func (p *Project) DiffSummary() (string, error) {
+	status, err := p.git("status", "--short")
+	if err != nil {
+		return "", err
+	}
+	if status == "" {
+		return "No uncommitted changes.", nil
+	}
+
+	// --stat fails in a repository without commits, the status alone is enough then
+	stat, err := p.git("diff", "--stat", "HEAD")
+	if err != nil || stat == "" {
+		return status, nil
+	}
+	return status + "\n\n" + stat, nil
+}
+
+// FileTree returns a compact tree of the project's files, showing at most maxFiles files
+func (p *Project) FileTree(maxFiles int) (string, error) {
+	files, err := p.listFiles()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	var sb strings.Builder
+	var prevDirs []string
+	shown := 0
+	for _, file := range files {
+		if shown >= maxFiles {
+			sb.WriteString(fmt.Sprintf("... (%d more files)\n", len(files)-shown))
+			break
+		}
+
+		parts := strings.Split(filepath.ToSlash(file), "/")
+		dirs := parts[:len(parts)-1]
+
+		// Only print the directories that differ from the previous file's
+		common := 0
+		for common < len(dirs) && common < len(prevDirs) && dirs[common] == prevDirs[common] {
+			common++
+		}
+		for i := common; i < len(dirs); i++ {
+			sb.WriteString(strings.Repeat("  ", i) + dirs[i] + "/\n")
+		}
+		sb.WriteString(strings.Repeat("  ", len(dirs)) + parts[len(parts)-1] + "\n")
+
+		prevDirs = dirs
+		shown++
+	}
+
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// SystemContext builds the text added to the system prompt for this project
+func (p *Project) SystemContext(opts ContextOptions) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("The user is working in the project %q at %s", p.Name(), p.Root))
+	if branch, err := p.Branch(); err == nil && branch != "" {
+		sb.WriteString(fmt.Sprintf(" on branch %s", branch))
+	}
+	sb.WriteString(".")
+
+	instructions, err := p.Instructions()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", InstructionsFile, err)
+	}
+	if instructions != "" {
+		sb.WriteString(fmt.Sprintf("\n\nProject instructions (%s):\n%s", InstructionsFile, instructions))
+	}
+
+	if opts.Tree {
+		tree, err := p.FileTree(DefaultMaxTreeFiles)
+		if err != nil {
+			return "", fmt.Errorf("failed to list project files: %w", err)
+		}
+		sb.WriteString("\n\nProject files:\n" + tree)
+	}
+
+	if opts.Diff {
+		diff, err := p.DiffSummary()
+		if err != nil {
+			return "", fmt.Errorf("failed to summarize changes: %w", err)
+		}
+		sb.WriteString("\n\nUncommitted changes:\n" + diff)
+	}
+
+	return sb.String(), nil
+}
+
+// listFiles lists the project files relative to the root. It asks git so that
+// ignored files are left out, and falls back to walking the directory.
+func (p *Project) listFiles() ([]string, error) {
+	if out, err := p.git("ls-files", "--cached", "--others", "--exclude-standard"); err == nil {
+		if out == "" {
+			return nil, nil
+		}
+		return strings.Split(out, "\n"), nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(p.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != p.Root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.Root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// git runs a git command in the project root and returns its trimmed output
+func (p *Project) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", p.Root}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,249 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PolicyEnvVar selects what happens to secrets found in prompts: "warn",
+// "redact" or "block"
+const PolicyEnvVar = "MCGRAPH_SECRETS"
+
+// Policy is what happens to the secrets found in a prompt
+type Policy string
+
+const (
+	// Warn sends the prompt as it is and tells about the secrets
+	Warn Policy = "warn"
+	// Redact replaces the secrets with placeholders before the prompt is sent or saved
+	Redact Policy = "redact"
+	// Block refuses to send a prompt with secrets
+	Block Policy = "block"
+)
+
+// DefaultPolicy is used when $MCGRAPH_SECRETS is unset
+const DefaultPolicy = Redact
+
+// ErrBlocked is returned when the policy refuses a prompt with secrets
+var ErrBlocked = errors.New("the prompt contains secrets")
+
+// minEntropy is the Shannon entropy in bits per character above which a string
+// looks random. Hex strings such as hashes stay below it at 4 bits at most.
+const minEntropy = 4.3
+
+// Finding is a secret found in a text
+type Finding struct {
+	Kind  string // e.g. "github-token"
+	Start int    // Byte offsets of the secret in the text
+	End   int
+}
+
+// highEntropyKind is the kind of the random looking strings no detector knows
+const highEntropyKind = "high-entropy"
+
+// Name returns a readable name for the kind of secret
+func (f Finding) Name() string {
+	if f.Kind == highEntropyKind {
+		return "high-entropy string"
+	}
+	for _, detector := range detectors {
+		if detector.kind == f.Kind {
+			return detector.name
+		}
+	}
+	return f.Kind
+}
+
+// detector finds one kind of secret. When the pattern has a group named
+// "secret" only that part of the match is the secret.
+type detector struct {
+	kind    string
+	name    string
+	pattern *regexp.Regexp
+}
+
+// detectors are checked in order; earlier ones win when findings overlap
+var detectors = []detector{
+	{"private-key", "private key", regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{"aws-access-key", "AWS access key", regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[A-Z0-9]{16}\b`)},
+	{"aws-secret-key", "AWS secret key", regexp.MustCompile(`(?i)aws[a-z0-9_.-]{0,20}(secret|key)[a-z0-9_.-]{0,20}["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+]{40})\b`)},
+	{"github-token", "GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{"slack-token", "Slack token", regexp.MustCompile(`\bxox[abeprs]-[A-Za-z0-9-]{10,}`)},
+	{"google-api-key", "Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"stripe-key", "Stripe key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"api-key", "API key", regexp.MustCompile(`\bsk-(ant-|proj-)?[A-Za-z0-9_-]{32,}`)},
+	{"jwt", "JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"url-password", "password in a URL", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s:/@]{3,})@`)},
+	{"assigned-secret", "secret in an assignment", regexp.MustCompile(`(?im)^\s*(export\s+)?[a-z0-9_]*(secret|token|passw(or)?d|api_?key|access_?key|private_?key|credentials?)[a-z0-9_]*\s*=\s*["']?(?P<secret>[^\s"'#(),;]{6,})(["']|\s|$)`)},
+}
+
+// highEntropyCandidate matches the strings long enough to be checked for high entropy
+var highEntropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+
+// placeholderPattern matches the placeholders secrets are replaced with
+var placeholderPattern = regexp.MustCompile(`\[REDACTED:[a-z-]+\]`)
+
+// ParsePolicy parses "warn", "redact" or "block"
+func ParsePolicy(s string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case Warn, Redact, Block:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid secrets policy %q: use warn, redact or block", s)
+	}
+}
+
+// PolicyFromEnv returns the policy in $MCGRAPH_SECRETS, or the default one.
+// An invalid setting falls back to the default with an error to warn about.
+func PolicyFromEnv() (Policy, error) {
+	value := os.Getenv(PolicyEnvVar)
+	if value == "" {
+		return DefaultPolicy, nil
+	}
+	policy, err := ParsePolicy(value)
+	if err != nil {
+		return DefaultPolicy, fmt.Errorf("%s: %w", PolicyEnvVar, err)
+	}
+	return policy, nil
+}
+
+// Scan finds the secrets in text, in order and without overlaps
+func Scan(text string) []Finding {
+	var findings []Finding
+	for _, detector := range detectors {
+		secret := detector.pattern.SubexpIndex("secret")
+		for _, match := range detector.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[0], match[1]
+			if secret >= 0 && match[2*secret] >= 0 {
+				start, end = match[2*secret], match[2*secret+1]
+			}
+			if isPlaceholder(text[start:end]) {
+				continue
+			}
+			findings = appendFinding(findings, Finding{Kind: detector.kind, Start: start, End: end})
+		}
+	}
+
+	for _, match := range highEntropyCandidate.FindAllStringIndex(text, -1) {
+		candidate := text[match[0]:match[1]]
+		if looksRandom(candidate) {
+			findings = appendFinding(findings, Finding{Kind: highEntropyKind, Start: match[0], End: match[1]})
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings
+}
+
+// appendFinding adds a finding unless it overlaps one found before
+func appendFinding(findings []Finding, finding Finding) []Finding {
+	for _, found := range findings {
+		if finding.Start < found.End && found.Start < finding.End {
+			return findings
+		}
+	}
+	return append(findings, finding)
+}
+
+// looksRandom reports whether a string has the character mix and entropy of a
+// random token rather than of a word, path or hash
+func looksRandom(s string) bool {
+	var lower, upper, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	if !(lower && upper && digit) {
+		return false
+	}
+	return entropy(s) >= minEntropy
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	total := float64(len(s))
+	var bits float64
+	for _, count := range counts {
+		p := float64(count) / total
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// Placeholder returns the text a secret of kind is replaced with
+func Placeholder(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// isPlaceholder reports whether s is a placeholder left by an earlier redaction
+func isPlaceholder(s string) bool {
+	return placeholderPattern.MatchString(s)
+}
+
+// RedactFindings replaces the findings of Scan in text with placeholders
+func RedactFindings(text string, findings []Finding) string {
+	var sb strings.Builder
+	last := 0
+	for _, finding := range findings {
+		sb.WriteString(text[last:finding.Start])
+		sb.WriteString(Placeholder(finding.Kind))
+		last = finding.End
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// Check applies policy to text. It returns the text to send, redacted when
+// the policy says so, and the secrets found. Block fails with ErrBlocked.
+func Check(policy Policy, text string) (string, []Finding, error) {
+	findings := Scan(text)
+	if len(findings) == 0 {
+		return text, nil, nil
+	}
+
+	switch policy {
+	case Block:
+		return text, findings, fmt.Errorf("%w: %s", ErrBlocked, Describe(findings))
+	case Redact:
+		return RedactFindings(text, findings), findings, nil
+	default:
+		return text, findings, nil
+	}
+}
+
+// Describe summarizes findings, e.g. "2 secrets (GitHub token, JWT)"
+func Describe(findings []Finding) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if name := finding.Name(); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	count := "1 secret"
+	if len(findings) != 1 {
+		count = fmt.Sprintf("%d secrets", len(findings))
+	}
+	return fmt.Sprintf("%s (%s)", count, strings.Join(names, ", "))
+}
+
+// Placeholders returns the byte ranges of the placeholders in text, for highlighting
+func Placeholders(text string) [][]int {
+	return placeholderPattern.FindAllStringIndex(text, -1)
+}
@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// attachArgs returns the argument schema of /attach for completion
+func attachArgs() []extensions.Arg {
+	return []extensions.Arg{{Name: "path", Kind: extensions.ArgPath, Optional: true}}
+}
+
+// handleAttachCommand handles /attach. Paths and globs are attached to the
+// next message; without arguments the pending attachments are listed and
+// "clear" drops them.
+func (m *ChatModel) handleAttachCommand(args []string) {
+	if len(args) == 0 {
+		if len(m.attachments) == 0 {
+			m.addSystemMessage("Nothing attached. Use /attach <path|glob> to include files in your next message.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("Attached to your next message:\n")
+		for _, attachment := range m.attachments {
+			sb.WriteString("  " + attachment.Describe() + "\n")
+		}
+		sb.WriteString("\nUse /attach clear to remove them.")
+		m.addSystemMessage(sb.String())
+		return
+	}
+
+	if len(args) == 1 && args[0] == "clear" {
+		m.attachments = nil
+		m.addSystemMessage("Removed the attachments.")
+		return
+	}
+
+	var added []llm.Attachment
+	for _, pattern := range args {
+		attachments, err := llm.ReadAttachments(pattern)
+		if err != nil {
+			m.addSystemMessage(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		added = append(added, attachments...)
+	}
+	m.attachments = append(m.attachments, added...)
+
+	var sb strings.Builder
+	sb.WriteString("Attached to your next message:\n")
+	for _, attachment := range added {
+		sb.WriteString("  " + attachment.Describe() + "\n")
+	}
+	if !m.backend.AcceptsImages() {
+		for _, attachment := range added {
+			if attachment.IsImage() {
+				sb.WriteString(fmt.Sprintf("\n%s doesn't accept images, they will be left out.", m.backend.Resolved()))
+				break
+			}
+		}
+	}
+	m.addSystemMessage(strings.TrimRight(sb.String(), "\n"))
+}
+
+// attachmentNames returns the names of attachments for display
+func attachmentNames(attachments []llm.Attachment) []string {
+	names := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		names = append(names, attachment.Name)
+	}
+	return names
+}
+
+// StoredMessageFromDB converts a message loaded from the database
+func StoredMessageFromDB(msg db.Message) StoredMessage {
+	var attachments []llm.Attachment
+	for _, attachment := range msg.Attachments {
+		attachments = append(attachments, llm.Attachment{
+			Name:      attachment.Name,
+			MediaType: attachment.MediaType,
+			Data:      attachment.Data,
+		})
+	}
+	return StoredMessage{
+		ID:          msg.ID,
+		ParentID:    msg.ParentID,
+		Role:        msg.Role,
+		Model:       msg.Model,
+		Content:     msg.Content,
+		Cached:      msg.Cached,
+		Time:        msg.CreatedAt,
+		Attachments: attachments,
+	}
+}
+
+// DBAttachments converts attachments for storing them in the database
+func DBAttachments(attachments []llm.Attachment) []db.Attachment {
+	var converted []db.Attachment
+	for _, attachment := range attachments {
+		converted = append(converted, db.Attachment{
+			Name:      attachment.Name,
+			MediaType: attachment.MediaType,
+			Size:      len(attachment.Data),
+			Data:      attachment.Data,
+		})
+	}
+	return converted
+}
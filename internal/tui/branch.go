@@ -0,0 +1,326 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// Branch styles
+var (
+	selectedStyle = lipgloss.NewStyle().
+			Reverse(true).
+			Bold(true)
+
+	branchStyle lipgloss.Style // Set by ApplyTheme
+)
+
+// messageTree holds every saved message of the conversation so that branches
+// can be switched without going back to the database
+type messageTree struct {
+	nodes    map[uuid.UUID]StoredMessage
+	children map[uuid.UUID][]uuid.UUID // Replies in the order they were added, uuid.Nil holds the first messages
+	leaf     uuid.UUID                 // Last message of the active branch, uuid.Nil when empty
+}
+
+// newMessageTree builds the tree from messages ordered by creation time
+func newMessageTree(messages []StoredMessage, activeID uuid.NullUUID) *messageTree {
+	tree := &messageTree{
+		nodes:    make(map[uuid.UUID]StoredMessage),
+		children: make(map[uuid.UUID][]uuid.UUID),
+	}
+	for _, msg := range messages {
+		tree.add(msg)
+	}
+
+	if _, ok := tree.nodes[activeID.UUID]; activeID.Valid && ok {
+		tree.leaf = activeID.UUID
+	}
+	return tree
+}
+
+// add adds a message and makes it the end of the active branch
+func (t *messageTree) add(msg StoredMessage) {
+	t.nodes[msg.ID] = msg
+	parent := t.parentOf(msg)
+	t.children[parent] = append(t.children[parent], msg.ID)
+	t.leaf = msg.ID
+}
+
+// parentOf returns the key msg is stored under in children
+func (t *messageTree) parentOf(msg StoredMessage) uuid.UUID {
+	if msg.ParentID.Valid {
+		return msg.ParentID.UUID
+	}
+	return uuid.Nil
+}
+
+// leafParent returns the parent for a message added to the end of the active branch
+func (t *messageTree) leafParent() uuid.NullUUID {
+	return uuid.NullUUID{UUID: t.leaf, Valid: t.leaf != uuid.Nil}
+}
+
+// path returns the active branch from the first message down
+func (t *messageTree) path() []StoredMessage {
+	var path []StoredMessage
+	for id := t.leaf; id != uuid.Nil; {
+		msg, ok := t.nodes[id]
+		if !ok {
+			break
+		}
+		path = append([]StoredMessage{msg}, path...)
+		id = t.parentOf(msg)
+	}
+	return path
+}
+
+// siblings returns the alternatives of a message, including itself
+func (t *messageTree) siblings(id uuid.UUID) []uuid.UUID {
+	return t.children[t.parentOf(t.nodes[id])]
+}
+
+// latestLeaf follows the most recent replies down from id to the end of its branch
+func (t *messageTree) latestLeaf(id uuid.UUID) uuid.UUID {
+	for {
+		replies := t.children[id]
+		if len(replies) == 0 {
+			return id
+		}
+		id = replies[len(replies)-1]
+	}
+}
+
+// branchLabel returns e.g. "(2/3)" for a message with alternatives, or ""
+func (t *messageTree) branchLabel(id uuid.UUID) string {
+	siblings := t.siblings(id)
+	if len(siblings) < 2 {
+		return ""
+	}
+	for i, sibling := range siblings {
+		if sibling == id {
+			return fmt.Sprintf("(%d/%d)", i+1, len(siblings))
+		}
+	}
+	return ""
+}
+
+// saveMessage stores a message at the end of the active branch and returns it.
+// model is the backend that wrote an assistant message, attachments the files sent with it.
+func (m *ChatModel) saveMessage(role, model, content string, attachments []llm.Attachment) StoredMessage {
+	msg := StoredMessage{
+		ID:          uuid.New(),
+		ParentID:    m.tree.leafParent(),
+		Role:        role,
+		Model:       model,
+		Content:     content,
+		Time:        time.Now(),
+		Attachments: attachments,
+	}
+
+	if m.db != nil {
+		id, err := m.db.AddMessage(context.Background(), m.conversationID, msg.ParentID, role, model, content)
+		if err != nil {
+			// Just log the error, don't interrupt the user experience
+			m.err = fmt.Errorf("failed to save message: %w", err)
+		} else {
+			msg.ID = id
+			if err := m.db.AddAttachments(context.Background(), id, DBAttachments(attachments)); err != nil {
+				m.err = err
+			}
+		}
+	}
+
+	m.tree.add(msg)
+	return msg
+}
+
+// saveAnswer stores the answer of backend, recording when it came from the response cache
+func (m *ChatModel) saveAnswer(backend llm.Backend, response llm.Response) StoredMessage {
+	saved := m.saveMessage(llm.RoleAssistant, backend.String(), response.Content, nil)
+	if !response.Cached {
+		return saved
+	}
+
+	saved.Cached = true
+	m.tree.nodes[saved.ID] = saved
+	if m.db != nil {
+		if err := m.db.MarkMessageCached(context.Background(), saved.ID); err != nil {
+			m.err = fmt.Errorf("failed to save message: %w", err)
+		}
+	}
+	return saved
+}
+
+// showActiveBranch replaces the shown messages and the model history with the active branch
+func (m *ChatModel) showActiveBranch() {
+	m.messages = append([]Message(nil), m.intro...)
+	m.history = nil
+	for _, msg := range m.tree.path() {
+		m.messages = append(m.messages, Message{
+			ID:             msg.ID,
+			Model:          msg.Model,
+			Cached:         msg.Cached,
+			Content:        msg.Content,
+			VisibleContent: msg.Content,
+			IsUser:         msg.Role == llm.RoleUser,
+			Time:           msg.Time,
+			IsComplete:     true,
+			Attachments:    attachmentNames(msg.Attachments),
+		})
+		m.history = append(m.history, llm.Message{Role: msg.Role, Content: msg.Content, Attachments: msg.Attachments})
+	}
+	m.updateViewportContent()
+}
+
+// branchFrom makes leaf the end of the active branch. The summary is dropped when
+// the new branch splits off inside the summarized turns, as it describes the old branch.
+func (m *ChatModel) branchFrom(leaf uuid.UUID) {
+	old := m.tree.path()
+	m.tree.leaf = leaf
+	m.showActiveBranch()
+
+	if divergence(old, m.tree.path()) < m.summarizedCount {
+		m.summary = ""
+		m.summarizedCount = 0
+		if m.db != nil {
+			err := m.db.UpdateConversationSummary(context.Background(), m.conversationID, "", 0)
+			if err != nil {
+				m.err = fmt.Errorf("failed to reset summary: %w", err)
+			}
+		}
+	}
+
+	if m.db != nil && leaf != uuid.Nil {
+		if err := m.db.SetActiveMessage(context.Background(), m.conversationID, leaf); err != nil {
+			m.err = fmt.Errorf("failed to save active branch: %w", err)
+		}
+	}
+}
+
+// divergence returns the number of leading messages two branches share
+func divergence(a, b []StoredMessage) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n].ID == b[n].ID {
+		n++
+	}
+	return n
+}
+
+// selectedMessage returns the selected message, if any
+func (m ChatModel) selectedMessage() (StoredMessage, bool) {
+	if m.selected < 0 || m.selected >= len(m.messages) {
+		return StoredMessage{}, false
+	}
+	msg, ok := m.tree.nodes[m.messages[m.selected].ID]
+	return msg, ok
+}
+
+// selectMessage moves the focus to the previous (-1) or next (1)
+// message. Moving past the last message ends focus mode.
+func (m *ChatModel) selectMessage(delta int) {
+	start := m.selected
+	if start < 0 {
+		start = len(m.messages)
+	}
+
+	if i := start + delta; i >= 0 && i < len(m.messages) {
+		m.selected = i
+		m.focusedBlock = 0
+		m.updateViewportContent()
+		m.viewport.SetYOffset(m.selectedOffset)
+		return
+	}
+
+	if delta > 0 {
+		m.clearSelection()
+	}
+}
+
+// clearSelection ends message selection
+func (m *ChatModel) clearSelection() {
+	m.selected = -1
+	m.updateViewportContent()
+	m.viewport.GotoBottom()
+}
+
+// switchBranch shows the previous (-1) or next (1) alternative of the selected message
+func (m *ChatModel) switchBranch(delta int) {
+	msg, ok := m.selectedMessage()
+	if !ok {
+		return
+	}
+
+	siblings := m.tree.siblings(msg.ID)
+	for i, id := range siblings {
+		if id != msg.ID {
+			continue
+		}
+		if i+delta < 0 || i+delta >= len(siblings) {
+			return
+		}
+
+		target := siblings[i+delta]
+		m.branchFrom(m.tree.latestLeaf(target))
+
+		// Keep the alternative that was switched to selected
+		for j, shown := range m.messages {
+			if shown.ID == target {
+				m.selected = j
+			}
+		}
+		m.updateViewportContent()
+		m.viewport.SetYOffset(m.selectedOffset)
+		return
+	}
+}
+
+// editSelected loads the selected user message into the input. Sending it
+// adds the edited message as a new branch next to the original.
+func (m *ChatModel) editSelected() {
+	msg, ok := m.selectedMessage()
+	if !ok || msg.Role != llm.RoleUser {
+		return
+	}
+
+	m.editing = true
+	m.editParent = msg.ParentID
+	m.attachments = msg.Attachments
+	m.textarea.SetValue(msg.Content)
+	m.clearSelection()
+}
+
+// cancelEdit leaves edit mode without sending
+func (m *ChatModel) cancelEdit() {
+	m.editing = false
+	m.attachments = nil
+	m.textarea.Reset()
+}
+
+// regenerateSelected asks for a new answer to the selected message, or to
+// the question of the selected answer, as a new branch
+func (m *ChatModel) regenerateSelected() tea.Cmd {
+	msg, ok := m.selectedMessage()
+	if !ok {
+		return nil
+	}
+
+	question := msg.ID
+	if msg.Role != llm.RoleUser {
+		if !msg.ParentID.Valid {
+			return nil
+		}
+		question = msg.ParentID.UUID
+	}
+
+	m.selected = -1
+	m.branchFrom(question)
+	m.waitingForResp = true
+	m.viewport.GotoBottom()
+	// A cached answer would only repeat the one being regenerated
+	return m.getResponse(m.activeProfile().WithoutCache())
+}
@@ -0,0 +1,683 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// previewMessages is the number of trailing messages shown in the preview
+const previewMessages = 6
+
+// pinnedMarker is shown before the titles of pinned conversations
+const pinnedMarker = "★ "
+
+// browserState holds the conversation browser shown in place of the messages
+type browserState struct {
+	conversations []db.Conversation // Listed conversations, pinned first, then most recently updated
+	matches       []db.Conversation // Conversations matching the filter, best match first
+	selected      int
+	archived      bool // Whether the archived conversations are listed instead of the others
+	filter        textinput.Model
+	rename        textinput.Model
+	renaming      bool
+	tags          textinput.Model
+	tagging       bool
+	confirmDelete bool
+	previews      map[uuid.UUID]string // Rendered previews, loaded when first selected
+}
+
+// openBrowser shows the conversation browser
+func (m *ChatModel) openBrowser() {
+	if m.db == nil {
+		m.notice = "Conversation history is not available"
+		return
+	}
+	if m.waitingForResp || m.typingActive {
+		m.notice = "Wait for the answer before switching conversations"
+		return
+	}
+
+	conversations, err := m.db.FindConversations(context.Background(), db.ConversationFilter{})
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error listing conversations: %v", err))
+		return
+	}
+
+	filter := textinput.New()
+	filter.Prompt = "Filter: "
+	filter.Placeholder = "type to search titles, #tag to filter by tag"
+	filter.Focus()
+
+	m.clearSelection()
+	m.closeCompletion()
+	m.browser = &browserState{
+		conversations: conversations,
+		filter:        filter,
+		previews:      make(map[uuid.UUID]string),
+	}
+	m.filterConversations()
+
+	// Start on the conversation that is open
+	m.selectConversation(m.conversationID)
+}
+
+// reloadConversations lists the conversations again, e.g. after switching to the archive
+func (m *ChatModel) reloadConversations() {
+	b := m.browser
+	conversations, err := m.db.FindConversations(context.Background(), db.ConversationFilter{Archived: b.archived})
+	if err != nil {
+		m.notice = fmt.Sprintf("Error listing conversations: %v", err)
+		return
+	}
+	b.conversations = conversations
+	m.filterConversations()
+}
+
+// filterConversations updates the matches after the filter changed. Words
+// starting with '#' select tags, the rest is matched against the titles.
+func (m *ChatModel) filterConversations() {
+	b := m.browser
+	var words, tags []string
+	for _, word := range strings.Fields(b.filter.Value()) {
+		if strings.HasPrefix(word, "#") {
+			tags = append(tags, db.NormalizeTag(word))
+		} else {
+			words = append(words, word)
+		}
+	}
+	pattern := strings.Join(words, " ")
+
+	type match struct {
+		conversation db.Conversation
+		score        int
+	}
+	var matches []match
+	for _, conversation := range b.conversations {
+		if !hasTags(conversation, tags) {
+			continue
+		}
+		if score, ok := fuzzyScore(pattern, conversation.Title); ok {
+			matches = append(matches, match{conversation, score})
+		}
+	}
+	// Ties keep the most recent conversation first
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	b.matches = b.matches[:0]
+	for _, match := range matches {
+		b.matches = append(b.matches, match.conversation)
+	}
+	if b.selected >= len(b.matches) {
+		b.selected = len(b.matches) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+}
+
+// hasTags reports whether a conversation has tags starting with each of the given prefixes
+func hasTags(conversation db.Conversation, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		found := false
+		for _, tag := range conversation.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzyScore reports whether the runes of pattern appear in text in order,
+// ignoring case. Consecutive runes and runes at the start of words score higher.
+func fuzzyScore(pattern, text string) (int, bool) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return 0, true
+	}
+
+	target := []rune(strings.ToLower(text))
+	score := 0
+	pos := 0
+	prev := -2
+	for _, r := range pattern {
+		if r == ' ' {
+			continue
+		}
+		for pos < len(target) && target[pos] != r {
+			pos++
+		}
+		if pos == len(target) {
+			return 0, false
+		}
+
+		score++
+		if pos == prev+1 {
+			score += 5
+		}
+		if pos == 0 || !unicode.IsLetter(target[pos-1]) && !unicode.IsDigit(target[pos-1]) {
+			score += 3
+		}
+		prev = pos
+		pos++
+	}
+	return score, true
+}
+
+// selectedConversation returns the highlighted conversation, if any
+func (b *browserState) selectedConversation() (db.Conversation, bool) {
+	if b.selected < 0 || b.selected >= len(b.matches) {
+		return db.Conversation{}, false
+	}
+	return b.matches[b.selected], true
+}
+
+// handleBrowserKey handles keys while the conversation browser is shown
+func (m *ChatModel) handleBrowserKey(msg tea.KeyMsg) tea.Cmd {
+	b := m.browser
+
+	if b.confirmDelete {
+		switch msg.String() {
+		case "y", "Y":
+			m.deleteSelectedConversation()
+		case "ctrl+c":
+			return m.quit()
+		}
+		b.confirmDelete = false
+		return nil
+	}
+
+	if b.renaming {
+		switch msg.String() {
+		case "enter":
+			m.renameSelectedConversation()
+		case "esc":
+			b.renaming = false
+		case "ctrl+c":
+			return m.quit()
+		default:
+			var cmd tea.Cmd
+			b.rename, cmd = b.rename.Update(msg)
+			return cmd
+		}
+		return nil
+	}
+
+	if b.tagging {
+		switch msg.String() {
+		case "enter":
+			m.tagSelectedConversation()
+		case "esc":
+			b.tagging = false
+		case "ctrl+c":
+			return m.quit()
+		default:
+			var cmd tea.Cmd
+			b.tags, cmd = b.tags.Update(msg)
+			return cmd
+		}
+		return nil
+	}
+
+	switch msg.String() {
+	case "up":
+		if b.selected > 0 {
+			b.selected--
+		}
+	case "down":
+		if b.selected < len(b.matches)-1 {
+			b.selected++
+		}
+	case "pgup":
+		b.selected -= m.viewport.Height
+		if b.selected < 0 {
+			b.selected = 0
+		}
+	case "pgdown":
+		b.selected += m.viewport.Height
+		if b.selected >= len(b.matches) {
+			b.selected = len(b.matches) - 1
+		}
+	case "enter":
+		if conversation, ok := b.selectedConversation(); ok {
+			m.browser = nil
+			if conversation.ID != m.conversationID {
+				m.openConversation(conversation.ID)
+			}
+		}
+	case "ctrl+n":
+		m.browser = nil
+		m.newConversation()
+	case "ctrl+r":
+		if conversation, ok := b.selectedConversation(); ok {
+			b.rename = textinput.New()
+			b.rename.Prompt = "Title: "
+			b.rename.SetValue(conversation.Title)
+			b.rename.Focus()
+			b.renaming = true
+		}
+	case "ctrl+t":
+		if conversation, ok := b.selectedConversation(); ok {
+			b.tags = textinput.New()
+			b.tags.Prompt = "Tags: "
+			b.tags.SetValue(strings.Join(conversation.Tags, " "))
+			b.tags.Focus()
+			b.tagging = true
+		}
+	case "ctrl+p":
+		m.pinSelectedConversation()
+	case "ctrl+a":
+		m.archiveSelectedConversation()
+	case "tab":
+		b.archived = !b.archived
+		b.selected = 0
+		m.reloadConversations()
+	case "ctrl+d":
+		if _, ok := b.selectedConversation(); ok {
+			b.confirmDelete = true
+		}
+	case "esc":
+		m.browser = nil
+	case "ctrl+c":
+		return m.quit()
+	default:
+		var cmd tea.Cmd
+		b.filter, cmd = b.filter.Update(msg)
+		m.filterConversations()
+		return cmd
+	}
+	return nil
+}
+
+// renameSelectedConversation saves the title typed for the highlighted conversation
+func (m *ChatModel) renameSelectedConversation() {
+	b := m.browser
+	b.renaming = false
+	conversation, ok := b.selectedConversation()
+	title := strings.TrimSpace(b.rename.Value())
+	if !ok || title == "" || title == conversation.Title {
+		return
+	}
+
+	if err := m.db.UpdateConversationTitle(context.Background(), conversation.ID, title); err != nil {
+		m.notice = fmt.Sprintf("Failed to rename conversation: %v", err)
+		return
+	}
+	m.updateListedConversation(conversation.ID, func(c *db.Conversation) { c.Title = title })
+	m.notice = "Conversation renamed"
+}
+
+// deleteSelectedConversation deletes the highlighted conversation. Deleting the
+// open conversation starts a new one in its place.
+func (m *ChatModel) deleteSelectedConversation() {
+	b := m.browser
+	conversation, ok := b.selectedConversation()
+	if !ok {
+		return
+	}
+
+	if err := m.db.DeleteConversation(context.Background(), conversation.ID); err != nil {
+		m.notice = fmt.Sprintf("Failed to delete conversation: %v", err)
+		return
+	}
+	for i := range b.conversations {
+		if b.conversations[i].ID == conversation.ID {
+			b.conversations = append(b.conversations[:i], b.conversations[i+1:]...)
+			break
+		}
+	}
+	m.filterConversations()
+	m.notice = fmt.Sprintf("Deleted %q", conversation.Title)
+
+	if conversation.ID == m.conversationID {
+		m.newConversation()
+		m.reloadConversations()
+	}
+}
+
+// tagSelectedConversation saves the tags typed for the highlighted conversation
+func (m *ChatModel) tagSelectedConversation() {
+	b := m.browser
+	b.tagging = false
+	conversation, ok := b.selectedConversation()
+	if !ok {
+		return
+	}
+
+	// Work out what changed so tags added elsewhere in the meantime survive
+	typed := make(map[string]bool)
+	var add, remove []string
+	for _, tag := range strings.Fields(b.tags.Value()) {
+		tag = db.NormalizeTag(tag)
+		if err := db.ValidateTag(tag); err != nil {
+			m.notice = err.Error()
+			return
+		}
+		typed[tag] = true
+		add = append(add, tag)
+	}
+	for _, tag := range conversation.Tags {
+		if !typed[tag] {
+			remove = append(remove, tag)
+		}
+	}
+
+	tags, err := m.db.UpdateConversationTags(context.Background(), conversation.ID, add, remove)
+	if err != nil {
+		m.notice = fmt.Sprintf("Failed to update tags: %v", err)
+		return
+	}
+	m.updateListedConversation(conversation.ID, func(c *db.Conversation) { c.Tags = tags })
+	m.notice = "Tags saved"
+}
+
+// pinSelectedConversation pins the highlighted conversation to the top of the list, or unpins it
+func (m *ChatModel) pinSelectedConversation() {
+	conversation, ok := m.browser.selectedConversation()
+	if !ok {
+		return
+	}
+	pinned := !conversation.Pinned
+	if err := m.db.SetConversationPinned(context.Background(), conversation.ID, pinned); err != nil {
+		m.notice = fmt.Sprintf("Failed to pin conversation: %v", err)
+		return
+	}
+	m.reloadConversations()
+	m.selectConversation(conversation.ID)
+	if pinned {
+		m.notice = fmt.Sprintf("Pinned %q", conversation.Title)
+	} else {
+		m.notice = fmt.Sprintf("Unpinned %q", conversation.Title)
+	}
+}
+
+// archiveSelectedConversation moves the highlighted conversation to the archive, or out of it
+func (m *ChatModel) archiveSelectedConversation() {
+	b := m.browser
+	conversation, ok := b.selectedConversation()
+	if !ok {
+		return
+	}
+	if err := m.db.SetConversationArchived(context.Background(), conversation.ID, !b.archived); err != nil {
+		m.notice = fmt.Sprintf("Failed to archive conversation: %v", err)
+		return
+	}
+	m.reloadConversations()
+	if b.archived {
+		m.notice = fmt.Sprintf("Restored %q from the archive", conversation.Title)
+	} else {
+		m.notice = fmt.Sprintf("Archived %q, press Tab to see the archive", conversation.Title)
+	}
+}
+
+// updateListedConversation changes a listed conversation in place
+func (m *ChatModel) updateListedConversation(id uuid.UUID, update func(*db.Conversation)) {
+	b := m.browser
+	for i := range b.conversations {
+		if b.conversations[i].ID == id {
+			update(&b.conversations[i])
+		}
+	}
+	delete(b.previews, id)
+	m.filterConversations()
+}
+
+// selectConversation highlights a conversation if it is listed
+func (m *ChatModel) selectConversation(id uuid.UUID) {
+	for i, conversation := range m.browser.matches {
+		if conversation.ID == id {
+			m.browser.selected = i
+		}
+	}
+}
+
+// openConversation switches the chat to a saved conversation, continuing it
+// with its own model, profile and summary like `mcg chat --continue` does
+func (m *ChatModel) openConversation(id uuid.UUID) {
+	ctx := context.Background()
+	conversation, err := m.db.GetConversation(ctx, id)
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error loading conversation: %v", err))
+		return
+	}
+	messages, err := m.db.GetMessages(ctx, id)
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error loading messages: %v", err))
+		return
+	}
+
+	var warnings []string
+	backend := m.backend
+	if conversationBackend, err := llm.ParseBackend(conversation.Model); err == nil {
+		backend = conversationBackend
+	} else {
+		warnings = append(warnings, fmt.Sprintf("This conversation used %s but it's not available. Using %s instead.", conversation.Model, backend))
+	}
+	profile, err := llm.LoadProfile(conversation.Profile)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("%v. Using the default profile instead.", err))
+		profile = llm.DefaultProfile()
+	}
+
+	stored := make([]StoredMessage, 0, len(messages))
+	for _, msg := range messages {
+		stored = append(stored, StoredMessageFromDB(msg))
+	}
+
+	welcome := fmt.Sprintf("Continuing conversation: %s\nCurrent LLM: %s (profile: %s)", conversation.Title, backend.Resolved(), profile.Name)
+	if len(warnings) > 0 {
+		welcome += "\n" + strings.Join(warnings, "\n")
+	}
+	m.loadConversation(id, backend, profile, welcome, ChatOptions{
+		Messages:        stored,
+		ActiveMessageID: conversation.ActiveMessageID,
+		Summary:         conversation.Summary,
+		SummarizedCount: conversation.SummaryMessageCount,
+	})
+}
+
+// newConversation starts a new conversation with the session's model and profile
+func (m *ChatModel) newConversation() {
+	if m.db == nil {
+		m.notice = "Conversation history is not available"
+		return
+	}
+	if m.waitingForResp || m.typingActive {
+		m.notice = "Wait for the answer before starting a new conversation"
+		return
+	}
+
+	repoPath := ""
+	if m.project != nil {
+		repoPath = m.project.Root
+	}
+	conversation, err := m.db.CreateConversation(context.Background(), "New Conversation", m.backend.String(), m.profile.Name, repoPath)
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error creating conversation: %v", err))
+		return
+	}
+
+	welcome := fmt.Sprintf("Started a new conversation. Current LLM: %s (profile: %s)", m.backend.Resolved(), m.profile.Name)
+	m.loadConversation(conversation.ID, m.backend, m.profile, welcome, ChatOptions{})
+}
+
+// loadConversation replaces the chat with the conversation described by
+// opts.Messages, ActiveMessageID, Summary and SummarizedCount
+func (m *ChatModel) loadConversation(id uuid.UUID, backend llm.Backend, profile llm.Profile, welcome string, opts ChatOptions) {
+	m.conversationID = id
+	m.backend = backend
+	m.profile = profile
+	m.tree = newMessageTree(opts.Messages, opts.ActiveMessageID)
+	m.summary = opts.Summary
+	m.summarizedCount = opts.SummarizedCount
+	m.lastUsage = llm.Usage{}
+	m.lastModel = ""
+	m.selected = -1
+	m.editing = false
+	m.comparison = nil
+	m.saving = nil
+	m.focusedBlock = 0
+	m.textarea.Reset()
+	m.intro = []Message{{
+		Content:        welcome,
+		VisibleContent: welcome,
+		Time:           time.Now(),
+		IsComplete:     true,
+	}}
+	m.showActiveBranch()
+
+	// A summary can't cover more turns than there are
+	if m.summarizedCount > len(m.history) {
+		m.summarizedCount = len(m.history)
+	}
+	m.viewport.GotoBottom()
+}
+
+// conversationPreview returns the last messages of a conversation's active branch
+func (m *ChatModel) conversationPreview(conversation db.Conversation, width int) string {
+	if preview, ok := m.browser.previews[conversation.ID]; ok {
+		return preview
+	}
+
+	var sb strings.Builder
+	sb.WriteString(aiStyle.Render(conversation.Title) + "\n")
+	sb.WriteString(branchStyle.Render(fmt.Sprintf("%s · %s · %s · updated %s",
+		conversation.ID.String()[:8], conversation.Model, conversation.Profile,
+		conversation.UpdatedAt.Local().Format("2006-01-02 15:04"))) + "\n")
+	if len(conversation.Tags) > 0 {
+		sb.WriteString(branchStyle.Render("#"+strings.Join(conversation.Tags, " #")) + "\n")
+	}
+	sb.WriteString("\n")
+
+	full, err := m.db.GetConversation(context.Background(), conversation.ID)
+	if err != nil {
+		sb.WriteString(fmt.Sprintf("Error loading messages: %v", err))
+	} else if len(full.Messages) == 0 {
+		sb.WriteString(branchStyle.Render("No messages yet"))
+	} else {
+		messages := full.Messages
+		if len(messages) > previewMessages {
+			messages = messages[len(messages)-previewMessages:]
+		}
+		for _, msg := range messages {
+			name := aiStyle.Render("McGraph")
+			if msg.Role == llm.RoleUser {
+				name = userStyle.Render("You")
+			}
+			content := msg.Content
+			if runes := []rune(content); len(runes) > 400 {
+				content = string(runes[:400]) + "..."
+			}
+			sb.WriteString(name + "\n" + content + "\n\n")
+		}
+	}
+
+	preview := lipgloss.NewStyle().Width(width).Render(strings.TrimRight(sb.String(), "\n"))
+	m.browser.previews[conversation.ID] = preview
+	return preview
+}
+
+// renderBrowser renders the conversation list with a preview of the highlighted conversation
+func (m *ChatModel) renderBrowser() string {
+	b := m.browser
+	height := m.viewport.Height
+	listWidth := m.width * 2 / 5
+	if listWidth < 24 {
+		listWidth = 24
+	}
+	previewWidth := m.width - listWidth - 3
+
+	// Scroll the list so the selection stays visible
+	visible := height - 2
+	start := 0
+	if b.selected >= visible {
+		start = b.selected - visible + 1
+	}
+	end := start + visible
+	if end > len(b.matches) {
+		end = len(b.matches)
+	}
+
+	heading := "Conversations"
+	if b.archived {
+		heading = "Archived conversations"
+	}
+	lines := []string{aiStyle.Render(fmt.Sprintf("%s (%d/%d)", heading, len(b.matches), len(b.conversations))), ""}
+	for i := start; i < end; i++ {
+		conversation := b.matches[i]
+		marker := "  "
+		if conversation.ID == m.conversationID {
+			marker = "* "
+		}
+		title := conversation.Title
+		if conversation.Pinned {
+			title = pinnedMarker + title
+		}
+		label := marker + title
+		var tags string
+		for _, tag := range conversation.Tags {
+			tags += " #" + tag
+		}
+		// Tags give way to the title when the list is narrow
+		if room := listWidth - 1 - lipgloss.Width(label); room < lipgloss.Width(tags) {
+			tags = ""
+		}
+		// Cut by display width, as wide characters take two columns
+		label = ansi.Truncate(label, listWidth-1, "...")
+		if i == b.selected {
+			label = selectedStyle.Render(label)
+		}
+		lines = append(lines, label+branchStyle.Render(tags))
+	}
+	if len(b.matches) == 0 {
+		lines = append(lines, branchStyle.Render("  No matching conversations"))
+	}
+	list := lipgloss.NewStyle().Width(listWidth).MaxWidth(listWidth).Render(strings.Join(lines, "\n"))
+
+	var preview string
+	if conversation, ok := b.selectedConversation(); ok && previewWidth > 10 {
+		preview = m.conversationPreview(conversation, previewWidth)
+	}
+	preview = lipgloss.NewStyle().
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderLeft(true).
+		BorderForeground(completionBoxStyle.GetBorderLeftForeground()).
+		PaddingLeft(1).
+		Render(preview)
+
+	return lipgloss.NewStyle().Height(height).MaxHeight(height).Render(lipgloss.JoinHorizontal(lipgloss.Top, list, preview))
+}
+
+// browserInput renders the filter, rename or delete prompt below the browser
+func (m ChatModel) browserInput() string {
+	b := m.browser
+	switch {
+	case b.confirmDelete:
+		conversation, _ := b.selectedConversation()
+		return errorStyle.Render(fmt.Sprintf("Delete %q and all its messages? (y/n)", conversation.Title))
+	case b.renaming:
+		return b.rename.View()
+	case b.tagging:
+		return b.tags.View()
+	default:
+		return b.filter.View()
+	}
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// TestBrowserWideTitles checks that titles and previews in wide characters are cut on character boundaries
+func TestBrowserWideTitles(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(200, 30)
+	title := strings.Repeat("漢", 44)
+	h.db.UpdateConversationTitle(context.Background(), h.conversationID, title)
+	h.db.AddMessage(context.Background(), h.conversationID, uuid.NullUUID{}, llm.RoleUser, "", strings.Repeat("字", 500))
+
+	h.press(tea.KeyCtrlO)
+	view := h.model.View()
+
+	if !utf8.ValidString(view) || strings.ContainsRune(view, 0) {
+		t.Error("the browser split a character")
+	}
+	if !strings.Contains(view, "漢...") {
+		t.Errorf("view doesn't show the title cut to the list width:\n%s", view)
+	}
+}
@@ -4,30 +4,119 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/google/uuid"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/project"
 )
 
 // DBInterface defines the database operations needed by the TUI
 type DBInterface interface {
-	AddMessage(ctx context.Context, conversationID uuid.UUID, role, content string) (DBMessage, error)
+	AddMessage(ctx context.Context, conversationID uuid.UUID, parentID uuid.NullUUID, role, model, content string) (uuid.UUID, error)
+	UpdateConversationModel(ctx context.Context, conversationID uuid.UUID, model string) error
+	SetActiveMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID) error
 	GenerateTitle(ctx context.Context, conversationID uuid.UUID) (string, error)
+	UpdateConversationProfile(ctx context.Context, conversationID uuid.UUID, profile string) error
+	UpdateConversationSummary(ctx context.Context, conversationID uuid.UUID, summary string, messageCount int) error
+	CreateConversation(ctx context.Context, title, model, profile, repoPath string) (db.Conversation, error)
+	GetConversation(ctx context.Context, conversationID uuid.UUID) (db.Conversation, error)
+	GetMessages(ctx context.Context, conversationID uuid.UUID) ([]db.Message, error)
+	UpdateConversationTitle(ctx context.Context, conversationID uuid.UUID, title string) error
+	DeleteConversation(ctx context.Context, conversationID uuid.UUID) error
+	AddAttachments(ctx context.Context, messageID uuid.UUID, attachments []db.Attachment) error
+	FindConversations(ctx context.Context, filter db.ConversationFilter) ([]db.Conversation, error)
+	UpdateConversationTags(ctx context.Context, conversationID uuid.UUID, add, remove []string) ([]string, error)
+	SetConversationPinned(ctx context.Context, conversationID uuid.UUID, pinned bool) error
+	SetConversationArchived(ctx context.Context, conversationID uuid.UUID, archived bool) error
+	MarkMessageCached(ctx context.Context, messageID uuid.UUID) error
 }
 
-// DBMessage is an alias for database.Message to avoid import cycle
-type DBMessage = interface{}
+// ChatOptions configures a chat session
+type ChatOptions struct {
+	// Backend is the provider and model the session starts with.
+	// The current LLM is used when it is left empty.
+	Backend llm.Backend
+	
+	// Profile is the system prompt profile the session starts with.
+	// The default profile is used when it is left empty.
+	Profile llm.Profile
+	
+	// Project is the git repository the chat runs in, if any
+	Project *project.Project
+	
+	// SystemContext is appended to the profile's system prompt, e.g. project instructions
+	SystemContext string
+	
+	// Messages holds every stored message of a continued conversation, across all branches
+	Messages []StoredMessage
+	
+	// ActiveMessageID is the last message of the branch to continue.
+	// The most recent message is used when it is not set.
+	ActiveMessageID uuid.NullUUID
+	
+	// Summary is the running summary of the first SummarizedCount turns of the active branch
+	Summary         string
+	SummarizedCount int
+	
+	// Themes is the theme configuration. The zero value picks a theme from the terminal background.
+	Themes ThemeConfig
+	
+	// PromptHistory holds past prompts and the unsent draft.
+	// Prompts are only kept for the session when it is nil.
+	PromptHistory *PromptHistory
+	
+	// Attachments are files sent with the first message
+	Attachments []llm.Attachment
+	
+	// Plain runs a line-based chat on stdin and stdout instead of taking over the screen
+	Plain bool
+}
+
+// StoredMessage is a saved message of a conversation
+type StoredMessage struct {
+	ID       uuid.UUID
+	ParentID uuid.NullUUID // Message this one replies to, unset for the first message
+	Role     string
+	Model    string // Backend that wrote an assistant message
+	Content  string
+	Cached   bool   // Answered from the response cache
+	Time     time.Time
+	Attachments []llm.Attachment // Files sent with a user message
+}
 
 // StartChat starts the chat TUI
-func StartChat(db DBInterface, conversationID uuid.UUID, loadedMessages []Message) error {
+func StartChat(db DBInterface, conversationID uuid.UUID, loadedMessages []Message, opts ChatOptions) error {
+	if opts.Plain {
+		return startPlainChat(db, conversationID, loadedMessages, opts)
+	}
+	
+	// Fall back to the automatic theme rather than refusing to start
+	themes, err := LoadThemeConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if _, err := themes.ActiveTheme(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v, using the %s theme\n", err, AutoTheme)
+		themes.Theme = AutoTheme
+	}
+	opts.Themes = themes
+	
+	prompts, err := LoadPromptHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	opts.PromptHistory = prompts
+	
+	// Mouse reporting is left off so the terminal's own text selection keeps working
 	p := tea.NewProgram(
-		NewChatModel(db, conversationID, loadedMessages),
+		NewChatModel(db, conversationID, loadedMessages, opts),
 		tea.WithAltScreen(),
-		tea.WithMouseCellMotion(),
-		tea.WithMouseAllMotion(),  // Enable all mouse motion for text selection
 	)
 
-	_, err := p.Run()
+	_, err = p.Run()
 	if err != nil {
 		fmt.Printf("Error running chat: %v\n", err)
 		os.Exit(1)
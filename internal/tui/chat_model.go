@@ -1,7 +1,6 @@
 package tui
 
 import (
-	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -13,16 +12,22 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/google/uuid"
 	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/project"
+	"github.com/hawk/mcgraph/internal/secrets"
 )
 
 // Message represents a single message in the chat
 type Message struct {
+	ID            uuid.UUID // Saved message ID, uuid.Nil for messages that aren't saved
+	Model         string    // Backend that wrote an assistant message
+	Cached        bool      // Answered from the response cache
 	Content       string  // Full content of the message
 	VisibleContent string  // For AI messages, this grows during animation
 	IsUser        bool
 	Time          time.Time
 	IsComplete    bool    // Whether the typing animation is complete
 	IsSystem      bool    // Whether this is a system message (not from user or AI)
+	Attachments   []string // Names of the files sent with a user message
 }
 
 // typingMsg is a message for typing animation ticks
@@ -48,43 +53,64 @@ type ChatModel struct {
 	quitting         bool
 	db               DBInterface
 	conversationID   uuid.UUID
+	completion       completionState // Tab completion popup for slash commands
+	profile          llm.Profile     // System prompt and generation parameters
+	project          *project.Project // Git repository the chat runs in, if any
+	systemContext    string          // Extra context appended to the system prompt
+	history          []llm.Message   // User and assistant turns sent to the model
+	summary          string          // Running summary of the folded turns
+	summarizedCount  int             // Number of leading history turns covered by summary
+	lastUsage        llm.Usage       // Tokens used by the last request
+	lastModel        string          // Model that answered the last request
+	backend          llm.Backend     // Provider and model answering in this session
+	tree             *messageTree    // Every saved message, across all branches
+	intro            []Message       // Messages shown before the conversation, like the welcome message
+	selected         int             // Index of the selected message in messages, -1 when not selecting
+	selectedOffset   int             // Line of the selected message in the viewport
+	editing          bool            // Whether the input holds an edited message
+	editParent       uuid.NullUUID   // Parent of the message being edited
+	comparison       *comparisonState // Answers of several LLMs shown side by side, if any
+	focusedBlock     int             // Code block of the focused message last copied, 0 for none
+	saving           *saveBlockState // Code block waiting for the path to save it to
+	notice           string          // Feedback shown in the status line until the next key
+	themes           ThemeConfig     // Configured and user themes
+	theme            Theme           // Active theme
+	shownTheme       Theme           // Theme the chat is drawn in, differs from theme while previewing
+	browser          *browserState   // Conversation browser shown in place of the messages, if open
+	prompts          *PromptHistory  // Prompts sent in this and past sessions
+	historyIndex     int             // Prompt shown from the history, -1 when not browsing it
+	historyStash     string          // Input typed before browsing the history
+	search           *historySearch  // Reverse search through past prompts, if active
+	draftSeq         int             // Bumped on every change so only the last scheduled draft save runs
+	savedDraft       string          // Draft as last saved
+	attachments      []llm.Attachment // Files to send with the next message
+	onChunk          func(string)     // Receives answers as they stream in, set by the plain chat
+	instant          bool             // Show answers whole instead of typing them out, set by the plain chat
 }
 
-// Message styles
+// Message styles, set by ApplyTheme
 var (
-	userStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#5DADE2")).
-			PaddingLeft(2).
-			PaddingRight(2).
-			Bold(true)
-
-	aiStyle = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#58D68D")).
-		Bold(true)
-
-	timestampStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#A0A0A0")).
-			Italic(true).
-			MarginRight(1)
-
-	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#E74C3C")).
-			MarginLeft(2).
-			Bold(true)
-
-	infoStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#F4D03F")).
-			MarginLeft(2).
-			Italic(true)
-			
-	systemStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FF9933")).
-			MarginLeft(2).
-			Italic(true)
+	userStyle      lipgloss.Style
+	aiStyle        lipgloss.Style
+	timestampStyle lipgloss.Style
+	errorStyle     lipgloss.Style
+	infoStyle      lipgloss.Style
+	systemStyle    lipgloss.Style
+	spinnerStyle   lipgloss.Style
+	redactedStyle  lipgloss.Style
 )
 
 // NewChatModel creates a new chat model
-func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Message) ChatModel {
+func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Message, opts ChatOptions) ChatModel {
+	profile := opts.Profile
+	if profile.Name == "" {
+		profile = llm.DefaultProfile()
+	}
+	backend := opts.Backend
+	if backend.LLM == "" {
+		backend = llm.CurrentBackend()
+	}
+	
 	// Create a textarea for input
 	ta := textarea.New()
 	ta.Placeholder = "Ask a question..."
@@ -97,7 +123,7 @@ func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Mes
 	// Create a spinner
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	s.Style = spinnerStyle
 
 	// Create a viewport for displaying messages
 	vp := viewport.New(80, 20)
@@ -113,8 +139,7 @@ func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Mes
 		messages = loadedMessages
 	} else {
 		// Add welcome message
-		currentLLM := llm.GetCurrentLLM()
-		welcomeMsg := fmt.Sprintf("Welcome to McGraph Chat! Current LLM: %s\nType your questions and press Enter to submit.\nPress Alt+Enter for a new line.\nType Ctrl+C to quit.", currentLLM)
+		welcomeMsg := fmt.Sprintf("Welcome to McGraph Chat! Current LLM: %s (profile: %s)\nType your questions and press Enter to submit.\nPress Alt+Enter for a new line.\nType Ctrl+C to quit.", backend.Resolved(), profile.Name)
 
 		messages = []Message{
 			{
@@ -138,6 +163,41 @@ func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Mes
 		thinkingDots:   1,  // Start with one dot
 		db:             db,
 		conversationID: conversationID,
+		profile:        profile,
+		backend:        backend,
+		project:        opts.Project,
+		systemContext:  opts.SystemContext,
+		summary:        opts.Summary,
+		summarizedCount: opts.SummarizedCount,
+		tree:           newMessageTree(opts.Messages, opts.ActiveMessageID),
+		intro:          messages,
+		selected:       -1,
+		attachments:    opts.Attachments,
+	}
+	// Pick up the prompt that was left unsent last time
+	model.prompts = opts.PromptHistory
+	if model.prompts == nil {
+		model.prompts = &PromptHistory{}
+	}
+	model.historyIndex = -1
+	if draft := model.prompts.Draft(); draft != "" {
+		model.textarea.SetValue(draft)
+		model.savedDraft = draft
+		model.notice = "Restored your unsent draft"
+	}
+	
+	theme, err := opts.Themes.ActiveTheme()
+	if err != nil {
+		theme = builtinThemes["dark"]
+	}
+	model.themes = opts.Themes
+	model.theme = theme
+	model.setTheme(theme)
+	model.showActiveBranch()
+	
+	// A summary can't cover more turns than there are
+	if model.summarizedCount > len(model.history) {
+		model.summarizedCount = len(model.history)
 	}
 	
 	// If we're continuing a conversation, we need to update the viewport content
@@ -151,16 +211,33 @@ func NewChatModel(db DBInterface, conversationID uuid.UUID, loadedMessages []Mes
 	return model
 }
 
+// tick schedules animation frames and delayed saves, tests replace it to run them at once
+var tick = tea.Tick
+
+// startTyping starts typing out the last message, or shows it whole at once
+// when the chat has no screen to animate it on
+func (m *ChatModel) startTyping() tea.Cmd {
+	if m.instant {
+		last := &m.messages[len(m.messages)-1]
+		last.VisibleContent = last.Content
+		last.IsComplete = true
+		m.updateViewportContent()
+		return nil
+	}
+	m.typingActive = true
+	return typingAnimation()
+}
+
 // typingAnimation returns a command that sends typing tick messages
 func typingAnimation() tea.Cmd {
-	return tea.Tick(time.Millisecond*20, func(t time.Time) tea.Msg {
+	return tick(time.Millisecond*20, func(t time.Time) tea.Msg {
 		return typingMsg{}
 	})
 }
 
 // thinkingAnimation returns a command that animates the "Thinking..." dots
 func thinkingAnimation() tea.Cmd {
-	return tea.Tick(time.Millisecond*200, func(t time.Time) tea.Msg {
+	return tick(time.Millisecond*200, func(t time.Time) tea.Msg {
 		return thinkingTickMsg{}
 	})
 }
@@ -183,10 +260,90 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle different message types
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		m.notice = ""
+		
+		// The save prompt takes the input until it is confirmed or cancelled
+		if m.saving != nil && m.handleSaveKey(msg) {
+			return m, nil
+		}
+		
+		// So does the reverse search through past prompts
+		if m.search != nil {
+			m.handleSearchKey(msg)
+			return m, nil
+		}
+		
+		// The conversation browser takes every key while it is open
+		if m.browser != nil {
+			return m, m.handleBrowserKey(msg)
+		}
+		
+		// The completion popup gets first pick of navigation keys
+		if handled, cmd := m.handleCompletionKey(msg); handled {
+			m.previewTheme()
+			return m, cmd
+		}
+		
+		// Then the comparison view and message selection
+		if m.comparison != nil {
+			if handled, cmd := m.handleComparisonKey(msg); handled {
+				return m, cmd
+			}
+		}
+		if m.selected >= 0 {
+			if handled, cmd := m.handleSelectionKey(msg); handled {
+				return m, cmd
+			}
+		}
+		
 		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
-			m.quitting = true
-			return m, tea.Quit
+		case tea.KeyEsc:
+			if m.editing {
+				// Leave the original message as it was
+				m.cancelEdit()
+				return m, nil
+			}
+			return m, m.quit()
+		
+		case tea.KeyCtrlC:
+			return m, m.quit()
+		
+		case tea.KeyCtrlR:
+			// Search past prompts
+			m.startHistorySearch()
+			return m, nil
+		
+		case tea.KeyCtrlG:
+			// Compose the prompt in an external editor
+			return m, m.openEditor()
+		
+		case tea.KeyCtrlO:
+			// Browse, open, rename and delete conversations
+			m.openBrowser()
+			return m, nil
+		
+		case tea.KeyCtrlN:
+			m.newConversation()
+			return m, nil
+		
+		case tea.KeyShiftUp:
+			// Select past messages to copy, edit or regenerate
+			if !m.waitingForResp && !m.typingActive {
+				m.selectMessage(-1)
+				return m, nil
+			}
+		
+		case tea.KeyUp:
+			// Up on the first line recalls older prompts
+			if m.textarea.Line() == 0 && m.recallPrompt(-1) {
+				return m, nil
+			}
+		
+		case tea.KeyDown:
+			// Down on the last line goes back towards the prompt being typed
+			if m.historyIndex >= 0 && m.textarea.Line() == m.textarea.LineCount()-1 && m.recallPrompt(1) {
+				return m, nil
+			}
 		
 		case tea.KeyEnter:
 			// Check if Alt is pressed with Enter
@@ -196,124 +353,174 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			
-			// Only handle regular Enter when not waiting for a response
-			if !m.waitingForResp && !m.typingActive {
-				// Only send if there's content
-				input := strings.TrimSpace(m.textarea.Value())
-				if input != "" {
-					// Check for special commands
-					if input == "/summarize" {
-						// Don't add the command to the visible messages
-						m.textarea.Reset()
-						
-						// Set waiting state
-						m.waitingForResp = true
-						
-						// Update viewport with a system message
-						m.messages = append(m.messages, Message{
-							Content:       "Generating conversation summary...",
-							VisibleContent: "Generating conversation summary...",
-							IsUser:        false,
-							Time:          time.Now(),
-							IsComplete:    true,
-							IsSystem:      true, // Mark as system message
-						})
-						m.updateViewportContent()
-						m.viewport.GotoBottom()
-						
-						// Generate summary
-						return m, m.getSummary()
-					} else if strings.HasPrefix(input, "/") && len(input) > 1 {
-						// This might be an extension command
-						m.textarea.Reset()
-						
-						// Parse the command: /extension command args...
-						parts := strings.SplitN(input[1:], " ", 3)
-						extName := parts[0]
-						
-						if extName == "help" {
-							// Show help for all extensions
-							return m, m.handleHelp()
-						}
-						
-						if len(parts) >= 2 {
-							cmdName := parts[1]
-							var args []string
-							
-							if len(parts) > 2 {
-								// Split the remaining part by spaces, respecting quotes
-								args = splitArgs(parts[2])
-							}
-							
-							// Execute the extension command
-							return m, m.executeExtensionCommand(extName, cmdName, args)
-						} else {
-							// Just an extension name without a command
-							m.messages = append(m.messages, Message{
-								Content:       fmt.Sprintf("Please specify a command for the '%s' extension. Type /help for available commands.", extName),
-								VisibleContent: fmt.Sprintf("Please specify a command for the '%s' extension. Type /help for available commands.", extName),
-								IsUser:        false,
-								Time:          time.Now(),
-								IsComplete:    true,
-								IsSystem:      true,
-							})
-							m.updateViewportContent()
-							m.viewport.GotoBottom()
-							return m, nil
-						}
-					}
+			// Enter is ignored while an answer is pending, rather than adding a line to the next question
+			if m.waitingForResp || m.typingActive {
+				return m, nil
+			}
+
+			// Only send if there's content
+			input := strings.TrimSpace(m.textarea.Value())
+			if input != "" {
+				m.recordPrompt(input)
+				
+				// Check for special commands
+				if input == "/summarize" {
+					// Don't add the command to the visible messages
+					m.textarea.Reset()
+					
+					// Set waiting state
+					m.waitingForResp = true
 					
-					// Normal message flow
-					// Add user message to the UI
+					// Update viewport with a system message
 					m.messages = append(m.messages, Message{
-						Content:       input,
-						VisibleContent: input, // User messages show immediately
-						IsUser:        true,
+						Content:       "Generating conversation summary...",
+						VisibleContent: "Generating conversation summary...",
+						IsUser:        false,
 						Time:          time.Now(),
 						IsComplete:    true,
+						IsSystem:      true, // Mark as system message
 					})
+					m.updateViewportContent()
+					m.viewport.GotoBottom()
 					
-					// Save user message to database
-					if m.db != nil {
-						ctx := context.Background()
-						_, err := m.db.AddMessage(ctx, m.conversationID, "user", input)
-						if err != nil {
-							// Just log the error, don't interrupt the user experience
-							m.err = fmt.Errorf("failed to save message: %w", err)
-						}
-						
-						// Generate title from first message if this is the first message
-						if len(m.messages) == 2 { // Welcome message + first user message
-							go func() {
-								_, err := m.db.GenerateTitle(ctx, m.conversationID)
-								if err != nil {
-									// Just log the error
-									m.err = fmt.Errorf("failed to generate title: %w", err)
-								}
-							}()
-						}
+					// Generate summary
+					return m, m.getSummary()
+				} else if strings.HasPrefix(input, "/") && len(input) > 1 {
+					// This might be an extension command
+					m.textarea.Reset()
+					
+					// Parse the command: /extension command args...
+					parts := strings.SplitN(input[1:], " ", 3)
+					extName := parts[0]
+					
+					if extName == "help" {
+						// Show help for all extensions
+						return m, m.handleHelp()
 					}
 					
-					// Clear input
-					m.textarea.Reset()
+					if extName == "compare" {
+						// Fan the last question out to several LLMs
+						return m, m.startComparison(splitArgs(strings.Join(parts[1:], " ")))
+					}
 					
-					// Set waiting state
-					m.waitingForResp = true
+					if extName == "context" {
+						// Show what is sent to the model
+						m.showContext()
+						return m, nil
+					}
 					
-					// Update viewport with the new message
-					m.updateViewportContent()
+					if extName == "project" {
+						// Show or extend the project context
+						m.handleProjectCommand(splitArgs(strings.Join(parts[1:], " ")))
+						return m, nil
+					}
 					
-					// Request answer from LLM
-					return m, m.getResponse(input)
+					if extName == "model" {
+						// Switch the provider and model
+						m.switchModel(splitArgs(strings.Join(parts[1:], " ")))
+						return m, nil
+					}
+					
+					if extName == "theme" {
+						// Switch the color theme or code style
+						m.switchTheme(splitArgs(strings.Join(parts[1:], " ")))
+						return m, nil
+					}
+					
+					if extName == "attach" {
+						// Attach files to the next message
+						m.handleAttachCommand(splitArgs(strings.Join(parts[1:], " ")))
+						return m, nil
+					}
+					
+					if extName == "profile" {
+						// Switch the system prompt profile
+						m.switchProfile(splitArgs(strings.Join(parts[1:], " ")))
+						return m, nil
+					}
+					
+					if len(parts) >= 2 {
+						cmdName := parts[1]
+						var args []string
+						
+						if len(parts) > 2 {
+							// Split the remaining part by spaces, respecting quotes
+							args = splitArgs(parts[2])
+						}
+						
+						// Execute the extension command
+						return m, m.executeExtensionCommand(extName, cmdName, args)
+					} else {
+						// Just an extension name without a command
+						m.messages = append(m.messages, Message{
+							Content:       fmt.Sprintf("Please specify a command for the '%s' extension. Type /help for available commands.", extName),
+							VisibleContent: fmt.Sprintf("Please specify a command for the '%s' extension. Type /help for available commands.", extName),
+							IsUser:        false,
+							Time:          time.Now(),
+							IsComplete:    true,
+							IsSystem:      true,
+						})
+						m.updateViewportContent()
+						m.viewport.GotoBottom()
+						return m, nil
+					}
+				}
+				
+				// Secrets are redacted, or the message is held back, before anything is sent or saved
+				checked, findings, err := checkSecrets(input, m.attachments)
+				if err != nil {
+					m.addSystemMessage(fmt.Sprintf("Not sent: %v. Remove them and press Enter again, or set %s=redact to send them redacted.", err, secrets.PolicyEnvVar))
+					return m, nil
+				}
+				input = checked.Content
+				m.attachments = checked.Attachments
+				
+				// An edited message branches off where the original was
+				if m.editing {
+					m.editing = false
+					m.branchFrom(m.editParent.UUID)
 				}
+				
+				// Normal message flow
+				// Save user message to database
+				attachments := m.attachments
+				m.attachments = nil
+				saved := m.saveMessage(llm.RoleUser, "", input, attachments)
+				
+				// Add user message to the UI
+				m.messages = append(m.messages, Message{
+					ID:            saved.ID,
+					Content:       input,
+					VisibleContent: input, // User messages show immediately
+					IsUser:        true,
+					Time:          time.Now(),
+					IsComplete:    true,
+					Attachments:   attachmentNames(attachments),
+				})
+				
+				if len(findings) > 0 {
+					m.addSystemMessage(describeSecrets(findings))
+				}
+				
+				// Add the question to the history sent to the model
+				m.history = append(m.history, llm.Message{Role: llm.RoleUser, Content: input, Attachments: attachments})
+				
+				// Clear input
+				m.textarea.Reset()
+				
+				// Set waiting state
+				m.waitingForResp = true
+				
+				// Update viewport with the new message
+				m.updateViewportContent()
+				
+				// Request answer from LLM
+				return m, m.getResponse(m.activeProfile())
 			}
 		}
 		
 	// Window size changed
 	case tea.WindowSizeMsg:
-		headerHeight := 1
-		footerHeight := 4 // textarea + padding
-		
 		isFirstResize := !m.ready
 		
 		if isFirstResize {
@@ -325,8 +532,7 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.height = msg.Height
 		}
 		
-		m.viewport.Width = msg.Width
-		m.viewport.Height = msg.Height - headerHeight - footerHeight
+		m.resizeViewport()
 		m.textarea.SetWidth(msg.Width)
 		
 		m.updateViewportContent()
@@ -354,6 +560,8 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.updateViewportContent()
 			m.viewport.GotoBottom()
 		} else {
+			var title tea.Cmd
+			
 			// For system responses like summaries, don't save to DB
 			if msg.isSystemResponse {
 				// Replace the "generating" message with the actual response
@@ -380,23 +588,33 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					})
 				}
 			} else {
+				m.lastUsage = msg.usage
+				m.lastModel = msg.model
+				
+				// Older turns were folded into the summary to fit the context window
+				if msg.summarizedCount > m.summarizedCount {
+					m.applySummary(msg.summary, msg.summarizedCount)
+				}
+				
+				// Save assistant message to database
+				saved := m.saveAnswer(msg.backend, llm.Response{Content: msg.response, Cached: msg.cached})
+				
 				// Add the message with no visible content initially
 				m.messages = append(m.messages, Message{
+					ID:            saved.ID,
+					Model:         saved.Model,
+					Cached:        saved.Cached,
 					Content:       msg.response,
 					VisibleContent: "", // Start empty for typing effect
 					IsUser:        false,
 					Time:          time.Now(),
 					IsComplete:    false,
 				})
+				m.history = append(m.history, llm.Message{Role: llm.RoleAssistant, Content: msg.response})
 				
-				// Save assistant message to database
-				if m.db != nil {
-					ctx := context.Background()
-					_, err := m.db.AddMessage(ctx, m.conversationID, "assistant", msg.response)
-					if err != nil {
-						// Just log the error, don't interrupt the user experience
-						m.err = fmt.Errorf("failed to save message: %w", err)
-					}
+				// Replace the title made from the first question once it has an answer
+				if len(m.history) == 2 && m.summarizedCount == 0 {
+					title = m.generateTitle(msg.backend, m.history[0].Content, msg.response)
 				}
 			}
 			
@@ -404,11 +622,14 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.updateViewportContent()
 			m.viewport.GotoBottom()
 			
-			// Start the typing animation
-			m.typingActive = true
-			return m, typingAnimation()
+			return m, tea.Batch(m.startTyping(), title)
 		}
 		
+	// Answers of several LLMs to compare
+	case comparisonResponse:
+		m.waitingForResp = false
+		m.handleComparisonResponse(msg)
+		
 	// Extension command response
 	case extCommandResponse:
 		m.waitingForResp = false
@@ -441,11 +662,9 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				IsComplete:    false,
 			})
 			
-			// Start the typing animation
-			m.typingActive = true
 			m.updateViewportContent()
 			m.viewport.GotoBottom()
-			return m, typingAnimation()
+			return m, m.startTyping()
 		}
 		
 		// Update the viewport
@@ -471,6 +690,27 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		
 		return m, cmd
 
+	// The conversation kept the title it had
+	case titleFailedMsg:
+		m.err = msg.err
+		return m, nil
+
+	// Save the draft once typing pauses
+	case draftSaveMsg:
+		if msg.seq == m.draftSeq {
+			m.saveDraft()
+		}
+		return m, nil
+	
+	// Load the prompt composed in the editor
+	case editorFinishedMsg:
+		if msg.err != nil {
+			m.notice = msg.err.Error()
+			return m, nil
+		}
+		m.textarea.SetValue(msg.content)
+		return m, nil
+	
 	// Handle typing animation
 	case typingMsg:
 		if m.typingActive {
@@ -504,6 +744,7 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if len(m.messages[lastIdx].VisibleContent) >= len(fullContent) {
 					m.messages[lastIdx].IsComplete = true
 					m.typingActive = false
+					m.updateViewportContent()
 				}
 			}
 		}
@@ -512,8 +753,18 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle updates for text input and viewport
 	m.textarea, tiCmd = m.textarea.Update(msg)
 	m.viewport, vpCmd = m.viewport.Update(msg)
+	
+	// Keep the completion popup in sync with what was typed
+	var draftCmd tea.Cmd
+	if _, ok := msg.(tea.KeyMsg); ok {
+		if m.completion.visible {
+			m.refreshCompletions()
+			m.previewTheme()
+		}
+		draftCmd = m.scheduleDraftSave()
+	}
 
-	return m, tea.Batch(tiCmd, vpCmd, spCmd)
+	return m, tea.Batch(tiCmd, vpCmd, spCmd, draftCmd)
 }
 
 // View renders the UI
@@ -526,11 +777,23 @@ func (m ChatModel) View() string {
 		return "Initializing..."
 	}
 	
-	// Render the messages viewport
+	// Render the messages viewport, or the answers being compared in its place
 	viewportContent := m.viewport.View()
+	if m.comparison != nil {
+		viewportContent = m.renderComparison()
+	}
+	if m.browser != nil {
+		viewportContent = m.renderBrowser()
+	}
 	
 	// Render the input area
 	inputArea := m.textarea.View()
+	if m.browser != nil {
+		inputArea = m.browserInput()
+	}
+	if m.search != nil {
+		inputArea = m.renderSearch()
+	}
 	
 	// Show spinner if waiting for response
 	if m.waitingForResp {
@@ -539,27 +802,92 @@ func (m ChatModel) View() string {
 		inputArea = fmt.Sprintf("%s %s", m.spinner.View(), thinkingText)
 	}
 	
+	// Show the completion popup between the messages and the input
+	if m.completion.visible {
+		inputArea = m.renderCompletions() + "\n" + inputArea
+	}
+	
 	// Add a status line with keyboard shortcuts
 	var statusLine string
-	statusLine = "\n[Ctrl+C: Quit | Alt+Enter: New Line]"
+	switch {
+	case m.search != nil:
+		statusLine = "\n[Type: Search Past Prompts | Ctrl+R: Older Match | Enter: Use | Esc: Cancel]"
+	case m.browser != nil && m.browser.renaming:
+		statusLine = "\n[Enter: Save Title | Esc: Cancel]"
+	case m.browser != nil && m.browser.tagging:
+		statusLine = "\n[Enter: Save Tags (separated by spaces) | Esc: Cancel]"
+	case m.browser != nil:
+		statusLine = "\n[Type: Filter, #tag | Enter: Open | Ctrl+N: New | Ctrl+R: Rename | Ctrl+T: Tags | Ctrl+P: Pin | Ctrl+A: Archive | Ctrl+D: Delete | Tab: Archived | Esc: Close]"
+	case m.comparison != nil:
+		statusLine = "\n[Left/Right: Choose Answer | Up/Down: Scroll | Enter: Keep | Esc: Discard]"
+	case m.saving != nil:
+		statusLine = fmt.Sprintf("\n[Enter: Save Code Block %d to the Path Above | Esc: Cancel]", m.saving.index)
+	case m.selected >= 0:
+		statusLine = "\n[j/k: Move | y: Copy | 1-9: Copy Code Block | s: Save Code Block | Left/Right: Branch | e: Edit | r: Regenerate | Esc: Done]"
+	case m.editing:
+		statusLine = "\n[Enter: Send as New Branch | Esc: Cancel Edit]"
+	default:
+		statusLine = "\n[Ctrl+C: Quit | Alt+Enter: New Line | Tab: Complete | Up/Down: Past Prompts | Ctrl+R: Search | Ctrl+G: Editor | Shift+Up: Focus Messages | Ctrl+O: Conversations | Ctrl+N: New]"
+	}
+	statusLine += " " + m.sessionStatus()
+	if m.notice != "" {
+		statusLine += " " + infoStyle.Render(m.notice)
+	}
 	
 	// Put it all together
 	return fmt.Sprintf("%s\n\n%s%s", viewportContent, inputArea, statusLine)
 }
 
-// getResponse requests a response from the LLM
-func (m ChatModel) getResponse(input string) tea.Cmd {
+// resizeViewport recalculates the viewport size from the window size and
+// whatever is currently shown below it
+func (m *ChatModel) resizeViewport() {
+	headerHeight := 1
+	footerHeight := 4 // textarea + padding
+	
+	m.viewport.Width = m.width
+	m.viewport.Height = m.height - headerHeight - footerHeight - m.completionHeight()
+	if m.viewport.Height < 1 {
+		m.viewport.Height = 1
+	}
+}
+
+// getResponse requests a response to the conversation history from the LLM with profile,
+// folding the oldest turns into the summary first if they don't fit the context
+func (m ChatModel) getResponse(profile llm.Profile) tea.Cmd {
+	history := append([]llm.Message(nil), m.history...)
+	summary := m.summary
+	summarizedCount := m.summarizedCount
+	backend := m.backend
+	onChunk := m.onChunk
+	
 	return func() tea.Msg {
-		response, err := llm.GetResponse(input)
+		window, summary, summarizedCount, err := fitContext(backend, history, summary, summarizedCount, profile)
+		if err != nil {
+			return llmResponse{err: err}
+		}
+		
+		response, err := llm.ChatStream(backend, window, profile.WithSystemContext(llm.SummaryContext(summary)), onChunk)
 		return llmResponse{
-			response: response,
-			err:      err,
+			response:        response.Content,
+			err:             err,
+			usage:           response.Usage,
+			model:           response.Model,
+			cached:          response.Cached,
+			backend:         llm.Backend{LLM: backend.LLM, Model: response.Model},
+			summary:         summary,
+			summarizedCount: summarizedCount,
 		}
 	}
 }
 
+// activeProfile returns the profile with the session's extra context applied
+func (m ChatModel) activeProfile() llm.Profile {
+	return m.profile.WithSystemContext(m.systemContext)
+}
+
 // getSummary generates a summary of the conversation
 func (m ChatModel) getSummary() tea.Cmd {
+	backend := m.backend
 	return func() tea.Msg {
 		// Build a conversation history string
 		var historyBuilder strings.Builder
@@ -590,10 +918,10 @@ CONVERSATION:
 SUMMARY:`, historyBuilder.String())
 		
 		// Get response from LLM
-		response, err := llm.GetResponse(prompt)
+		response, err := llm.ChatWith(backend, []llm.Message{{Role: llm.RoleUser, Content: prompt}}, llm.DefaultProfile())
 		
 		return llmResponse{
-			response: "# Conversation Summary\n\n" + response,
+			response: "# Conversation Summary\n\n" + response.Content,
 			err:      err,
 			isSystemResponse: true,
 		}
@@ -605,6 +933,12 @@ type llmResponse struct {
 	response        string
 	err             error
 	isSystemResponse bool
+	usage           llm.Usage // Tokens used by the request
+	model           string    // Model that answered
+	cached          bool      // Answered from the response cache
+	backend         llm.Backend // Provider and model that answered
+	summary         string    // Running summary after the request
+	summarizedCount int       // Number of history turns covered by summary
 }
 
 // updateViewportContent updates the viewport with formatted messages
@@ -615,12 +949,24 @@ func (m *ChatModel) updateViewportContent() {
 		// Format timestamp
 		timestamp := timestampStyle.Render(msg.Time.Format("15:04:05"))
 		
+		// Mark the selected message and show which alternative this is
+		if i == m.selected {
+			m.selectedOffset = strings.Count(sb.String(), "\n")
+			timestamp = selectedStyle.Render(msg.Time.Format("15:04:05"))
+		}
+		if label := m.tree.branchLabel(msg.ID); msg.ID != uuid.Nil && label != "" {
+			timestamp += branchStyle.Render(label) + " "
+		}
+		
 		if msg.IsUser {
 			// Format user message
 			sb.WriteString(fmt.Sprintf("%s %s: %s\n\n", 
 				timestamp, 
 				userStyle.Render("You"),
-				msg.Content))
+				highlightRedactions(msg.Content)))
+			if len(msg.Attachments) > 0 {
+				sb.WriteString(infoStyle.Render("Attached: "+strings.Join(msg.Attachments, ", ")) + "\n\n")
+			}
 		} else if msg.IsSystem {
 			// Format system message
 			sb.WriteString(fmt.Sprintf("%s %s: %s\n\n", 
@@ -628,13 +974,24 @@ func (m *ChatModel) updateViewportContent() {
 				systemStyle.Render("System"),
 				msg.VisibleContent)) // Use visibleContent for animation
 		} else {
-			// Format AI message with syntax highlighting for code blocks
-			// Use the visibleContent for the typing animation effect
-			highlightedContent := Highlight(msg.VisibleContent)
-			sb.WriteString(fmt.Sprintf("%s %s: %s\n\n", 
+			// Render the AI message as Markdown, using the visibleContent
+			// for the typing animation effect
+			var rendered string
+			if msg.IsComplete {
+				rendered = renderer.render(msg.VisibleContent, m.width)
+			} else {
+				rendered = renderer.renderPartial(msg.VisibleContent, m.width)
+			}
+			name := aiStyle.Render("McGraph")
+			if msg.Model != "" && msg.Cached {
+				name += " " + branchStyle.Render("("+msg.Model+", cached)")
+			} else if msg.Model != "" {
+				name += " " + branchStyle.Render("("+msg.Model+")")
+			}
+			sb.WriteString(fmt.Sprintf("%s %s:\n%s\n\n", 
 				timestamp, 
-				aiStyle.Render("McGraph"),
-				highlightedContent))
+				name,
+				rendered))
 		}
 		
 		// Add separator between messages, except for the last one
@@ -646,6 +1003,20 @@ func (m *ChatModel) updateViewportContent() {
 	m.viewport.SetContent(sb.String())
 }
 
+// addSystemMessage shows a system message without typing animation
+func (m *ChatModel) addSystemMessage(content string) {
+	m.messages = append(m.messages, Message{
+		Content:        content,
+		VisibleContent: content,
+		IsUser:         false,
+		IsSystem:       true,
+		Time:           time.Now(),
+		IsComplete:     true,
+	})
+	m.updateViewportContent()
+	m.viewport.GotoBottom()
+}
+
 // extCommandResponse represents a response from an extension command
 type extCommandResponse struct {
 	extName  string
@@ -708,12 +1079,21 @@ func (m ChatModel) handleHelp() tea.Cmd {
 			}
 			
 			helpText.WriteString("## Built-in Commands\n\n")
-			helpText.WriteString("- `/summarize` - Generate a summary of the current conversation\n")
-			helpText.WriteString("- `/help` - Show this help message\n")
+			for _, cmd := range builtinCommands {
+				helpText.WriteString(fmt.Sprintf("- `/%s` - %s\n", cmd.name, cmd.description))
+			}
 			
 			// Add keyboard shortcuts
 			helpText.WriteString("\n## Keyboard Shortcuts\n\n")
 			helpText.WriteString("- `Alt+Enter` - Insert a new line in the input field\n")
+			helpText.WriteString("- `Tab` - Complete slash commands and their arguments\n")
+			helpText.WriteString("- `Shift+Up` - Focus past messages, then `j`/`k` to move between them\n")
+			helpText.WriteString("- `y` - Copy the focused message to the clipboard\n")
+			helpText.WriteString("- `1`-`9` - Copy the Nth code block of the focused message\n")
+			helpText.WriteString("- `s` - Save the last copied (or first) code block of the focused message to a file\n")
+			helpText.WriteString("- `Left`/`Right` - Switch between branches of the selected message\n")
+			helpText.WriteString("- `e` - Edit the selected question and send it as a new branch\n")
+			helpText.WriteString("- `r` - Regenerate the answer to the selected message\n")
 			helpText.WriteString("- `Ctrl+C` - Quit the application\n")
 		}
 		
@@ -0,0 +1,261 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+func TestChatAnswersAndSaves(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(80, 24)
+	h.assertView("welcome")
+
+	h.typeText("How do I start a goroutine?")
+	h.press(tea.KeyEnter)
+
+	saved := h.saved()
+	if len(saved) != 2 {
+		t.Fatalf("saved %d messages, want the question and the answer", len(saved))
+	}
+	question, answer := saved[0], saved[1]
+	if question.Role != llm.RoleUser || question.Content != "How do I start a goroutine?" || question.ParentID.Valid {
+		t.Errorf("question = %+v", question)
+	}
+	if answer.Role != llm.RoleAssistant || answer.Content != question.Content || answer.Model != "fake:echo" {
+		t.Errorf("answer = %+v, want the question echoed by fake:echo", answer)
+	}
+	if answer.ParentID != (uuid.NullUUID{UUID: question.ID, Valid: true}) {
+		t.Errorf("answer replies to %v, want the question %s", answer.ParentID, question.ID)
+	}
+
+	if h.model.waitingForResp || h.model.typingActive {
+		t.Error("the chat is still busy after the answer was typed out")
+	}
+	if h.model.textarea.Value() != "" {
+		t.Errorf("input = %q, want it cleared", h.model.textarea.Value())
+	}
+	h.assertView("answered")
+}
+
+// TestEnterWhileBusy checks that Enter doesn't send while an answer is awaited or typed out
+func TestEnterWhileBusy(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(80, 24)
+
+	h.typeText("first")
+	request := h.update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !h.model.waitingForResp {
+		t.Fatal("the chat isn't waiting for the answer")
+	}
+	h.assertView("thinking")
+
+	h.typeText("second")
+	h.press(tea.KeyEnter)
+	if saved := h.saved(); len(saved) != 1 {
+		t.Fatalf("saved %d messages while waiting, want only the first question", len(saved))
+	}
+
+	// The answer arrives and is typed out, one frame at a time
+	typing := h.update(request())
+	if !h.model.typingActive {
+		t.Fatal("the answer isn't being typed out")
+	}
+	h.press(tea.KeyEnter)
+	if saved := h.saved(); len(saved) != 2 {
+		t.Fatalf("saved %d messages while typing, want the first question and its answer", len(saved))
+	}
+	if h.model.textarea.Value() != "second" {
+		t.Errorf("input = %q, want the second question kept", h.model.textarea.Value())
+	}
+
+	h.run(typing)
+	h.press(tea.KeyEnter)
+	saved := h.saved()
+	if len(saved) != 4 || saved[2].Content != "second" || saved[3].ParentID.UUID != saved[2].ID {
+		t.Errorf("saved %+v, want the second question and its answer after the first", saved)
+	}
+}
+
+func TestAltEnterAddsLine(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(80, 24)
+
+	h.typeText("line one")
+	h.send(tea.KeyMsg{Type: tea.KeyEnter, Alt: true})
+	h.typeText("line two")
+	if got := h.model.textarea.Value(); got != "line one\nline two" {
+		t.Errorf("input = %q, want two lines", got)
+	}
+	if saved := h.saved(); len(saved) != 0 {
+		t.Errorf("Alt+Enter sent the message: %+v", saved)
+	}
+}
+
+func TestChatResize(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(80, 24)
+	h.typeText("A question long enough to wrap once the window gets narrower than this line")
+	h.press(tea.KeyEnter)
+
+	h.resize(40, 16)
+	if h.model.viewport.Width != 40 || h.model.viewport.Height != 11 {
+		t.Errorf("viewport = %dx%d, want 40x11", h.model.viewport.Width, h.model.viewport.Height)
+	}
+	h.assertView("narrow")
+}
+
+func TestChatProviderError(t *testing.T) {
+	llm.SetFakeResponses("error: rate limited")
+	defer llm.SetFakeResponses()
+
+	h := newHarness(t, nil, ChatOptions{Backend: llm.Backend{LLM: llm.Fake, Model: llm.FakeScript}})
+	h.resize(80, 24)
+	h.typeText("hello")
+	h.press(tea.KeyEnter)
+
+	if saved := h.saved(); len(saved) != 1 {
+		t.Errorf("saved %d messages, want only the question", len(saved))
+	}
+	if h.model.err == nil || !strings.Contains(h.model.err.Error(), "rate limited") {
+		t.Errorf("err = %v, want the provider error", h.model.err)
+	}
+	h.assertView("error")
+}
+
+func TestChatContinues(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	question := StoredMessage{ID: uuid.New(), Role: llm.RoleUser, Content: "What is a channel?", Time: start}
+	answer := StoredMessage{
+		ID:       uuid.New(),
+		ParentID: uuid.NullUUID{UUID: question.ID, Valid: true},
+		Role:     llm.RoleAssistant,
+		Model:    "fake:echo",
+		Content:  "A pipe between goroutines.",
+		Time:     start.Add(time.Second),
+	}
+	welcome := "Welcome back to McGraph Chat!"
+	h := newHarness(t, []Message{{Content: welcome, VisibleContent: welcome, IsComplete: true, Time: start}}, ChatOptions{
+		Messages: []StoredMessage{question, answer},
+	})
+	h.resize(80, 30)
+
+	h.typeText("And a select?")
+	h.press(tea.KeyEnter)
+
+	saved := h.saved()
+	if len(saved) != 4 {
+		t.Fatalf("saved %d messages, want the loaded turn and a new one", len(saved))
+	}
+	if saved[2].ParentID.UUID != answer.ID {
+		t.Errorf("the new question replies to %v, want the loaded answer %s", saved[2].ParentID, answer.ID)
+	}
+	if len(h.model.history) != 4 {
+		t.Errorf("history has %d turns, want 4", len(h.model.history))
+	}
+	h.assertView("continued")
+}
+
+func TestCtrlCQuits(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+	h.resize(80, 24)
+	h.press(tea.KeyCtrlC)
+	if !h.quit || h.model.View() != "" {
+		t.Error("Ctrl+C didn't quit the chat")
+	}
+}
+
+func TestBranchSwitchDropsSummary(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	message := func(role, content string, parent uuid.UUID) StoredMessage {
+		start = start.Add(time.Second)
+		return StoredMessage{ID: uuid.New(), ParentID: uuid.NullUUID{UUID: parent, Valid: parent != uuid.Nil}, Role: role, Content: content, Time: start}
+	}
+	q1 := message(llm.RoleUser, "q1", uuid.Nil)
+	a1 := message(llm.RoleAssistant, "a1", q1.ID)
+	q2 := message(llm.RoleUser, "q2", a1.ID)
+	a2 := message(llm.RoleAssistant, "a2", q2.ID)
+	// A sibling of a1 on a branch at least as long as the summarized turns
+	b1 := message(llm.RoleAssistant, "b1", q1.ID)
+	q3 := message(llm.RoleUser, "q3", b1.ID)
+	b3 := message(llm.RoleAssistant, "b3", q3.ID)
+
+	tests := []struct {
+		name        string
+		target      uuid.UUID
+		summarized  int
+		wantSummary string
+	}{
+		{name: "split inside the summary", target: b3.ID, summarized: 2, wantSummary: ""},
+		{name: "split after the summary", target: b3.ID, summarized: 1, wantSummary: "q1 was asked"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newHarness(t, nil, ChatOptions{
+				Messages:        []StoredMessage{q1, a1, q2, a2, b1, q3, b3},
+				ActiveMessageID: uuid.NullUUID{UUID: a2.ID, Valid: true},
+				Summary:         "q1 was asked",
+				SummarizedCount: tc.summarized,
+			})
+			h.db.UpdateConversationSummary(context.Background(), h.conversationID, "q1 was asked", tc.summarized)
+
+			h.model.branchFrom(tc.target)
+
+			if h.model.summary != tc.wantSummary {
+				t.Errorf("summary = %q, want %q", h.model.summary, tc.wantSummary)
+			}
+			conversation, _ := h.db.GetConversation(context.Background(), h.conversationID)
+			if conversation.Summary != tc.wantSummary {
+				t.Errorf("saved summary = %q, want %q", conversation.Summary, tc.wantSummary)
+			}
+		})
+	}
+}
+
+func TestChatTitlesConversation(t *testing.T) {
+	tests := []struct {
+		name      string
+		titleSays string
+		wantTitle string
+	}{
+		{name: "model title", titleSays: "Goroutines 101", wantTitle: "Goroutines 101"},
+		{name: "fallback", titleSays: "error: no titles today", wantTitle: "How do I start a goroutine?"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			llm.SetFakeResponses("Use the go keyword.", tc.titleSays)
+			defer llm.SetFakeResponses()
+
+			h := newHarness(t, nil, ChatOptions{Backend: llm.Backend{LLM: llm.Fake, Model: llm.FakeScript}})
+			h.resize(80, 24)
+			h.typeText("How do I start a goroutine?")
+			h.press(tea.KeyEnter)
+
+			conversation, _ := h.db.GetConversation(context.Background(), h.conversationID)
+			if conversation.Title != tc.wantTitle {
+				t.Errorf("title = %q, want %q", conversation.Title, tc.wantTitle)
+			}
+			if h.model.err != nil {
+				t.Errorf("err = %v", h.model.err)
+			}
+		})
+	}
+}
+
+func TestReverseSearchWithSpace(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{PromptHistory: &PromptHistory{entries: []string{"foo bar baz", "foo", "other"}}})
+	h.resize(80, 24)
+
+	h.press(tea.KeyCtrlR)
+	h.typeText("foo bar")
+	h.press(tea.KeyEnter)
+
+	if got := h.model.textarea.Value(); got != "foo bar baz" {
+		t.Errorf("input = %q, want the prompt matching the query with its space", got)
+	}
+}
@@ -0,0 +1,236 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// comparisonColumnGap is the space between the answers shown side by side
+const comparisonColumnGap = 2
+
+// comparisonState holds the answers of several LLMs to the same question
+type comparisonState struct {
+	results  []llm.Comparison
+	question uuid.UUID // Message the answers reply to
+	selected int       // Answer that Enter keeps
+	offset   int       // Lines scrolled down
+}
+
+// comparisonResponse is a message carrying the answers to compare
+type comparisonResponse struct {
+	results         []llm.Comparison
+	question        uuid.UUID
+	err             error
+	summary         string // Running summary after the request
+	summarizedCount int    // Number of history turns covered by summary
+}
+
+// compareArgs returns the argument schema of /compare for completion
+func compareArgs() []extensions.Arg {
+	var names []string
+	for _, llmType := range llm.GetAvailableLLMs() {
+		names = append(names, string(llmType))
+	}
+
+	args := make([]extensions.Arg, len(names))
+	for i := range args {
+		args[i] = extensions.Arg{Name: "llm", Kind: extensions.ArgEnum, Choices: names, Optional: true}
+	}
+	return args
+}
+
+// startComparison handles /compare by asking the given LLMs, or every LLM
+// with an API key, the last question on the active branch again
+func (m *ChatModel) startComparison(args []string) tea.Cmd {
+	llmTypes := llm.ConfiguredLLMs()
+	if len(args) > 0 {
+		parsed, err := llm.ParseLLMList(args)
+		if err != nil {
+			m.addSystemMessage(fmt.Sprintf("Error: %v", err))
+			return nil
+		}
+		llmTypes = parsed
+	}
+	if len(llmTypes) == 0 {
+		m.addSystemMessage("No LLMs to compare. Set the API keys of the LLMs you want to compare, or name them: /compare openai claude")
+		return nil
+	}
+
+	// Find the last question, the conversation up to it is sent to every LLM
+	path := m.tree.path()
+	last := -1
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Role == llm.RoleUser {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		m.addSystemMessage("Ask a question first, then type /compare to see how other LLMs answer it.")
+		return nil
+	}
+
+	question := path[last].ID
+	history := append([]llm.Message(nil), m.history[:last+1]...)
+	summary := m.summary
+	summarizedCount := m.summarizedCount
+	if summarizedCount > len(history) {
+		summary, summarizedCount = "", 0
+	}
+	// The question is asked again for other answers, not the cached ones
+	profile := m.activeProfile().WithoutCache()
+
+	// Leave room for the LLM with the smallest context window
+	smallest := llm.Backend{LLM: llmTypes[0]}
+	for _, llmType := range llmTypes[1:] {
+		if llm.ContextLimit(llm.DefaultModel(llmType)) < llm.ContextLimit(smallest.ModelName()) {
+			smallest = llm.Backend{LLM: llmType}
+		}
+	}
+
+	m.waitingForResp = true
+	return func() tea.Msg {
+		window, summary, summarizedCount, err := fitContext(smallest, history, summary, summarizedCount, profile)
+		if err != nil {
+			return comparisonResponse{err: err}
+		}
+
+		return comparisonResponse{
+			results:         llm.Compare(llmTypes, window, profile.WithSystemContext(llm.SummaryContext(summary))),
+			question:        question,
+			summary:         summary,
+			summarizedCount: summarizedCount,
+		}
+	}
+}
+
+// handleComparisonResponse shows the answers side by side
+func (m *ChatModel) handleComparisonResponse(msg comparisonResponse) {
+	if msg.err != nil {
+		m.err = msg.err
+		m.addSystemMessage(fmt.Sprintf("Error: %v", msg.err))
+		return
+	}
+
+	if msg.summarizedCount > m.summarizedCount {
+		m.applySummary(msg.summary, msg.summarizedCount)
+	}
+
+	m.comparison = &comparisonState{results: msg.results, question: msg.question}
+}
+
+// handleComparisonKey handles keys while answers are compared.
+// It reports whether the key was consumed.
+func (m *ChatModel) handleComparisonKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	c := m.comparison
+	switch msg.String() {
+	case "left", "shift+tab":
+		if c.selected > 0 {
+			c.selected--
+		}
+	case "right", "tab":
+		if c.selected < len(c.results)-1 {
+			c.selected++
+		}
+	case "up":
+		if c.offset > 0 {
+			c.offset--
+		}
+	case "down":
+		c.offset++
+	case "pgup":
+		c.offset -= m.viewport.Height
+		if c.offset < 0 {
+			c.offset = 0
+		}
+	case "pgdown":
+		c.offset += m.viewport.Height
+	case "enter":
+		m.keepComparison()
+	case "esc":
+		m.comparison = nil
+		m.addSystemMessage("Discarded the compared answers.")
+	case "ctrl+c":
+		return false, nil
+	}
+	return true, nil
+}
+
+// keepComparison adds the selected answer to the conversation as a new
+// branch replying to the compared question
+func (m *ChatModel) keepComparison() {
+	result := m.comparison.results[m.comparison.selected]
+	if result.Err != nil {
+		return
+	}
+
+	m.branchFrom(m.comparison.question)
+	m.comparison = nil
+
+	saved := m.saveAnswer(llm.Backend{LLM: result.LLM, Model: result.Response.Model}, result.Response)
+	m.messages = append(m.messages, Message{
+		ID:             saved.ID,
+		Model:          saved.Model,
+		Cached:         saved.Cached,
+		Content:        saved.Content,
+		VisibleContent: saved.Content,
+		IsUser:         false,
+		Time:           saved.Time,
+		IsComplete:     true,
+	})
+	m.history = append(m.history, llm.Message{Role: llm.RoleAssistant, Content: saved.Content})
+	m.lastUsage = result.Response.Usage
+	m.lastModel = result.Response.Model
+
+	m.addSystemMessage(fmt.Sprintf("Kept the answer from %s.", result.LLM))
+}
+
+// renderComparison renders the compared answers in columns the size of the viewport
+func (m ChatModel) renderComparison() string {
+	c := m.comparison
+	height := m.viewport.Height
+	width := (m.width - comparisonColumnGap*(len(c.results)-1)) / len(c.results)
+	if width < 10 {
+		width = 10
+	}
+
+	columns := make([]string, len(c.results))
+	for i, result := range c.results {
+		header := result.Header()
+		if i == c.selected {
+			header = selectedStyle.Render(header)
+		} else {
+			header = aiStyle.Render(header)
+		}
+
+		body := renderer.render(result.Response.Content, width)
+		if result.Err != nil {
+			body = lipgloss.NewStyle().Width(width).Render(fmt.Sprintf("Error: %v", result.Err))
+		}
+		lines := strings.Split(body, "\n")
+
+		// Scroll every answer together, keeping the header in place
+		offset := c.offset
+		if offset > len(lines) {
+			offset = len(lines)
+		}
+		lines = lines[offset:]
+		if len(lines) > height-2 {
+			lines = lines[:height-2]
+		}
+
+		column := lipgloss.NewStyle().Width(width).MaxWidth(width).Render(header) + "\n\n" + strings.Join(lines, "\n")
+		if i < len(c.results)-1 {
+			column = lipgloss.NewStyle().Width(width + comparisonColumnGap).Render(column)
+		}
+		columns[i] = column
+	}
+
+	return lipgloss.NewStyle().Height(height).MaxHeight(height).Render(lipgloss.JoinHorizontal(lipgloss.Top, columns...))
+}
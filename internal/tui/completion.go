@@ -0,0 +1,392 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/hawk/mcgraph/internal/extensions"
+)
+
+// maxVisibleCompletions is the number of completions shown in the popup at once
+const maxVisibleCompletions = 8
+
+// maxPathCompletions caps the number of filesystem entries offered
+const maxPathCompletions = 200
+
+// builtinCommand describes a slash command that is handled by the chat itself
+type builtinCommand struct {
+	name        string
+	description string
+	args        func() []extensions.Arg // Optional argument schema for completion
+}
+
+// builtinCommands lists the built-in slash commands in the order they are offered
+var builtinCommands = []builtinCommand{
+	{name: "summarize", description: "Generate a summary of the current conversation"},
+	{name: "help", description: "Show this help message"},
+	{name: "context", description: "Show the context window, summary and token usage"},
+	{name: "compare", description: "Ask several LLMs the last question again and compare their answers side by side", args: compareArgs},
+	{name: "model", description: "Show or switch the provider and model for the rest of the session", args: modelArgs},
+	{name: "profile", description: "Show or switch the system prompt profile", args: profileArgs},
+	{name: "project", description: "Show the project context, or add the file tree or diff to it", args: projectArgs},
+	{name: "attach", description: "Attach files or images to the next message, list or clear them", args: attachArgs},
+	{name: "theme", description: "Show or switch the color theme and code style, Tab previews them", args: themeArgs},
+}
+
+// findBuiltinCommand returns the built-in command with the given name
+func findBuiltinCommand(name string) (builtinCommand, bool) {
+	for _, cmd := range builtinCommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return builtinCommand{}, false
+}
+
+// completion is a single candidate offered in the completion popup
+type completion struct {
+	value       string // Replaces the token under the cursor
+	description string
+}
+
+// completionState holds the state of the completion popup
+type completionState struct {
+	items    []completion
+	selected int
+	visible  bool
+}
+
+// Completion popup styles, set by ApplyTheme
+var (
+	completionBoxStyle      lipgloss.Style
+	completionItemStyle     lipgloss.Style
+	completionSelectedStyle lipgloss.Style
+	completionDescStyle     lipgloss.Style
+)
+
+// completeInput returns the completion candidates for the token at the end of input.
+// Only single-line input starting with '/' is completed.
+func completeInput(input string) []completion {
+	if !strings.HasPrefix(input, "/") || strings.Contains(input, "\n") {
+		return nil
+	}
+
+	tokens := strings.Fields(input)
+	if strings.HasSuffix(input, " ") {
+		tokens = append(tokens, "")
+	}
+	current := tokens[len(tokens)-1]
+
+	// First token: the command or extension name
+	if len(tokens) == 1 {
+		return completeCommandName(strings.TrimPrefix(current, "/"))
+	}
+
+	name := strings.TrimPrefix(tokens[0], "/")
+
+	// Built-in commands take their arguments directly
+	if builtin, ok := findBuiltinCommand(name); ok {
+		if builtin.args == nil {
+			return nil
+		}
+		return completeArg(builtin.args(), len(tokens)-2, current)
+	}
+
+	if extManager == nil || !extManager.IsEnabled() {
+		return nil
+	}
+	if _, ok := extManager.GetExtension(name); !ok {
+		return nil
+	}
+
+	// Second token: the extension command
+	if len(tokens) == 2 {
+		commands := extManager.GetCommands(name)
+		names := make([]string, 0, len(commands))
+		for cmdName := range commands {
+			names = append(names, cmdName)
+		}
+		sort.Strings(names)
+
+		var items []completion
+		for _, cmdName := range names {
+			if strings.HasPrefix(cmdName, current) {
+				items = append(items, completion{value: cmdName, description: commands[cmdName].Description()})
+			}
+		}
+		return items
+	}
+
+	// Remaining tokens: the command's arguments
+	return completeArg(extManager.GetArgs(name, tokens[1]), len(tokens)-3, current)
+}
+
+// completeCommandName completes built-in commands followed by extension names
+func completeCommandName(prefix string) []completion {
+	var items []completion
+	for _, cmd := range builtinCommands {
+		if strings.HasPrefix(cmd.name, prefix) {
+			items = append(items, completion{value: "/" + cmd.name, description: cmd.description})
+		}
+	}
+
+	if extManager == nil || !extManager.IsEnabled() {
+		return items
+	}
+
+	exts := extManager.ListExtensions()
+	sort.Slice(exts, func(i, j int) bool { return exts[i].Name() < exts[j].Name() })
+	for _, ext := range exts {
+		if strings.HasPrefix(ext.Name(), prefix) {
+			items = append(items, completion{value: "/" + ext.Name(), description: ext.Description()})
+		}
+	}
+	return items
+}
+
+// completeArg completes the argument at index using the given schema
+func completeArg(schema []extensions.Arg, index int, prefix string) []completion {
+	if index < 0 || index >= len(schema) {
+		return nil
+	}
+
+	arg := schema[index]
+	switch arg.Kind {
+	case extensions.ArgEnum:
+		var items []completion
+		for _, choice := range arg.Choices {
+			if strings.HasPrefix(choice, prefix) {
+				items = append(items, completion{value: choice, description: arg.Name})
+			}
+		}
+		return items
+	case extensions.ArgPath:
+		return completePath(prefix, false)
+	case extensions.ArgDir:
+		return completePath(prefix, true)
+	default:
+		return nil
+	}
+}
+
+// completePath completes a filesystem path, optionally offering directories only
+func completePath(prefix string, dirsOnly bool) []completion {
+	dir, base := filepath.Split(prefix)
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if strings.HasPrefix(readDir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, readDir[2:])
+		}
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var items []completion
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		// Hide dotfiles unless explicitly asked for
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if dirsOnly && !isDir {
+			continue
+		}
+
+		if isDir {
+			items = append(items, completion{value: dir + name + "/", description: "directory"})
+		} else {
+			items = append(items, completion{value: dir + name, description: "file"})
+		}
+
+		if len(items) >= maxPathCompletions {
+			break
+		}
+	}
+	return items
+}
+
+// commonPrefix returns the longest prefix shared by all completion values
+func commonPrefix(items []completion) string {
+	if len(items) == 0 {
+		return ""
+	}
+
+	prefix := items[0].value
+	for _, item := range items[1:] {
+		for !strings.HasPrefix(item.value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// replaceLastToken replaces the last space-separated token of input
+func replaceLastToken(input, value string) string {
+	idx := strings.LastIndex(input, " ") + 1
+	return input[:idx] + value
+}
+
+// handleCompletionKey handles keys that drive the completion popup.
+// It reports whether the key was consumed.
+func (m *ChatModel) handleCompletionKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyTab:
+		if m.completion.visible {
+			m.moveCompletion(1)
+			return true, nil
+		}
+
+		items := completeInput(m.textarea.Value())
+		if len(items) == 0 {
+			return true, nil
+		}
+		if len(items) == 1 {
+			m.applyCompletion(items[0])
+			return true, nil
+		}
+
+		// Extend the input as far as all candidates agree, like a shell would
+		if prefix := commonPrefix(items); prefix != "" {
+			m.textarea.SetValue(replaceLastToken(m.textarea.Value(), prefix))
+		}
+		m.completion = completionState{items: items, visible: true}
+		m.resizeViewport()
+		return true, nil
+
+	case tea.KeyShiftTab, tea.KeyUp:
+		if m.completion.visible {
+			m.moveCompletion(-1)
+			return true, nil
+		}
+
+	case tea.KeyDown:
+		if m.completion.visible {
+			m.moveCompletion(1)
+			return true, nil
+		}
+
+	case tea.KeyEnter:
+		if m.completion.visible && !msg.Alt {
+			m.applyCompletion(m.completion.items[m.completion.selected])
+			return true, nil
+		}
+
+	case tea.KeyEsc:
+		if m.completion.visible {
+			m.closeCompletion()
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// moveCompletion moves the popup selection by delta, wrapping around
+func (m *ChatModel) moveCompletion(delta int) {
+	n := len(m.completion.items)
+	m.completion.selected = ((m.completion.selected+delta)%n + n) % n
+}
+
+// applyCompletion writes the chosen completion into the textarea
+func (m *ChatModel) applyCompletion(item completion) {
+	value := replaceLastToken(m.textarea.Value(), item.value)
+	// Directories stay open so the next Tab descends into them
+	if !strings.HasSuffix(item.value, "/") {
+		value += " "
+	}
+	m.textarea.SetValue(value)
+	m.closeCompletion()
+}
+
+// closeCompletion hides the completion popup
+func (m *ChatModel) closeCompletion() {
+	if !m.completion.visible {
+		return
+	}
+	m.completion = completionState{}
+	m.resizeViewport()
+}
+
+// refreshCompletions recomputes the popup after the input changed
+func (m *ChatModel) refreshCompletions() {
+	items := completeInput(m.textarea.Value())
+	if len(items) == 0 {
+		m.closeCompletion()
+		return
+	}
+
+	selected := m.completion.selected
+	if selected >= len(items) {
+		selected = 0
+	}
+	m.completion = completionState{items: items, selected: selected, visible: true}
+	m.resizeViewport()
+}
+
+// completionHeight returns the number of lines taken by the popup
+func (m ChatModel) completionHeight() int {
+	if !m.completion.visible {
+		return 0
+	}
+	n := len(m.completion.items)
+	if n > maxVisibleCompletions {
+		n = maxVisibleCompletions
+	}
+	return n + 2 // Border
+}
+
+// renderCompletions renders the completion popup
+func (m ChatModel) renderCompletions() string {
+	items := m.completion.items
+
+	// Scroll the window so the selection stays visible
+	start := 0
+	if m.completion.selected >= maxVisibleCompletions {
+		start = m.completion.selected - maxVisibleCompletions + 1
+	}
+	end := start + maxVisibleCompletions
+	if end > len(items) {
+		end = len(items)
+	}
+
+	width := 0
+	for _, item := range items[start:end] {
+		if len(item.value) > width {
+			width = len(item.value)
+		}
+	}
+
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		label := fmt.Sprintf(" %-*s ", width, items[i].value)
+		if i == m.completion.selected {
+			label = completionSelectedStyle.Render(label)
+		} else {
+			label = completionItemStyle.Render(label)
+		}
+		lines = append(lines, label+" "+completionDescStyle.Render(items[i].description))
+	}
+
+	return completionBoxStyle.Render(strings.Join(lines, "\n"))
+}
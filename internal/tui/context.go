@@ -0,0 +1,92 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// fitContext returns the turns of history to send to backend along with the
+// running summary, folding the oldest turns into the summary first if they
+// don't fit the context window
+func fitContext(backend llm.Backend, history []llm.Message, summary string, summarizedCount int, profile llm.Profile) ([]llm.Message, string, int, error) {
+	window := history[summarizedCount:]
+	budget := llm.ContextBudget(backend.ModelName(), profile.WithSystemContext(llm.SummaryContext(summary)))
+	if n := llm.FoldPoint(window, budget); n > 0 {
+		newSummary, err := llm.SummarizeTurns(backend, summary, window[:n])
+		if err != nil {
+			return nil, "", 0, err
+		}
+		return window[n:], newSummary, summarizedCount + n, nil
+	}
+	return window, summary, summarizedCount, nil
+}
+
+// applySummary records a new running summary and stores it with the conversation
+func (m *ChatModel) applySummary(summary string, summarizedCount int) {
+	folded := summarizedCount - m.summarizedCount
+	m.summary = summary
+	m.summarizedCount = summarizedCount
+
+	if m.db != nil {
+		err := m.db.UpdateConversationSummary(context.Background(), m.conversationID, summary, summarizedCount)
+		if err != nil {
+			m.err = fmt.Errorf("failed to save summary: %w", err)
+		}
+	}
+
+	m.addSystemMessage(fmt.Sprintf("Folded %d older messages into the conversation summary to fit the context window. Type /context to see it.", folded))
+}
+
+// showContext handles /context by describing what is sent to the model
+func (m *ChatModel) showContext() {
+	model := m.backend.ModelName()
+	limit := llm.ContextLimit(model)
+	profile := m.activeProfile().WithSystemContext(llm.SummaryContext(m.summary))
+	window := m.history[m.summarizedCount:]
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Model: %s (context window: %d tokens)\n", m.backend.Resolved(), limit))
+	sb.WriteString(fmt.Sprintf("Profile: %s (up to %d tokens per answer)\n", m.profile.Name, m.profile.MaxTokens))
+	sb.WriteString(fmt.Sprintf("System prompt: ~%d tokens\n", llm.EstimateTokens(profile.SystemPrompt)))
+	sb.WriteString(fmt.Sprintf("Messages sent verbatim: %d (~%d tokens)\n", len(window), llm.EstimateMessagesTokens(window)))
+	sb.WriteString(fmt.Sprintf("Messages folded into the summary: %d\n", m.summarizedCount))
+	sb.WriteString(fmt.Sprintf("Budget for history: ~%d tokens\n", llm.ContextBudget(model, profile)))
+
+	if m.lastUsage.TotalTokens() > 0 {
+		sb.WriteString(fmt.Sprintf("Last request: %d prompt + %d completion tokens (%d%% of the context window)\n",
+			m.lastUsage.PromptTokens, m.lastUsage.CompletionTokens, m.lastUsage.TotalTokens()*100/limit))
+	}
+
+	if m.summary != "" {
+		sb.WriteString("\nSummary:\n")
+		sb.WriteString(m.summary)
+	} else {
+		sb.WriteString("\nNo summary yet: the whole conversation fits in the context window.")
+	}
+
+	m.addSystemMessage(sb.String())
+}
+
+// sessionStatus returns the active model and the token usage of the last request for the status line
+func (m ChatModel) sessionStatus() string {
+	status := m.backend.Resolved().String()
+	if m.lastUsage.TotalTokens() > 0 {
+		status += fmt.Sprintf(" | Tokens: %s/%s", formatTokens(m.lastUsage.TotalTokens()), formatTokens(llm.ContextLimit(m.lastModel)))
+	}
+	return "[" + status + "]"
+}
+
+// formatTokens formats a token count compactly, e.g. 1.2k
+func formatTokens(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
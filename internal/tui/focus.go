@@ -0,0 +1,213 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hawk/mcgraph/internal/clipboard"
+)
+
+// codeBlock is a fenced code block in a message
+type codeBlock struct {
+	lang string
+	code string
+}
+
+// codeBlockExtensions maps code block languages to file extensions for saving
+var codeBlockExtensions = map[string]string{
+	"go":         ".go",
+	"python":     ".py",
+	"py":         ".py",
+	"javascript": ".js",
+	"js":         ".js",
+	"typescript": ".ts",
+	"ts":         ".ts",
+	"rust":       ".rs",
+	"java":       ".java",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"ruby":       ".rb",
+	"sh":         ".sh",
+	"bash":       ".sh",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"json":       ".json",
+	"yaml":       ".yaml",
+	"yml":        ".yaml",
+	"toml":       ".toml",
+	"html":       ".html",
+	"css":        ".css",
+	"markdown":   ".md",
+	"md":         ".md",
+	"dockerfile": ".dockerfile",
+}
+
+// saveBlockState holds a code block waiting for the path to save it to
+type saveBlockState struct {
+	block codeBlock
+	index int // 1-based number of the block in its message
+}
+
+// handleSelectionKey handles keys while a message is focused.
+// It reports whether the key was consumed.
+func (m *ChatModel) handleSelectionKey(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch key := msg.String(); key {
+	case "up", "k":
+		m.selectMessage(-1)
+	case "down", "j":
+		m.selectMessage(1)
+	case "left":
+		m.switchBranch(-1)
+	case "right":
+		m.switchBranch(1)
+	case "enter", "e":
+		m.editSelected()
+	case "r":
+		return true, m.regenerateSelected()
+	case "y":
+		m.copyText(m.messages[m.selected].Content, "Message")
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		m.copyCodeBlock(int(key[0] - '0'))
+	case "s":
+		m.promptSaveCodeBlock()
+	case "esc":
+		m.clearSelection()
+	case "ctrl+c":
+		return false, nil
+	default:
+		// Any other key goes back to typing
+		m.clearSelection()
+		return false, nil
+	}
+	return true, nil
+}
+
+// focusedCodeBlock returns the nth code block of the focused message
+func (m *ChatModel) focusedCodeBlock(n int) (codeBlock, bool) {
+	blocks := extractCodeBlocks(m.messages[m.selected].Content)
+	if len(blocks) == 0 {
+		m.notice = "This message has no code blocks"
+		return codeBlock{}, false
+	}
+	if n > len(blocks) {
+		m.notice = fmt.Sprintf("This message has only %d code block(s)", len(blocks))
+		return codeBlock{}, false
+	}
+	return blocks[n-1], true
+}
+
+// copyCodeBlock copies the nth code block of the focused message and
+// remembers it as the block to save
+func (m *ChatModel) copyCodeBlock(n int) {
+	block, ok := m.focusedCodeBlock(n)
+	if !ok {
+		return
+	}
+	m.focusedBlock = n
+	m.copyText(block.code, fmt.Sprintf("Code block %d", n))
+}
+
+// copyText copies text to the clipboard and reports how in the status line
+func (m *ChatModel) copyText(text, what string) {
+	method, err := clipboard.Copy(text)
+	if err != nil {
+		m.notice = fmt.Sprintf("Copy failed: %v", err)
+		return
+	}
+	m.notice = fmt.Sprintf("%s copied to the %s", what, method)
+}
+
+// promptSaveCodeBlock asks for the path to save the last copied code block of
+// the focused message to, or its first code block
+func (m *ChatModel) promptSaveCodeBlock() {
+	n := m.focusedBlock
+	if n == 0 {
+		n = 1
+	}
+	block, ok := m.focusedCodeBlock(n)
+	if !ok {
+		return
+	}
+
+	m.saving = &saveBlockState{block: block, index: n}
+	m.clearSelection()
+
+	// Suggest a file name from the block's language
+	ext, ok := codeBlockExtensions[block.lang]
+	if !ok {
+		ext = ".txt"
+	}
+	m.textarea.SetValue("snippet" + ext)
+}
+
+// handleSaveKey handles the keys that finish the save path prompt.
+// It reports whether the key was consumed.
+func (m *ChatModel) handleSaveKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.saving = nil
+		m.textarea.Reset()
+		m.notice = "Save cancelled"
+		return true
+	case tea.KeyEnter:
+		if msg.Alt {
+			return false
+		}
+		path := strings.TrimSpace(m.textarea.Value())
+		if path == "" {
+			return true
+		}
+
+		written, err := saveCodeBlock(path, m.saving.block.code)
+		if err != nil {
+			m.notice = fmt.Sprintf("Save failed: %v", err)
+			return true
+		}
+		m.notice = fmt.Sprintf("Code block %d saved to %s", m.saving.index, written)
+		m.saving = nil
+		m.textarea.Reset()
+		return true
+	}
+	return false
+}
+
+// saveCodeBlock writes code to a new file at path, creating its directory.
+// It refuses to overwrite existing files and returns the absolute path.
+func saveCodeBlock(path, code string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("%s already exists", path)
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+	if _, err := file.WriteString(code); err != nil {
+		return "", err
+	}
+	return path, nil
+}
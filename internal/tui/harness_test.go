@@ -0,0 +1,350 @@
+package tui
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/db"
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/secrets"
+)
+
+// update rewrites the golden files with the views rendered by the tests
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fakeDB is a DBInterface in memory that records every message saved
+type fakeDB struct {
+	mu            sync.Mutex
+	conversations map[uuid.UUID]db.Conversation
+	messages      []db.Message
+	attachments   map[uuid.UUID][]db.Attachment
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		conversations: make(map[uuid.UUID]db.Conversation),
+		attachments:   make(map[uuid.UUID][]db.Attachment),
+	}
+}
+
+// saved returns the messages saved to conversationID, oldest first
+func (f *fakeDB) saved(conversationID uuid.UUID) []db.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var messages []db.Message
+	for _, msg := range f.messages {
+		if msg.ConversationID == conversationID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func (f *fakeDB) AddMessage(ctx context.Context, conversationID uuid.UUID, parentID uuid.NullUUID, role, model, content string) (uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := db.Message{
+		ID:             uuid.New(),
+		ConversationID: conversationID,
+		ParentID:       parentID,
+		Role:           role,
+		Model:          model,
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+	f.messages = append(f.messages, msg)
+	return msg.ID, nil
+}
+
+// update changes the conversation with id, failing if there is none
+func (f *fakeDB) update(id uuid.UUID, change func(*db.Conversation)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conversation, ok := f.conversations[id]
+	if !ok {
+		return fmt.Errorf("conversation %s not found", id)
+	}
+	change(&conversation)
+	f.conversations[id] = conversation
+	return nil
+}
+
+func (f *fakeDB) UpdateConversationModel(ctx context.Context, conversationID uuid.UUID, model string) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.Model = model })
+}
+
+func (f *fakeDB) SetActiveMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.ActiveMessageID = uuid.NullUUID{UUID: messageID, Valid: true} })
+}
+
+func (f *fakeDB) GenerateTitle(ctx context.Context, conversationID uuid.UUID) (string, error) {
+	title := "New Conversation"
+	for _, msg := range f.saved(conversationID) {
+		if msg.Role == llm.RoleUser {
+			title = msg.Content
+			break
+		}
+	}
+	return title, f.update(conversationID, func(c *db.Conversation) { c.Title = title })
+}
+
+func (f *fakeDB) UpdateConversationProfile(ctx context.Context, conversationID uuid.UUID, profile string) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.Profile = profile })
+}
+
+func (f *fakeDB) UpdateConversationSummary(ctx context.Context, conversationID uuid.UUID, summary string, messageCount int) error {
+	return f.update(conversationID, func(c *db.Conversation) {
+		c.Summary = summary
+		c.SummaryMessageCount = messageCount
+	})
+}
+
+func (f *fakeDB) CreateConversation(ctx context.Context, title, model, profile, repoPath string) (db.Conversation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conversation := db.Conversation{
+		ID:        uuid.New(),
+		Title:     title,
+		Model:     model,
+		Profile:   profile,
+		RepoPath:  repoPath,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	f.conversations[conversation.ID] = conversation
+	return conversation, nil
+}
+
+func (f *fakeDB) GetConversation(ctx context.Context, conversationID uuid.UUID) (db.Conversation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conversation, ok := f.conversations[conversationID]
+	if !ok {
+		return db.Conversation{}, fmt.Errorf("conversation %s not found", conversationID)
+	}
+	return conversation, nil
+}
+
+func (f *fakeDB) GetMessages(ctx context.Context, conversationID uuid.UUID) ([]db.Message, error) {
+	return f.saved(conversationID), nil
+}
+
+func (f *fakeDB) UpdateConversationTitle(ctx context.Context, conversationID uuid.UUID, title string) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.Title = title })
+}
+
+func (f *fakeDB) DeleteConversation(ctx context.Context, conversationID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conversations, conversationID)
+	return nil
+}
+
+func (f *fakeDB) AddAttachments(ctx context.Context, messageID uuid.UUID, attachments []db.Attachment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attachments[messageID] = append(f.attachments[messageID], attachments...)
+	return nil
+}
+
+func (f *fakeDB) FindConversations(ctx context.Context, filter db.ConversationFilter) ([]db.Conversation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var conversations []db.Conversation
+	for _, conversation := range f.conversations {
+		if conversation.Archived == filter.Archived || filter.AnyArchived {
+			conversations = append(conversations, conversation)
+		}
+	}
+	return conversations, nil
+}
+
+func (f *fakeDB) UpdateConversationTags(ctx context.Context, conversationID uuid.UUID, add, remove []string) ([]string, error) {
+	var tags []string
+	err := f.update(conversationID, func(c *db.Conversation) {
+		for _, tag := range c.Tags {
+			if !slices.Contains(remove, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		for _, tag := range add {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		c.Tags = tags
+	})
+	return tags, err
+}
+
+func (f *fakeDB) SetConversationPinned(ctx context.Context, conversationID uuid.UUID, pinned bool) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.Pinned = pinned })
+}
+
+func (f *fakeDB) SetConversationArchived(ctx context.Context, conversationID uuid.UUID, archived bool) error {
+	return f.update(conversationID, func(c *db.Conversation) { c.Archived = archived })
+}
+
+func (f *fakeDB) MarkMessageCached(ctx context.Context, messageID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.messages {
+		if f.messages[i].ID == messageID {
+			f.messages[i].Cached = true
+			return nil
+		}
+	}
+	return fmt.Errorf("message %s not found", messageID)
+}
+
+// harness drives a ChatModel headlessly in tests, failing them when the chat doesn't settle
+type harness struct {
+	*headlessChat
+	t              *testing.T
+	db             *fakeDB
+	conversationID uuid.UUID
+}
+
+// newHarness starts a chat in a new conversation answered by the fake echo provider
+// unless opts says otherwise. loaded are the messages shown before the conversation.
+func newHarness(t *testing.T, loaded []Message, opts ChatOptions) *harness {
+	t.Helper()
+
+	// Animations and delayed saves run at once instead of after a delay
+	tick = immediateTick
+	t.Cleanup(func() { tick = tea.Tick })
+
+	// Keep the environment of the machine running the tests out of the chat
+	t.Setenv(llm.TitleModelEnvVar, "")
+	t.Setenv(secrets.PolicyEnvVar, "")
+	t.Setenv(llm.FakeResponsesEnvVar, "")
+
+	if opts.Backend.LLM == "" {
+		opts.Backend = llm.Backend{LLM: llm.Fake}
+	}
+	if opts.Themes.Theme == "" {
+		opts.Themes.Theme = "dark"
+	}
+
+	fake := newFakeDB()
+	conversation, err := fake.CreateConversation(context.Background(), "New Conversation", opts.Backend.String(), "default", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range opts.Messages {
+		fake.messages = append(fake.messages, db.Message{
+			ID:             msg.ID,
+			ConversationID: conversation.ID,
+			ParentID:       msg.ParentID,
+			Role:           msg.Role,
+			Model:          msg.Model,
+			Content:        msg.Content,
+			CreatedAt:      msg.Time,
+		})
+	}
+
+	model := NewChatModel(fake, conversation.ID, loaded, opts)
+	return &harness{headlessChat: newHeadlessChat(model), t: t, db: fake, conversationID: conversation.ID}
+}
+
+// send hands msg to the model and runs the commands that follow until the chat settles
+func (h *harness) send(msg tea.Msg) {
+	h.t.Helper()
+	if err := h.headlessChat.send(msg); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// run runs cmd and every command that follows from the messages it produces
+func (h *harness) run(cmd tea.Cmd) {
+	h.t.Helper()
+	if err := h.headlessChat.run(cmd); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// resize sets the terminal size
+func (h *harness) resize(width, height int) {
+	h.t.Helper()
+	h.send(tea.WindowSizeMsg{Width: width, Height: height})
+}
+
+// typeText types text into the input
+func (h *harness) typeText(text string) {
+	h.t.Helper()
+	// Keys arrive one at a time, with spaces as the terminal sends them
+	for _, r := range text {
+		key := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}
+		if r == ' ' {
+			key.Type = tea.KeySpace
+		}
+		h.send(key)
+	}
+}
+
+// press presses a key, like tea.KeyEnter
+func (h *harness) press(key tea.KeyType) {
+	h.t.Helper()
+	h.send(tea.KeyMsg{Type: key})
+}
+
+// saved returns the messages persisted in the conversation
+func (h *harness) saved() []db.Message {
+	return h.db.saved(h.conversationID)
+}
+
+var (
+	escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	clockTime      = regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}\b`)
+)
+
+// normalizeView strips colors, clock times and trailing spaces, which differ between runs and terminals
+func normalizeView(view string) string {
+	view = escapeSequence.ReplaceAllString(view, "")
+	view = clockTime.ReplaceAllString(view, "hh:mm:ss")
+	lines := strings.Split(view, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// assertView compares the rendered chat with testdata/<name>.golden
+func (h *harness) assertView(name string) {
+	h.t.Helper()
+	assertGolden(h.t, name, normalizeView(h.model.View()))
+}
+
+// assertGolden compares got with testdata/<name>.golden.
+// Run go test with -update to rewrite it.
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output doesn't match %s (run go test with -update to accept it)\n--- got ---\n%s--- want ---\n%s", path, got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// maxRenderedMessages bounds the cache of rendered messages
+const maxRenderedMessages = 256
+
+// markdownRenderer renders messages as Markdown wrapped to the chat width.
+// Rendered output is cached since the whole chat is redrawn on every change.
+type markdownRenderer struct {
+	style     ansi.StyleConfig
+	renderers map[int]*glamour.TermRenderer
+	cache     map[string]string
+}
+
+// renderer is shared by the chat view and the comparison columns
+var renderer = &markdownRenderer{
+	renderers: make(map[int]*glamour.TermRenderer),
+	cache:     make(map[string]string),
+}
+
+// markdownStyle returns the Markdown style of theme with code highlighted by its chroma style
+func markdownStyle(theme Theme) ansi.StyleConfig {
+	style := styles.DarkStyleConfig
+	if theme.Markdown == "light" {
+		style = styles.LightStyleConfig
+	}
+	style.CodeBlock.Chroma = nil
+	style.CodeBlock.Theme = theme.CodeStyle
+	return style
+}
+
+// setTheme switches to the style of theme, dropping everything rendered so far
+func (r *markdownRenderer) setTheme(theme Theme) {
+	r.style = markdownStyle(theme)
+	r.renderers = make(map[int]*glamour.TermRenderer)
+	r.cache = make(map[string]string)
+}
+
+// render renders complete Markdown content to fit width
+func (r *markdownRenderer) render(content string, width int) string {
+	key := fmt.Sprintf("%d\x00%s", width, content)
+	if out, ok := r.cache[key]; ok {
+		return out
+	}
+
+	out := r.renderUncached(content, width)
+	if len(r.cache) >= maxRenderedMessages {
+		r.cache = make(map[string]string)
+	}
+	r.cache[key] = out
+	return out
+}
+
+// renderPartial renders content that is still being typed. Finished blocks are
+// rendered once and cached; only the block being typed is rendered again, with
+// any open code fence closed so it doesn't flicker between text and code.
+func (r *markdownRenderer) renderPartial(content string, width int) string {
+	done, typing := splitFinishedBlocks(content)
+	if typing == "" {
+		return r.render(done, width)
+	}
+
+	tail := r.renderUncached(closeOpenFence(typing), width)
+	if done == "" {
+		return tail
+	}
+	return r.render(done, width) + "\n\n" + tail
+}
+
+// renderUncached renders content, falling back to the raw text on errors
+func (r *markdownRenderer) renderUncached(content string, width int) string {
+	tr, err := r.termRenderer(width)
+	if err != nil {
+		return content
+	}
+	out, err := tr.Render(content)
+	if err != nil {
+		return content
+	}
+	return strings.Trim(out, "\n")
+}
+
+// termRenderer returns the renderer wrapping at width, creating it on first use
+func (r *markdownRenderer) termRenderer(width int) (*glamour.TermRenderer, error) {
+	if tr, ok := r.renderers[width]; ok {
+		return tr, nil
+	}
+	tr, err := glamour.NewTermRenderer(
+		glamour.WithStyles(r.style),
+		glamour.WithWordWrap(width),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Markdown renderer: %w", err)
+	}
+	r.renderers[width] = tr
+	return tr, nil
+}
+
+// codeFence describes the fence that opened a code block
+type codeFence struct {
+	char   byte
+	length int
+}
+
+// parseFence reports whether line is a code fence, returning its marker
+func parseFence(line string) (codeFence, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return codeFence{}, "", false
+	}
+	fence := codeFence{char: trimmed[0]}
+	for fence.length < len(trimmed) && trimmed[fence.length] == fence.char {
+		fence.length++
+	}
+	if fence.length < 3 {
+		return codeFence{}, "", false
+	}
+	info := strings.TrimSpace(trimmed[fence.length:])
+	if fence.char == '`' && strings.Contains(info, "`") {
+		return codeFence{}, "", false
+	}
+	return fence, info, true
+}
+
+// closes reports whether line closes a block opened by f
+func (f codeFence) closes(line string) bool {
+	fence, info, ok := parseFence(line)
+	return ok && info == "" && fence.char == f.char && fence.length >= f.length
+}
+
+// splitFinishedBlocks splits content at the last blank line outside a code
+// block, separating the blocks that are finished from the one being typed
+func splitFinishedBlocks(content string) (string, string) {
+	var open *codeFence
+	split := 0
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		offset += len(line)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case open != nil:
+			if open.closes(line) {
+				open = nil
+			}
+		case strings.TrimSpace(line) == "" && offset < len(content):
+			split = offset
+		default:
+			if fence, _, ok := parseFence(line); ok {
+				open = &fence
+			}
+		}
+	}
+	return strings.TrimRight(content[:split], "\n"), content[split:]
+}
+
+// closeOpenFence closes a code block left open at the end of content
+func closeOpenFence(content string) string {
+	var open *codeFence
+	for _, line := range strings.Split(content, "\n") {
+		if open != nil {
+			if open.closes(line) {
+				open = nil
+			}
+		} else if fence, _, ok := parseFence(line); ok {
+			open = &fence
+		}
+	}
+	if open == nil {
+		return content
+	}
+	return strings.TrimRight(content, "\n") + "\n" + strings.Repeat(string(open.char), open.length)
+}
+
+// extractCodeBlocks returns the fenced code blocks of a message in order
+func extractCodeBlocks(content string) []codeBlock {
+	source := []byte(content)
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	var blocks []codeBlock
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		fenced, ok := node.(*ast.FencedCodeBlock)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		var code strings.Builder
+		lines := fenced.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(source))
+		}
+		blocks = append(blocks, codeBlock{
+			lang: strings.ToLower(string(fenced.Language(source))),
+			code: strings.TrimSuffix(code.String(), "\n"),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return blocks
+}
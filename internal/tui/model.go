@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// modelArgs returns the argument schema of /model for completion
+func modelArgs() []extensions.Arg {
+	var choices []string
+	for _, llmType := range llm.GetAvailableLLMs() {
+		choices = append(choices, string(llmType))
+		for _, model := range llm.KnownModels(llmType) {
+			choices = append(choices, llm.Backend{LLM: llmType, Model: model}.String())
+		}
+	}
+	return []extensions.Arg{{Name: "provider[:model]", Kind: extensions.ArgEnum, Choices: choices}}
+}
+
+// switchModel handles /model. Without arguments it shows the active and the
+// known models, otherwise it switches the rest of the session to the given
+// provider and model. The global default set by `mcg pick` is left alone.
+func (m *ChatModel) switchModel(args []string) {
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Active model: %s\n\nKnown models:\n", m.backend.Resolved()))
+		for _, llmType := range llm.GetAvailableLLMs() {
+			keyStatus := ""
+			if !llm.HasAPIKey(llmType) {
+				keyStatus = " (no API key)"
+			}
+			sb.WriteString(fmt.Sprintf("- %s%s: %s\n", llmType, keyStatus, strings.Join(llm.KnownModels(llmType), ", ")))
+		}
+		sb.WriteString("\nType /model <provider>[:model] to switch. Other model names work too.")
+		m.addSystemMessage(sb.String())
+		return
+	}
+
+	backend, err := llm.ParseBackend(args[0])
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	m.backend = backend
+
+	// Continuing the conversation later picks up where this session left off
+	if m.db != nil {
+		if err := m.db.UpdateConversationModel(context.Background(), m.conversationID, backend.String()); err != nil {
+			m.err = fmt.Errorf("failed to save model: %w", err)
+		}
+	}
+
+	content := fmt.Sprintf("Switched to %s for the rest of this session.", backend.Resolved())
+	if !llm.HasAPIKey(backend.LLM) {
+		content += fmt.Sprintf(" It has no API key yet: %s.", llm.APIKeyHint(backend.LLM))
+	}
+	m.addSystemMessage(content)
+}
@@ -0,0 +1,308 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+	"github.com/hawk/mcgraph/internal/llm"
+	"golang.org/x/term"
+)
+
+// maxHeadlessSteps bounds the messages handled for one input, in case a command keeps rescheduling itself
+const maxHeadlessSteps = 10000
+
+// plainWidth is the width the plain chat lays messages out for, as it doesn't know the terminal's
+const plainWidth = 80
+
+// headlessChat runs a ChatModel without a terminal: messages go through Update
+// and the commands it returns run synchronously, feeding their messages back in
+type headlessChat struct {
+	model ChatModel
+	quit  bool
+}
+
+// newHeadlessChat prepares model to run without a screen to draw on
+func newHeadlessChat(model ChatModel) *headlessChat {
+	// A steady cursor schedules no blinks
+	model.textarea.Cursor.SetMode(cursor.CursorStatic)
+	return &headlessChat{model: model}
+}
+
+// immediateTick runs an animation frame or delayed save at once, for chats without a screen to animate
+func immediateTick(d time.Duration, fn func(time.Time) tea.Msg) tea.Cmd {
+	return func() tea.Msg { return fn(time.Now()) }
+}
+
+// update hands msg to the model without running the command it returns
+func (h *headlessChat) update(msg tea.Msg) tea.Cmd {
+	model, cmd := h.model.Update(msg)
+	h.model = model.(ChatModel)
+	return cmd
+}
+
+// send hands msg to the model and runs the commands that follow until the chat settles
+func (h *headlessChat) send(msg tea.Msg) error {
+	return h.run(h.update(msg))
+}
+
+// run runs cmd and every command that follows from the messages it produces
+func (h *headlessChat) run(cmd tea.Cmd) error {
+	pending := []tea.Cmd{cmd}
+	for steps := 0; len(pending) > 0; steps++ {
+		if steps > maxHeadlessSteps {
+			return fmt.Errorf("the chat didn't settle after %d steps", maxHeadlessSteps)
+		}
+		cmd, pending = pending[0], pending[1:]
+		if cmd == nil {
+			continue
+		}
+		switch msg := cmd().(type) {
+		case nil:
+		case tea.BatchMsg:
+			pending = append(pending, msg...)
+		case tea.QuitMsg:
+			h.quit = true
+		case thinkingTickMsg:
+			// The dots animate for as long as the chat runs, so they are left still
+		default:
+			pending = append(pending, h.update(msg))
+		}
+	}
+	return nil
+}
+
+// plainChat is a line-based chat for terminals the full-screen chat doesn't work in,
+// like logs, Emacs shells and screen readers. It drives the same ChatModel, so
+// conversations, slash commands and extensions work as they do on the full screen.
+type plainChat struct {
+	*headlessChat
+	in       *bufio.Scanner
+	out      io.Writer
+	echo     bool               // Print the questions asked, when they weren't typed in a terminal
+	started  bool               // Whether the messages shown before the first question were printed
+	shown    []Message          // Messages printed so far
+	seen     map[uuid.UUID]bool // Saved messages printed, so switching branches doesn't print them again
+	streamed bool               // Whether the last answer was printed as it streamed in
+}
+
+// runPlain runs model as a line-based chat reading questions from in and printing to out.
+// A line ending in a backslash continues on the next one. It ends at the end of the input.
+func runPlain(model ChatModel, in io.Reader, out io.Writer, interactive bool) error {
+	// Nothing is animated, answers are printed as they stream in instead
+	tick = immediateTick
+	defer func() { tick = tea.Tick }()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	p := &plainChat{
+		headlessChat: newHeadlessChat(model),
+		in:           scanner,
+		out:          out,
+		echo:         !interactive,
+		seen:         make(map[uuid.UUID]bool),
+	}
+	p.model.onChunk = p.printChunk
+	p.model.instant = true
+
+	if err := p.send(tea.WindowSizeMsg{Width: plainWidth, Height: 24}); err != nil {
+		return err
+	}
+	p.printNew()
+	p.started = true
+
+	for !p.quit {
+		if p.model.comparison != nil {
+			if err := p.chooseComparison(interactive); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if interactive {
+			fmt.Fprint(p.out, "> ")
+		}
+		input, ok := p.readInput()
+		if !ok {
+			break
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		p.model.textarea.SetValue(input)
+		p.streamed = false
+		if err := p.send(tea.KeyMsg{Type: tea.KeyEnter}); err != nil {
+			return err
+		}
+		p.printNew()
+	}
+	if err := p.in.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	// End the chat the way Ctrl+C does on the full screen
+	if !p.quit {
+		return p.send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	}
+	return nil
+}
+
+// readInput reads a question, joining lines that end in a backslash.
+// It reports false at the end of the input.
+func (p *plainChat) readInput() (string, bool) {
+	var lines []string
+	for p.in.Scan() {
+		line := p.in.Text()
+		if continued, ok := strings.CutSuffix(line, `\`); ok {
+			lines = append(lines, continued)
+			continue
+		}
+		lines = append(lines, line)
+		return strings.Join(lines, "\n"), true
+	}
+	if len(lines) > 0 {
+		return strings.Join(lines, "\n"), true
+	}
+	return "", false
+}
+
+// printChunk prints part of an answer as it streams in, after the question and who answers
+func (p *plainChat) printChunk(chunk string) {
+	if !p.streamed {
+		p.printNew()
+		p.streamed = true
+		fmt.Fprintf(p.out, "McGraph (%s):\n", p.model.backend.Resolved())
+	}
+	fmt.Fprint(p.out, chunk)
+}
+
+// printNew prints the messages added since the last call, along with any notice
+func (p *plainChat) printNew() {
+	messages := p.model.messages
+
+	// Messages are replaced when the chat switches branches, so only what differs is new
+	common := 0
+	for common < len(messages) && common < len(p.shown) && sameMessage(messages[common], p.shown[common]) {
+		common++
+	}
+	for _, msg := range messages[common:] {
+		if msg.ID != uuid.Nil {
+			if p.seen[msg.ID] {
+				continue
+			}
+			p.seen[msg.ID] = true
+		}
+		p.printMessage(msg)
+	}
+	p.shown = append([]Message(nil), messages...)
+
+	if p.model.notice != "" {
+		fmt.Fprintf(p.out, "%s\n\n", p.model.notice)
+		p.model.notice = ""
+	}
+}
+
+// printMessage prints a message without colors or layout
+func (p *plainChat) printMessage(msg Message) {
+	switch {
+	case msg.IsUser:
+		// Questions typed in a terminal are already on the screen. Others are
+		// printed as saved, so secrets that were redacted stay out of logs.
+		if p.started && !p.echo {
+			return
+		}
+		fmt.Fprintf(p.out, "You: %s\n\n", msg.Content)
+		if len(msg.Attachments) > 0 {
+			fmt.Fprintf(p.out, "Attached: %s\n\n", strings.Join(msg.Attachments, ", "))
+		}
+	case msg.IsSystem:
+		fmt.Fprintf(p.out, "System: %s\n\n", msg.Content)
+	case p.streamed && msg.ID != uuid.Nil:
+		// The answer was printed as it streamed in
+		p.streamed = false
+		if msg.Cached {
+			fmt.Fprint(p.out, "\n(answered from the response cache)")
+		}
+		fmt.Fprint(p.out, "\n\n")
+	case msg.Model != "" && msg.Cached:
+		fmt.Fprintf(p.out, "McGraph (%s, cached):\n%s\n\n", msg.Model, msg.Content)
+	case msg.Model != "":
+		fmt.Fprintf(p.out, "McGraph (%s):\n%s\n\n", msg.Model, msg.Content)
+	default:
+		fmt.Fprintf(p.out, "McGraph:\n%s\n\n", msg.Content)
+	}
+}
+
+// chooseComparison prints the compared answers and asks which one to keep
+func (p *plainChat) chooseComparison(interactive bool) error {
+	results := p.model.comparison.results
+	for i, result := range results {
+		body := result.Response.Content
+		if result.Err != nil {
+			body = fmt.Sprintf("Error: %v", result.Err)
+		}
+		fmt.Fprintf(p.out, "[%d] %s\n%s\n\n", i+1, result.Header(), body)
+	}
+	fmt.Fprintf(p.out, "Keep which answer? Type its number (1-%d), or anything else to discard them.\n", len(results))
+	if interactive {
+		fmt.Fprint(p.out, "> ")
+	}
+
+	input, ok := p.readInput()
+	choice, err := strconv.Atoi(strings.TrimSpace(input))
+	if !ok || err != nil || choice < 1 || choice > len(results) || results[choice-1].Err != nil {
+		err = p.send(tea.KeyMsg{Type: tea.KeyEsc})
+	} else {
+		p.model.comparison.selected = choice - 1
+		err = p.send(tea.KeyMsg{Type: tea.KeyEnter})
+	}
+	p.printNew()
+	return err
+}
+
+// sameMessage reports whether a and b are the same shown message
+func sameMessage(a, b Message) bool {
+	return a.ID == b.ID && a.IsSystem == b.IsSystem && a.Content == b.Content && a.Time.Equal(b.Time)
+}
+
+// startPlainChat runs the line-based chat on stdin and stdout
+func startPlainChat(db DBInterface, conversationID uuid.UUID, loadedMessages []Message, opts ChatOptions) error {
+	prompts, err := LoadPromptHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	// There is no input to restore the unsent draft into, so it is left for the next full-screen chat
+	prompts.draftPath = ""
+	opts.PromptHistory = prompts
+
+	// Nothing is drawn in color, so the terminal's background doesn't matter
+	opts.Themes = ThemeConfig{Theme: "dark"}
+
+	if len(loadedMessages) == 0 {
+		loadedMessages = []Message{plainWelcome(opts)}
+	}
+
+	model := NewChatModel(db, conversationID, loadedMessages, opts)
+	return runPlain(model, os.Stdin, os.Stdout, term.IsTerminal(int(os.Stdin.Fd())))
+}
+
+// plainWelcome returns the welcome message of a new plain chat, which has keys of its own
+func plainWelcome(opts ChatOptions) Message {
+	backend := opts.Backend
+	if backend.LLM == "" {
+		backend = llm.CurrentBackend()
+	}
+	profile := opts.Profile
+	if profile.Name == "" {
+		profile = llm.DefaultProfile()
+	}
+	welcome := fmt.Sprintf("Welcome to McGraph Chat! Current LLM: %s (profile: %s)\nType your questions and press Enter to submit.\nEnd a line with \\ to continue on the next one.\nPress Ctrl+D to quit.", backend.Resolved(), profile.Name)
+	return Message{Content: welcome, VisibleContent: welcome, Time: time.Now(), IsComplete: true}
+}
@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// runPlainHarness runs the plain chat of h on input and returns what it printed
+func runPlainHarness(t *testing.T, h *harness, input string, interactive bool) string {
+	t.Helper()
+	var out strings.Builder
+	if err := runPlain(h.model, strings.NewReader(input), &out, interactive); err != nil {
+		t.Fatalf("runPlain: %v", err)
+	}
+	return out.String()
+}
+
+func TestPlainChat(t *testing.T) {
+	opts := ChatOptions{Backend: llm.Backend{LLM: llm.Fake}}
+	h := newHarness(t, []Message{plainWelcome(opts)}, opts)
+
+	out := runPlainHarness(t, h, "How do I start a goroutine?\n\nWrite it\\\non two lines\n/nosuchextension\n", false)
+
+	saved := h.saved()
+	if len(saved) != 4 {
+		t.Fatalf("saved %d messages, want two questions and their answers", len(saved))
+	}
+	if saved[2].Content != "Write it\non two lines" {
+		t.Errorf("continued question = %q, want the lines joined", saved[2].Content)
+	}
+	if saved[3].ParentID.UUID != saved[2].ID {
+		t.Error("the second answer doesn't reply to the second question")
+	}
+	assertGolden(t, "plain", out)
+}
+
+func TestPlainChatInteractive(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+
+	out := runPlainHarness(t, h, "Hello there\n", true)
+
+	if strings.Contains(out, "You: Hello there") {
+		t.Error("a question typed in the terminal was printed again")
+	}
+	if !strings.Contains(out, "> McGraph (fake:echo):\nHello there\n\n> ") {
+		t.Errorf("output = %q, want the streamed answer between prompts", out)
+	}
+}
+
+func TestPlainChatCompare(t *testing.T) {
+	h := newHarness(t, nil, ChatOptions{})
+
+	out := runPlainHarness(t, h, "Pick me\n/compare fake\n1\n", false)
+
+	if !strings.Contains(out, "[1] fake") || !strings.Contains(out, "Keep which answer?") {
+		t.Errorf("output = %q, want the compared answers listed", out)
+	}
+	if !strings.Contains(out, "System: Kept the answer from fake.") {
+		t.Errorf("output = %q, want the kept answer confirmed", out)
+	}
+	// The kept answer is a new branch next to the first answer
+	saved := h.saved()
+	if len(saved) != 3 || saved[2].ParentID.UUID != saved[0].ID {
+		t.Errorf("saved %+v, want the question and two answers to it", saved)
+	}
+}
+
+// TestPlainChatLongAnswer checks that answers are shown whole rather than typed out, however long
+func TestPlainChatLongAnswer(t *testing.T) {
+	llm.SetFakeResponses(strings.Repeat("word ", 20000))
+	defer llm.SetFakeResponses()
+	h := newHarness(t, nil, ChatOptions{Backend: llm.Backend{LLM: llm.Fake, Model: llm.FakeScript}})
+
+	runPlainHarness(t, h, "Say a lot\n", true)
+
+	last := h.model.messages[len(h.model.messages)-1]
+	if last.VisibleContent != last.Content || !last.IsComplete || h.model.typingActive {
+		t.Error("the answer wasn't shown whole as it arrived")
+	}
+}
@@ -0,0 +1,58 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// profileArgs returns the argument schema of /profile for completion
+func profileArgs() []extensions.Arg {
+	// Profiles that fail to load are left out
+	profiles, _ := llm.ListProfiles()
+
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return []extensions.Arg{{Name: "profile", Kind: extensions.ArgEnum, Choices: names}}
+}
+
+// switchProfile handles /profile. Without arguments it lists the available
+// profiles, otherwise it switches the rest of the session to the named one.
+func (m *ChatModel) switchProfile(args []string) {
+	if len(args) == 0 {
+		profiles, err := llm.ListProfiles()
+
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Current profile: %s\n\nAvailable profiles:\n", m.profile.Name))
+		for _, profile := range profiles {
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", profile.Name, profile.Description))
+		}
+		if err != nil {
+			sb.WriteString(fmt.Sprintf("\nWarning: %v\n", err))
+		}
+		sb.WriteString("\nUse /profile <name> to switch.")
+		m.addSystemMessage(sb.String())
+		return
+	}
+
+	profile, err := llm.LoadProfile(args[0])
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error loading profile: %v", err))
+		return
+	}
+	m.profile = profile
+
+	// Record the profile on the conversation
+	if m.db != nil {
+		if err := m.db.UpdateConversationProfile(context.Background(), m.conversationID, profile.Name); err != nil {
+			m.err = fmt.Errorf("failed to save profile: %w", err)
+		}
+	}
+
+	m.addSystemMessage(fmt.Sprintf("Switched to profile: %s", profile.Name))
+}
@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/extensions"
+	"github.com/hawk/mcgraph/internal/project"
+)
+
+// projectArgs returns the argument schema of /project for completion
+func projectArgs() []extensions.Arg {
+	return []extensions.Arg{{Name: "context", Kind: extensions.ArgEnum, Choices: []string{"tree", "diff"}, Optional: true}}
+}
+
+// handleProjectCommand handles /project. Without arguments it describes the
+// detected project; "tree" and "diff" add that context for the rest of the session.
+func (m *ChatModel) handleProjectCommand(args []string) {
+	if m.project == nil {
+		m.addSystemMessage("Not inside a git repository, or project context is disabled.")
+		return
+	}
+
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Project: %s\nRoot: %s\n", m.project.Name(), m.project.Root))
+		if branch, err := m.project.Branch(); err == nil {
+			sb.WriteString(fmt.Sprintf("Branch: %s\n", branch))
+		}
+		if instructions, err := m.project.Instructions(); err == nil && instructions != "" {
+			sb.WriteString(fmt.Sprintf("Instructions: loaded from %s\n", project.InstructionsFile))
+		} else {
+			sb.WriteString(fmt.Sprintf("Instructions: none (add a %s file to the project root)\n", project.InstructionsFile))
+		}
+		sb.WriteString("\nUse /project tree or /project diff to add more context.")
+		m.addSystemMessage(sb.String())
+		return
+	}
+
+	var title, content string
+	var err error
+	switch args[0] {
+	case "tree":
+		title = "Project files"
+		content, err = m.project.FileTree(project.DefaultMaxTreeFiles)
+	case "diff":
+		title = "Uncommitted changes"
+		content, err = m.project.DiffSummary()
+	default:
+		m.addSystemMessage(fmt.Sprintf("Unknown project context: %s. Use tree or diff.", args[0]))
+		return
+	}
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error loading project context: %v", err))
+		return
+	}
+
+	m.systemContext = strings.TrimSpace(m.systemContext + "\n\n" + title + ":\n" + content)
+	m.addSystemMessage(fmt.Sprintf("Added to the context for the rest of this session:\n\n%s:\n%s", title, content))
+}
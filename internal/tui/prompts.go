@@ -0,0 +1,359 @@
+package tui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxPromptHistory is the number of past prompts kept
+const maxPromptHistory = 1000
+
+// draftSaveDelay is how long typing has to pause before the draft is saved
+const draftSaveDelay = time.Second
+
+// PromptHistory holds the prompts sent in past sessions and the unsent draft.
+// Without a path it only lives for the session.
+type PromptHistory struct {
+	path      string   // File with one JSON string per prompt, oldest first
+	draftPath string   // File with the unsent draft
+	entries   []string // Oldest first
+}
+
+// getConfigFile returns the path of a file in the config directory
+func getConfigFile(name string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".mcgraph", name), nil
+}
+
+// LoadPromptHistory loads the prompts of past sessions from ~/.mcgraph/prompt_history
+func LoadPromptHistory() (*PromptHistory, error) {
+	path, err := getConfigFile("prompt_history")
+	if err != nil {
+		return &PromptHistory{}, err
+	}
+	draftPath, err := getConfigFile("draft")
+	if err != nil {
+		return &PromptHistory{}, err
+	}
+	history := &PromptHistory{path: path, draftPath: draftPath}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return history, fmt.Errorf("failed to read prompt history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var prompt string
+		if err := json.Unmarshal(scanner.Bytes(), &prompt); err != nil {
+			continue // Skip damaged lines rather than losing the rest
+		}
+		history.entries = append(history.entries, prompt)
+	}
+	if err := scanner.Err(); err != nil {
+		return history, fmt.Errorf("failed to read prompt history: %w", err)
+	}
+
+	// Compact the file once it grows well past the limit
+	if len(history.entries) > maxPromptHistory {
+		history.entries = history.entries[len(history.entries)-maxPromptHistory:]
+		if err := history.rewrite(); err != nil {
+			return history, err
+		}
+	}
+	return history, nil
+}
+
+// rewrite replaces the history file with the entries in memory
+func (h *PromptHistory) rewrite() error {
+	var sb strings.Builder
+	for _, prompt := range h.entries {
+		line, _ := json.Marshal(prompt)
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+	if err := os.WriteFile(h.path, []byte(sb.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write prompt history: %w", err)
+	}
+	return nil
+}
+
+// Add records a sent prompt, skipping repeats of the previous one
+func (h *PromptHistory) Add(prompt string) error {
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == prompt {
+		return nil
+	}
+	h.entries = append(h.entries, prompt)
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write prompt history: %w", err)
+	}
+	defer file.Close()
+
+	line, _ := json.Marshal(prompt)
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write prompt history: %w", err)
+	}
+	return nil
+}
+
+// Draft returns the prompt left unsent when the last session ended
+func (h *PromptHistory) Draft() string {
+	if h.draftPath == "" {
+		return ""
+	}
+	data, err := os.ReadFile(h.draftPath)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// SaveDraft stores the unsent prompt, removing the draft when it is empty
+func (h *PromptHistory) SaveDraft(draft string) error {
+	if h.draftPath == "" {
+		return nil
+	}
+	if strings.TrimSpace(draft) == "" {
+		if err := os.Remove(h.draftPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove draft: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.draftPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(h.draftPath, []byte(draft), 0600); err != nil {
+		return fmt.Errorf("failed to save draft: %w", err)
+	}
+	return nil
+}
+
+// historySearch is an incremental reverse search through past prompts
+type historySearch struct {
+	query    string
+	match    int    // Index of the matching prompt, -1 when nothing matches
+	original string // Input to restore when the search is cancelled
+}
+
+// draftSaveMsg saves the draft if nothing was typed since it was scheduled
+type draftSaveMsg struct {
+	seq int
+}
+
+// editorFinishedMsg carries the prompt composed in the external editor
+type editorFinishedMsg struct {
+	content string
+	err     error
+}
+
+// recordPrompt adds a sent prompt to the history and clears the draft
+func (m *ChatModel) recordPrompt(prompt string) {
+	m.historyIndex = -1
+	if err := m.prompts.Add(redactForDisk(prompt)); err != nil {
+		m.notice = err.Error()
+	}
+	m.draftSeq++
+	m.savedDraft = ""
+	if err := m.prompts.SaveDraft(""); err != nil {
+		m.notice = err.Error()
+	}
+}
+
+// recallPrompt replaces the input with an older (-1) or newer (1) prompt.
+// Moving past the newest prompt brings back what was being typed.
+// It reports whether the key was used.
+func (m *ChatModel) recallPrompt(delta int) bool {
+	entries := m.prompts.entries
+	index := m.historyIndex
+	if index < 0 {
+		if delta > 0 {
+			return false
+		}
+		index = len(entries)
+		m.historyStash = m.textarea.Value()
+	}
+
+	index += delta
+	switch {
+	case index < 0:
+		return true // Already at the oldest prompt
+	case index >= len(entries):
+		m.historyIndex = -1
+		m.textarea.SetValue(m.historyStash)
+	default:
+		m.historyIndex = index
+		m.textarea.SetValue(entries[index])
+	}
+	return true
+}
+
+// startHistorySearch starts a reverse search through past prompts
+func (m *ChatModel) startHistorySearch() {
+	m.closeCompletion()
+	m.search = &historySearch{match: -1, original: m.textarea.Value()}
+}
+
+// findPrompt returns the newest prompt before index containing query, or -1
+func (m *ChatModel) findPrompt(query string, before int) int {
+	query = strings.ToLower(query)
+	for i := before - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(m.prompts.entries[i]), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleSearchKey handles keys during a reverse search
+func (m *ChatModel) handleSearchKey(msg tea.KeyMsg) {
+	s := m.search
+	switch msg.Type {
+	case tea.KeyCtrlR:
+		// Look further back for the same query
+		start := s.match
+		if start < 0 {
+			start = len(m.prompts.entries)
+		}
+		if match := m.findPrompt(s.query, start); match >= 0 {
+			s.match = match
+		}
+		return
+	case tea.KeyEsc, tea.KeyCtrlG, tea.KeyCtrlC:
+		m.textarea.SetValue(s.original)
+		m.search = nil
+		return
+	case tea.KeyBackspace:
+		if s.query != "" {
+			runes := []rune(s.query)
+			s.query = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		// Space comes with its rune
+		s.query += string(msg.Runes)
+	default:
+		// Any other key, like Enter, takes the match into the input for editing
+		if s.match >= 0 {
+			m.textarea.SetValue(m.prompts.entries[s.match])
+		}
+		m.search = nil
+		return
+	}
+
+	s.match = -1
+	if s.query != "" {
+		s.match = m.findPrompt(s.query, len(m.prompts.entries))
+	}
+}
+
+// renderSearch renders the reverse search prompt in place of the input
+func (m ChatModel) renderSearch() string {
+	s := m.search
+	label := "(reverse-i-search)"
+	match := ""
+	if s.match >= 0 {
+		match = m.prompts.entries[s.match]
+		if i := strings.Index(match, "\n"); i >= 0 {
+			match = match[:i] + " ..."
+		}
+	} else if s.query != "" {
+		label = "(failed reverse-i-search)"
+	}
+	return fmt.Sprintf("%s`%s': %s", infoStyle.Render(label), s.query, match)
+}
+
+// scheduleDraftSave saves the input as a draft once typing pauses
+func (m *ChatModel) scheduleDraftSave() tea.Cmd {
+	if m.textarea.Value() == m.savedDraft {
+		return nil
+	}
+	m.draftSeq++
+	seq := m.draftSeq
+	return tick(draftSaveDelay, func(time.Time) tea.Msg {
+		return draftSaveMsg{seq: seq}
+	})
+}
+
+// saveDraft stores the input so it survives the end of the session
+func (m *ChatModel) saveDraft() {
+	draft := m.textarea.Value()
+	if draft == m.savedDraft {
+		return
+	}
+	if err := m.prompts.SaveDraft(redactForDisk(draft)); err != nil {
+		m.notice = err.Error()
+		return
+	}
+	m.savedDraft = draft
+}
+
+// quit saves the draft and ends the chat
+func (m *ChatModel) quit() tea.Cmd {
+	m.saveDraft()
+	m.quitting = true
+	return tea.Quit
+}
+
+// openEditor composes the prompt in $VISUAL or $EDITOR, starting from the current input
+func (m *ChatModel) openEditor() tea.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "mcgraph-prompt-*.md")
+	if err != nil {
+		m.notice = fmt.Sprintf("Failed to create a file for the editor: %v", err)
+		return nil
+	}
+	path := file.Name()
+	_, err = file.WriteString(m.textarea.Value())
+	file.Close()
+	if err != nil {
+		os.Remove(path)
+		m.notice = fmt.Sprintf("Failed to create a file for the editor: %v", err)
+		return nil
+	}
+
+	// EDITOR may carry arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), path)
+	cmd := exec.Command(args[0], args[1:]...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return editorFinishedMsg{err: fmt.Errorf("editor %s failed: %w", args[0], err)}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return editorFinishedMsg{err: fmt.Errorf("failed to read the edited prompt: %w", err)}
+		}
+		return editorFinishedMsg{content: strings.TrimRight(string(data), "\n")}
+	})
+}
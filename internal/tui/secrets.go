@@ -0,0 +1,46 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hawk/mcgraph/internal/llm"
+	"github.com/hawk/mcgraph/internal/secrets"
+)
+
+// checkSecrets applies the secrets policy to a message about to be sent
+func checkSecrets(input string, attachments []llm.Attachment) (llm.Message, []secrets.Finding, error) {
+	policy, _ := secrets.PolicyFromEnv()
+	return llm.CheckSecrets(policy, llm.Message{Role: llm.RoleUser, Content: input, Attachments: attachments})
+}
+
+// redactForDisk redacts the secrets in prompts kept in the prompt history and
+// drafts, unless the policy only warns about them
+func redactForDisk(text string) string {
+	if policy, _ := secrets.PolicyFromEnv(); policy == secrets.Warn {
+		return text
+	}
+	redacted, _, _ := secrets.Check(secrets.Redact, text)
+	return redacted
+}
+
+// describeSecrets tells what happened to the secrets found in a message
+func describeSecrets(findings []secrets.Finding) string {
+	if policy, _ := secrets.PolicyFromEnv(); policy == secrets.Warn {
+		return fmt.Sprintf("Your message contains %s and was sent as is (%s=warn).", secrets.Describe(findings), secrets.PolicyEnvVar)
+	}
+	return fmt.Sprintf("Redacted %s from your message before sending and saving it.", secrets.Describe(findings))
+}
+
+// highlightRedactions marks the placeholders of redacted secrets in text
+func highlightRedactions(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, placeholder := range secrets.Placeholders(text) {
+		sb.WriteString(text[last:placeholder[0]])
+		sb.WriteString(redactedStyle.Render(text[placeholder[0]:placeholder[1]]))
+		last = placeholder[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
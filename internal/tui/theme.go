@@ -0,0 +1,384 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/hawk/mcgraph/internal/extensions"
+)
+
+// AutoTheme picks the dark or light theme from the terminal background
+const AutoTheme = "auto"
+
+// Theme is a set of colors for the chat. Colors are hex codes or ANSI color
+// numbers; unset colors of a user theme come from its base theme.
+type Theme struct {
+	Name        string `json:"-"`
+	Description string `json:"description,omitempty"`
+	Base        string `json:"base,omitempty"`       // Built-in theme a user theme extends, dark by default
+	Markdown    string `json:"markdown,omitempty"`   // Markdown style for answers: dark or light
+	CodeStyle   string `json:"code_style,omitempty"` // Chroma style for code blocks
+	User        string `json:"user,omitempty"`
+	AI          string `json:"ai,omitempty"`
+	System      string `json:"system,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Muted       string `json:"muted,omitempty"` // Timestamps, branch labels and descriptions
+	Error       string `json:"error,omitempty"`
+	Info        string `json:"info,omitempty"`
+	Accent      string `json:"accent,omitempty"` // Selected completion
+	Spinner     string `json:"spinner,omitempty"`
+	Border      string `json:"border,omitempty"`
+}
+
+// builtinThemes are always available. A user theme with the same name overrides them.
+var builtinThemes = map[string]Theme{
+	"dark": {
+		Name:        "dark",
+		Description: "Light text for dark terminals",
+		Markdown:    "dark",
+		CodeStyle:   "monokai",
+		User:        "#5DADE2",
+		AI:          "#58D68D",
+		System:      "#FF9933",
+		Text:        "#D0D0D0",
+		Muted:       "#A0A0A0",
+		Error:       "#E74C3C",
+		Info:        "#F4D03F",
+		Accent:      "#5DADE2",
+		Spinner:     "205",
+		Border:      "#696969",
+	},
+	"light": {
+		Name:        "light",
+		Description: "Dark text for light terminals",
+		Markdown:    "light",
+		CodeStyle:   "github",
+		User:        "#1F618D",
+		AI:          "#1E8449",
+		System:      "#AF601A",
+		Text:        "#303030",
+		Muted:       "#707070",
+		Error:       "#C0392B",
+		Info:        "#9A7D0A",
+		Accent:      "#1F618D",
+		Spinner:     "#C2185B",
+		Border:      "#A0A0A0",
+	},
+	"high-contrast": {
+		Name:        "high-contrast",
+		Description: "Bright, saturated colors for readability",
+		Markdown:    "dark",
+		CodeStyle:   "hr_high_contrast",
+		User:        "#00FFFF",
+		AI:          "#00FF00",
+		System:      "#FFFF00",
+		Text:        "#FFFFFF",
+		Muted:       "#E0E0E0",
+		Error:       "#FF5555",
+		Info:        "#FFFF00",
+		Accent:      "#FFFF00",
+		Spinner:     "#FFFFFF",
+		Border:      "#FFFFFF",
+	},
+}
+
+// ThemeConfig is the theme configuration stored in ~/.mcgraph/theme.json
+type ThemeConfig struct {
+	Theme     string           `json:"theme"`                // Theme name, or auto
+	CodeStyle string           `json:"code_style,omitempty"` // Chroma style overriding the theme's
+	Themes    map[string]Theme `json:"themes,omitempty"`     // User themes
+}
+
+// getThemeConfigFile returns the path of the theme configuration
+func getThemeConfigFile() (string, error) {
+	return getConfigFile("theme.json")
+}
+
+// LoadThemeConfig loads the theme configuration. A missing file selects the auto theme.
+func LoadThemeConfig() (ThemeConfig, error) {
+	config := ThemeConfig{Theme: AutoTheme}
+
+	configFile, err := getThemeConfigFile()
+	if err != nil {
+		return config, err
+	}
+
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read theme config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ThemeConfig{Theme: AutoTheme}, fmt.Errorf("failed to parse theme config: %w", err)
+	}
+	return config, nil
+}
+
+// SaveThemeConfig saves the theme configuration
+func SaveThemeConfig(config ThemeConfig) error {
+	configFile, err := getThemeConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal theme config: %w", err)
+	}
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write theme config: %w", err)
+	}
+	return nil
+}
+
+// FindTheme returns the named theme with the configured code style applied.
+// auto resolves to dark or light depending on the terminal background.
+func (c ThemeConfig) FindTheme(name string) (Theme, error) {
+	if name == "" || name == AutoTheme {
+		name = "light"
+		if lipgloss.HasDarkBackground() {
+			name = "dark"
+		}
+	}
+
+	theme, ok := builtinThemes[name]
+	if user, isUser := c.Themes[name]; isUser {
+		base, ok := builtinThemes[user.Base]
+		if user.Base == "" {
+			base = builtinThemes["dark"]
+		} else if !ok {
+			return Theme{}, fmt.Errorf("theme %s: unknown base theme %s", name, user.Base)
+		}
+		theme = mergeTheme(base, user)
+		theme.Name = name
+	} else if !ok {
+		return Theme{}, fmt.Errorf("unknown theme: %s", name)
+	}
+
+	if c.CodeStyle != "" {
+		theme.CodeStyle = c.CodeStyle
+	}
+	return theme, nil
+}
+
+// ActiveTheme returns the configured theme
+func (c ThemeConfig) ActiveTheme() (Theme, error) {
+	return c.FindTheme(c.Theme)
+}
+
+// ThemeNames returns the built-in and user themes, sorted
+func (c ThemeConfig) ThemeNames() []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	for name := range c.Themes {
+		if _, ok := builtinThemes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mergeTheme returns base with the fields set in override
+func mergeTheme(base, override Theme) Theme {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return Theme{
+		Description: pick(override.Description, base.Description),
+		Base:        base.Name,
+		Markdown:    pick(override.Markdown, base.Markdown),
+		CodeStyle:   pick(override.CodeStyle, base.CodeStyle),
+		User:        pick(override.User, base.User),
+		AI:          pick(override.AI, base.AI),
+		System:      pick(override.System, base.System),
+		Text:        pick(override.Text, base.Text),
+		Muted:       pick(override.Muted, base.Muted),
+		Error:       pick(override.Error, base.Error),
+		Info:        pick(override.Info, base.Info),
+		Accent:      pick(override.Accent, base.Accent),
+		Spinner:     pick(override.Spinner, base.Spinner),
+		Border:      pick(override.Border, base.Border),
+	}
+}
+
+// ApplyTheme restyles the chat with theme
+func ApplyTheme(theme Theme) {
+	userStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.User)).
+		PaddingLeft(2).
+		PaddingRight(2).
+		Bold(true)
+
+	aiStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.AI)).
+		Bold(true)
+
+	timestampStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Muted)).
+		Italic(true).
+		MarginRight(1)
+
+	errorStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Error)).
+		MarginLeft(2).
+		Bold(true)
+
+	infoStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Info)).
+		MarginLeft(2).
+		Italic(true)
+
+	systemStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.System)).
+		MarginLeft(2).
+		Italic(true)
+
+	branchStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Muted))
+
+	completionBoxStyle = lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(theme.Border))
+
+	completionItemStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Text))
+
+	completionSelectedStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Accent)).
+		Reverse(true).
+		Bold(true)
+
+	completionDescStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Muted)).
+		Italic(true)
+
+	spinnerStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Spinner))
+
+	redactedStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(theme.Error)).
+		Reverse(true)
+
+	renderer.setTheme(theme)
+}
+
+func init() {
+	ApplyTheme(builtinThemes["dark"])
+}
+
+// themeArgs returns the argument schema of /theme for completion
+func themeArgs() []extensions.Arg {
+	config, _ := LoadThemeConfig()
+	return []extensions.Arg{
+		{Name: "theme", Kind: extensions.ArgEnum, Choices: append(append([]string{AutoTheme}, config.ThemeNames()...), "code")},
+		{Name: "code-style", Kind: extensions.ArgEnum, Choices: append([]string{"default"}, styles.Names()...)},
+	}
+}
+
+// setTheme shows the chat in theme
+func (m *ChatModel) setTheme(theme Theme) {
+	ApplyTheme(theme)
+	m.spinner.Style = spinnerStyle
+	m.shownTheme = theme
+	m.updateViewportContent()
+}
+
+// previewTheme shows the theme or code style highlighted in the /theme
+// completion popup, going back to the active theme once the popup closes
+func (m *ChatModel) previewTheme() {
+	theme := m.theme
+	input := m.textarea.Value()
+	if m.completion.visible && strings.HasPrefix(input, "/theme ") {
+		config := m.themes
+		choice := m.completion.items[m.completion.selected].value
+		if fields := strings.Fields(input); len(fields) >= 2 && fields[1] == "code" && strings.Count(input, " ") >= 2 {
+			config.CodeStyle = strings.TrimPrefix(choice, "default")
+		} else {
+			config.Theme = choice
+		}
+		if preview, err := config.ActiveTheme(); err == nil {
+			theme = preview
+		}
+	}
+	if theme != m.shownTheme {
+		m.setTheme(theme)
+	}
+}
+
+// switchTheme handles /theme. Without arguments it lists the themes,
+// otherwise it switches to the given theme or code style and saves it.
+func (m *ChatModel) switchTheme(args []string) {
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Current theme: %s", m.theme.Name))
+		if m.themes.Theme == "" || m.themes.Theme == AutoTheme {
+			sb.WriteString(" (auto)")
+		}
+		sb.WriteString(fmt.Sprintf("\nCode style: %s\n\nAvailable themes:\n", m.theme.CodeStyle))
+		sb.WriteString("- auto: dark or light, depending on the terminal background\n")
+		for _, name := range m.themes.ThemeNames() {
+			theme, err := m.themes.FindTheme(name)
+			if err != nil {
+				sb.WriteString(fmt.Sprintf("- %s: %v\n", name, err))
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", name, theme.Description))
+		}
+		sb.WriteString("\nUse /theme <name> to switch, or /theme code <style> to change the code style. Press Tab after /theme to preview themes.")
+		m.addSystemMessage(sb.String())
+		return
+	}
+
+	config := m.themes
+	var content string
+	if args[0] == "code" {
+		if len(args) < 2 {
+			m.addSystemMessage("Usage: /theme code <style>, or /theme code default for the theme's own style")
+			return
+		}
+		style := args[1]
+		if style == "default" {
+			style = ""
+		} else if _, ok := styles.Registry[style]; !ok {
+			m.addSystemMessage(fmt.Sprintf("Error: unknown code style: %s", style))
+			return
+		}
+		config.CodeStyle = style
+		content = fmt.Sprintf("Code style set to %s.", args[1])
+	} else {
+		config.Theme = args[0]
+		content = fmt.Sprintf("Theme set to %s.", args[0])
+	}
+
+	theme, err := config.ActiveTheme()
+	if err != nil {
+		m.addSystemMessage(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	m.themes = config
+	m.theme = theme
+	m.setTheme(theme)
+
+	if err := SaveThemeConfig(config); err != nil {
+		content += fmt.Sprintf(" It applies to this session only: %v", err)
+	}
+	m.addSystemMessage(content)
+}
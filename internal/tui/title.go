@@ -0,0 +1,38 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/hawk/mcgraph/internal/llm"
+)
+
+// titleFailedMsg reports that the conversation couldn't be titled
+type titleFailedMsg struct {
+	err error
+}
+
+// generateTitle names the conversation after its first exchange in the
+// background. When no model can write a title, it is cut from the first question.
+func (m *ChatModel) generateTitle(backend llm.Backend, question, answer string) tea.Cmd {
+	if m.db == nil {
+		return nil
+	}
+	db := m.db
+	conversationID := m.conversationID
+	return func() tea.Msg {
+		ctx := context.Background()
+		title, err := llm.GenerateTitle(llm.TitleBackend(backend), question, answer)
+		if err != nil {
+			if _, err := db.GenerateTitle(ctx, conversationID); err != nil {
+				return titleFailedMsg{err: fmt.Errorf("failed to generate title: %w", err)}
+			}
+			return nil
+		}
+		if err := db.UpdateConversationTitle(ctx, conversationID, title); err != nil {
+			return titleFailedMsg{err: fmt.Errorf("failed to save title: %w", err)}
+		}
+		return nil
+	}
+}